@@ -0,0 +1,28 @@
+// OpenAPI document of the server and the page showing it, both embedded in the program
+package api
+
+import (
+	"context"
+	"embed"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// OpenAPI document of version 1 of the api
+//
+//go:embed openapi.yaml
+var OpenApiYaml []byte
+
+// Swagger UI showing /openapi.json, served by the program itself
+//
+//go:embed docs
+var Docs embed.FS
+
+// Load and validate the OpenAPI document
+func Load() (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(OpenApiYaml)
+	if err != nil {
+		return nil, err
+	}
+	return doc, doc.Validate(context.Background())
+}
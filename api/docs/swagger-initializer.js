@@ -0,0 +1,16 @@
+// Show the OpenAPI document of the server, without the top bar to explore documents of other sites
+window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "/openapi.json",
+    dom_id: '#swagger-ui',
+    deepLinking: true,
+    presets: [
+      SwaggerUIBundle.presets.apis
+    ],
+    plugins: [
+      SwaggerUIBundle.plugins.DownloadUrl
+    ],
+    layout: "BaseLayout",
+    validatorUrl: null
+  });
+};
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bank/config"
+)
+
+// Show the effective configuration of file, environment variables and flags, with the secrets redacted.
+// Usage: bank [flags] config show
+func configCommand(args []string) error {
+	if len(args) == 0 || args[0] != "show" {
+		return errors.New("usage: bank config show")
+	}
+
+	out, err := config.Current.Yaml()
+	if err != nil {
+		return fmt.Errorf("config show: %w", err)
+	}
+	fmt.Print(out)
+	return nil
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Load with only the environment variables of env set and the yaml file content, when not empty, as -config
+func load(t *testing.T, file string, env map[string]string, args ...string) (Config, []string, error) {
+	t.Helper()
+
+	current := Current
+	t.Cleanup(func() { Current = current })
+	t.Setenv("BANK_CONFIG", "")
+	for _, s := range settings {
+		t.Setenv(s.env, env[s.env])
+	}
+
+	if len(file) > 0 {
+		path := filepath.Join(t.TempDir(), "bank.yaml")
+		if err := os.WriteFile(path, []byte(file), 0600); err != nil {
+			t.Fatal(err)
+		}
+		args = append([]string{"-config", path}, args...)
+	}
+	rest, err := Load(args)
+	return Current, rest, err
+}
+
+func TestPrecedence(t *testing.T) {
+	file := "listen: :9000\ndatabase:\n  max_conns: 5\ncors:\n  origins: [https://file.example.com]\n"
+
+	tests := []struct {
+		name     string
+		file     string
+		env      map[string]string
+		args     []string
+		listen   string
+		maxConns int32
+		origins  []string
+	}{
+		{"defaults", "", nil, nil, ":8080", 0, []string{"http://localhost:4200"}},
+		{"file over defaults", file, nil, nil, ":9000", 5, []string{"https://file.example.com"}},
+		{"environment over file", file, map[string]string{"LISTEN_ADDRESS": ":9100", "DATABASE_MAX_CONNS": "7"}, nil,
+			":9100", 7, []string{"https://file.example.com"}},
+		{"flags over environment", file, map[string]string{"LISTEN_ADDRESS": ":9100", "CORS_ORIGINS": "https://env.example.com"},
+			[]string{"-listen", ":9200", "-database-max-conns", "9"}, ":9200", 9, []string{"https://env.example.com"}},
+		{"last flag wins", "", nil, []string{"-listen", ":9300", "-listen", ":9400"}, ":9400", 0, []string{"http://localhost:4200"}},
+		{"list of the environment", "", map[string]string{"CORS_ORIGINS": "https://a.example.com, https://b.example.com"}, nil,
+			":8080", 0, []string{"https://a.example.com", "https://b.example.com"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, _, err := load(t, test.file, test.env, test.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Listen != test.listen || c.Database.MaxConns != test.maxConns || !reflect.DeepEqual(c.Cors.Origins, test.origins) {
+				t.Errorf("got listen %s, max conns %d, origins %v, want %s, %d, %v",
+					c.Listen, c.Database.MaxConns, c.Cors.Origins, test.listen, test.maxConns, test.origins)
+			}
+		})
+	}
+}
+
+func TestLoadCommand(t *testing.T) {
+	_, rest, err := load(t, "", nil, "-listen", ":9000", "config", "show")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rest, []string{"config", "show"}) {
+		t.Errorf("got %v, want the command after the flags", rest)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{"unknown setting in file", "listen: :9000\nport: 8080\n", nil, nil, "port"},
+		{"invalid environment variable", "", map[string]string{"DATABASE_MAX_CONNS": "many"}, nil, "DATABASE_MAX_CONNS"},
+		{"invalid flag", "", nil, []string{"-request-timeout", "soon"}, "request-timeout"},
+		{"invalid after precedence", "log:\n  level: info\n", map[string]string{"LOG_LEVEL": "loud"}, nil, "log level"},
+		{"invalid currency", "", map[string]string{"EXPORT_CURRENCY": "euro"}, nil, "currency"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			current := Current
+			if _, _, err := load(t, test.file, test.env, test.args...); err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want one about %s", err, test.want)
+			}
+			if !reflect.DeepEqual(Current, current) {
+				t.Errorf("configuration changed by an invalid one")
+			}
+		})
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		database string
+		want     string
+	}{
+		{"postgres://bank:secret@db:5432/bank", "postgres://bank:xxxxx@db:5432/bank"},
+		{"postgres://bank@db/bank?password=secret&sslmode=require", "postgres://bank@db/bank?password=xxxxx&sslmode=require"},
+		{"host=db user=bank password=secret dbname=bank", "host=db user=bank password=xxxxx dbname=bank"},
+		{"postgres://db/bank", "postgres://db/bank"},
+		{"sqlite://./bank.db", "sqlite://./bank.db"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := redact(test.database); got != test.want {
+			t.Errorf("redact(%q) = %q, want %q", test.database, got, test.want)
+		}
+	}
+}
+
+// config show and the log of the configuration at startup leave out the password
+func TestShowRedacted(t *testing.T) {
+	c, _, err := load(t, "database:\n  url: postgres://bank:secret@db/bank\n", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := c.Yaml()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "secret") || !strings.Contains(out, "url: postgres://bank:xxxxx@db/bank") {
+		t.Errorf("config show:\n%s\nwant the url without password", out)
+	}
+	if url := c.Fields()["database-url"]; url != "postgres://bank:xxxxx@db/bank" {
+		t.Errorf("logged url %v, want it without password", url)
+	}
+	if c.Database.Url != "postgres://bank:secret@db/bank" {
+		t.Errorf("url %s, want the configuration itself unchanged", c.Database.Url)
+	}
+}
@@ -0,0 +1,396 @@
+package convert
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bank/domain"
+)
+
+// Counterparty and target used when a beancount transaction does not name them
+const BookUnknown = "unknown"
+
+// A transaction read from a journal, accounts and target are referenced by number and name
+// because they do not have an id in the bank yet. The id of the transaction is only set
+// when the journal was exported by the bank.
+type BookEntry struct {
+	Transaction domain.Transaction `json:"transaction"`
+	From        string             `json:"from"`
+	To          string             `json:"to"`
+	Target      string             `json:"target"`
+}
+
+// Everything read from a journal
+type ImportedBook struct {
+	Accounts []domain.Account `json:"accounts"`
+	Targets  []domain.Target  `json:"targets"`
+	Entries  []BookEntry      `json:"entries"`
+}
+
+func beancountString(value string) string {
+	value = strings.ReplaceAll(value, "\\", "\\\\")
+	value = strings.ReplaceAll(value, "\"", "\\\"")
+	return "\"" + strings.ReplaceAll(value, "\n", " ") + "\""
+}
+
+// Write the book as beancount journal.
+// The bank identifications are kept as metadata, so the journal can be imported again.
+// An account is opened on the date of its first posting, one without postings with the first transaction.
+func WriteBeancount(w io.Writer, book Book) error {
+	writer := bufio.NewWriter(w)
+	index := book.index()
+	transactions := book.sortedTransactions()
+
+	// a book without transactions opens its accounts at the start of unix time
+	first := time.Unix(0, 0).UTC()
+	if len(transactions) > 0 {
+		first = transactions[0].Date
+	}
+	opening := map[string]time.Time{}
+	for _, transaction := range transactions {
+		for _, posting := range index.postings(transaction) {
+			if _, ok := opening[posting.Account]; !ok {
+				opening[posting.Account] = transaction.Date
+			}
+		}
+	}
+	open := func(name string) string {
+		date, ok := opening[name]
+		if !ok {
+			date = first
+		}
+		return fmt.Sprintf("%s open %s %s\n", date.Format("2006-01-02"), name, book.Currency)
+	}
+
+	fmt.Fprintf(writer, "option \"operating_currency\" %s\n\n", beancountString(book.Currency))
+
+	for _, account := range index.sortedAccounts() {
+		fmt.Fprint(writer, open(index.accountNames[account.Id]))
+		fmt.Fprintf(writer, "  number: %s\n", beancountString(account.Number))
+		fmt.Fprintf(writer, "  description: %s\n", beancountString(account.Description))
+	}
+
+	for _, target := range index.sortedTargets() {
+		for _, root := range []string{BookExpenses, BookIncome} {
+			fmt.Fprint(writer, open(root+":"+index.targetNames[target.Id]))
+			fmt.Fprintf(writer, "  name: %s\n", beancountString(target.Name))
+			fmt.Fprintf(writer, "  description: %s\n", beancountString(target.Description))
+		}
+	}
+
+	for _, transaction := range transactions {
+		payee := index.accounts[transaction.To_account].Number
+		if !index.own[transaction.From_account] {
+			payee = index.accounts[transaction.From_account].Number
+		}
+
+		fmt.Fprintln(writer)
+		fmt.Fprintf(writer, "%s * %s %s\n", transaction.Date.Format("2006-01-02"), beancountString(payee), beancountString(transaction.Description))
+		fmt.Fprintf(writer, "  id: %s\n", beancountString(strconv.FormatInt(transaction.Id, 10)))
+		fmt.Fprintf(writer, "  from: %s\n", beancountString(index.accounts[transaction.From_account].Number))
+		fmt.Fprintf(writer, "  to: %s\n", beancountString(index.accounts[transaction.To_account].Number))
+		fmt.Fprintf(writer, "  target: %s\n", beancountString(index.targets[transaction.Target].Name))
+
+		for _, posting := range index.postings(transaction) {
+			fmt.Fprintf(writer, "  %-50s %12s %s\n", posting.Account, FormatAmount(posting.Amount, "."), book.Currency)
+		}
+	}
+
+	return writer.Flush()
+}
+
+// A directive of a beancount file with its metadata and postings
+type beancountDirective struct {
+	Line      int
+	Date      time.Time
+	Kind      string // open or txn
+	Account   string
+	Payee     string
+	Narration string
+	Meta      map[string]string
+	Postings  []beancountPosting
+}
+
+type beancountPosting struct {
+	Account string
+	Amount  int64
+	Missing bool
+}
+
+// Split a line in fields, quoted strings are one field without quotes
+func beancountFields(line string) ([]string, error) {
+	fields := []string{}
+	runes := []rune(line)
+
+	for i := 0; i < len(runes); {
+		switch {
+		case runes[i] == ';':
+			return fields, nil
+		case runes[i] == ' ' || runes[i] == '\t':
+			i++
+		case runes[i] == '"':
+			var builder strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				builder.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return fields, fmt.Errorf("unterminated string")
+			}
+			i++
+			fields = append(fields, "\""+builder.String())
+		default:
+			start := i
+			for i < len(runes) && runes[i] != ' ' && runes[i] != '\t' {
+				i++
+			}
+			fields = append(fields, string(runes[start:i]))
+		}
+	}
+
+	return fields, nil
+}
+
+func isBeancountString(field string) bool {
+	return strings.HasPrefix(field, "\"")
+}
+
+func beancountValue(field string) string {
+	return strings.TrimPrefix(field, "\"")
+}
+
+func isBeancountAccount(field string) bool {
+	return strings.Contains(field, ":") && len(field) > 0 && field[0] >= 'A' && field[0] <= 'Z'
+}
+
+// Read the directives of a beancount file needed for the bank, other directives are ignored
+func readBeancountDirectives(r io.Reader) ([]*beancountDirective, error) {
+	directives := []*beancountDirective{}
+	var current *beancountDirective
+
+	scanner := bufio.NewScanner(r)
+	number := 0
+
+	for scanner.Scan() {
+		number++
+		line := scanner.Text()
+
+		fields, err := beancountFields(line)
+		if err != nil {
+			return directives, fmt.Errorf("line %d: %v", number, err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		indented := line[0] == ' ' || line[0] == '\t'
+		if !indented {
+			current = nil
+
+			date, err := time.Parse("2006-01-02", fields[0])
+			if err != nil || len(fields) < 2 {
+				continue // option, plugin, include and such
+			}
+
+			switch fields[1] {
+			case "open":
+				if len(fields) < 3 {
+					return directives, fmt.Errorf("line %d: open without account", number)
+				}
+				current = &beancountDirective{Line: number, Date: date, Kind: "open", Account: fields[2], Meta: map[string]string{}}
+			case "*", "!", "txn":
+				current = &beancountDirective{Line: number, Date: date, Kind: "txn", Meta: map[string]string{}}
+				texts := []string{}
+				for _, field := range fields[2:] {
+					if isBeancountString(field) {
+						texts = append(texts, beancountValue(field))
+					}
+				}
+				if len(texts) == 1 {
+					current.Narration = texts[0]
+				} else if len(texts) > 1 {
+					current.Payee = texts[0]
+					current.Narration = texts[1]
+				}
+			default:
+				continue // balance, close, price and such
+			}
+
+			directives = append(directives, current)
+			continue
+		}
+
+		if current == nil {
+			continue
+		}
+
+		if strings.HasSuffix(fields[0], ":") && !isBeancountAccount(fields[0]) {
+			// metadata, posting metadata is attached to the transaction as well
+			key := strings.TrimSuffix(fields[0], ":")
+			if _, ok := current.Meta[key]; !ok && len(fields) > 1 {
+				current.Meta[key] = beancountValue(fields[1])
+			}
+			continue
+		}
+
+		if current.Kind != "txn" {
+			continue
+		}
+
+		if fields[0] == "*" || fields[0] == "!" {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 || !isBeancountAccount(fields[0]) {
+			return directives, fmt.Errorf("line %d: invalid posting", number)
+		}
+
+		posting := beancountPosting{Account: fields[0], Missing: true}
+		if len(fields) > 1 {
+			posting.Amount, err = ParseAmount(fields[1], ".")
+			if err != nil {
+				return directives, fmt.Errorf("line %d: %v", number, err)
+			}
+			posting.Missing = false
+		}
+		current.Postings = append(current.Postings, posting)
+	}
+
+	return directives, scanner.Err()
+}
+
+// Read a beancount journal into accounts, targets and transactions.
+// Expenses and Income accounts are targets, all other accounts are bank accounts.
+// Only transactions with two postings can be represented in the bank.
+func ReadBeancount(r io.Reader) (ImportedBook, error) {
+	book := ImportedBook{Accounts: []domain.Account{}, Targets: []domain.Target{}, Entries: []BookEntry{}}
+
+	directives, err := readBeancountDirectives(r)
+	if err != nil {
+		return book, err
+	}
+
+	opens := map[string]*beancountDirective{}
+	for _, directive := range directives {
+		if directive.Kind == "open" {
+			opens[directive.Account] = directive
+		}
+	}
+
+	isTarget := func(name string) bool {
+		return strings.HasPrefix(name, BookExpenses+":") || strings.HasPrefix(name, BookIncome+":")
+	}
+
+	// bank identification of a beancount account, the account number or the target name
+	identification := func(name string) string {
+		if open, ok := opens[name]; ok {
+			if value, ok := open.Meta["number"]; ok && !isTarget(name) {
+				return value
+			}
+			if value, ok := open.Meta["name"]; ok && isTarget(name) {
+				return value
+			}
+		}
+		if isTarget(name) {
+			_, rest, _ := strings.Cut(name, ":")
+			return rest
+		}
+		return strings.TrimPrefix(name, BookAccounts+":")
+	}
+
+	seenAccounts := map[string]bool{}
+	seenTargets := map[string]bool{}
+
+	for _, directive := range directives {
+		if directive.Kind != "open" {
+			continue
+		}
+		id := identification(directive.Account)
+		if isTarget(directive.Account) {
+			if !seenTargets[id] {
+				seenTargets[id] = true
+				book.Targets = append(book.Targets, domain.Target{Name: id, Description: directive.Meta["description"]})
+			}
+		} else if !seenAccounts[id] {
+			seenAccounts[id] = true
+			book.Accounts = append(book.Accounts, domain.Account{Number: id, Description: directive.Meta["description"]})
+		}
+	}
+
+	for _, directive := range directives {
+		if directive.Kind != "txn" {
+			continue
+		}
+
+		if len(directive.Postings) != 2 {
+			return book, fmt.Errorf("line %d: only transactions with two postings are supported", directive.Line)
+		}
+		first, second := directive.Postings[0], directive.Postings[1]
+		if first.Missing && second.Missing {
+			return book, fmt.Errorf("line %d: amount missing", directive.Line)
+		}
+		if first.Missing {
+			first.Amount = -second.Amount
+		}
+		if second.Missing {
+			second.Amount = -first.Amount
+		}
+		if first.Amount > 0 {
+			first, second = second, first
+		}
+
+		counterparty := directive.Payee
+		if len(counterparty) == 0 {
+			counterparty = BookUnknown
+		}
+
+		entry := BookEntry{Target: BookUnknown}
+		entry.Transaction.SetDate(directive.Date)
+		entry.Transaction.SetDescription(directive.Narration)
+		entry.Transaction.SetAmount(second.Amount)
+
+		switch {
+		case isTarget(first.Account) && isTarget(second.Account):
+			return book, fmt.Errorf("line %d: transaction between two expense or income accounts", directive.Line)
+		case isTarget(first.Account):
+			entry.From = counterparty
+			entry.To = identification(second.Account)
+			entry.Target = identification(first.Account)
+		case isTarget(second.Account):
+			entry.From = identification(first.Account)
+			entry.To = counterparty
+			entry.Target = identification(second.Account)
+		default:
+			entry.From = identification(first.Account)
+			entry.To = identification(second.Account)
+		}
+
+		// metadata of a journal exported by the bank is exact
+		if value, ok := directive.Meta["from"]; ok {
+			entry.From = value
+		}
+		if value, ok := directive.Meta["to"]; ok {
+			entry.To = value
+		}
+		if value, ok := directive.Meta["target"]; ok {
+			entry.Target = value
+		}
+		if value, ok := directive.Meta["id"]; ok {
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return book, fmt.Errorf("line %d: invalid id %s", directive.Line, value)
+			}
+			entry.Transaction.SetId(id)
+		}
+
+		book.Entries = append(book.Entries, entry)
+	}
+
+	return book, nil
+}
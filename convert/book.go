@@ -0,0 +1,198 @@
+package convert
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/bank/domain"
+)
+
+// Root names of plain text accounting accounts
+const (
+	BookAccounts = "Assets:Accounts"
+	BookExpenses = "Expenses"
+	BookIncome   = "Income"
+)
+
+// The complete book of the bank.
+// Own contains the ids of accounts owned by the book keeper. Money leaving an own account
+// to another account is booked on the expense account of the target, money arriving
+// on the income account of the target. Without own accounts the accounts that both pay and
+// receive are taken as own ones, or when there are none the accounts that pay.
+// Currency is the ISO 4217 code of all amounts, the bank model has no currency.
+type Book struct {
+	Accounts     []domain.Account
+	Targets      []domain.Target
+	Transactions []domain.Transaction
+	Own          map[int64]bool
+	Currency     string
+}
+
+// A posting of a transaction on a plain text account
+type bookPosting struct {
+	Account string
+	Amount  int64
+}
+
+// The accounts and targets of a book by id with their plain text account names
+type bookIndex struct {
+	accounts     map[int64]domain.Account
+	targets      map[int64]domain.Target
+	accountNames map[int64]string // full account name
+	targetNames  map[int64]string // component below Expenses and Income
+	own          map[int64]bool
+}
+
+// Turn a name into a valid account name component: letters, digits and dashes,
+// starting with an uppercase letter or digit
+func bookComponent(name string) string {
+	var builder strings.Builder
+
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' {
+			builder.WriteRune(r)
+		} else {
+			builder.WriteRune('-')
+		}
+	}
+
+	component := []rune(strings.Trim(builder.String(), "-"))
+	if len(component) == 0 {
+		return "Unknown"
+	}
+	if !unicode.IsDigit(component[0]) {
+		if !unicode.IsLetter(component[0]) {
+			return "X" + string(component)
+		}
+		component[0] = unicode.ToUpper(component[0])
+	}
+	return string(component)
+}
+
+// Name not taken yet, numbers or names that only differ in characters that are not allowed
+// ("NL01 X" and "NL01-X") get a suffix
+func bookUnique(taken map[string]bool, name string) string {
+	unique := name
+	for n := 2; taken[unique]; n++ {
+		unique = name + "-" + strconv.Itoa(n)
+	}
+	taken[unique] = true
+	return unique
+}
+
+// The own accounts, those given or those derived from the transactions
+func (book *Book) ownAccounts() map[int64]bool {
+	if len(book.Own) > 0 {
+		return book.Own
+	}
+
+	pays := map[int64]bool{}
+	receives := map[int64]bool{}
+	for _, transaction := range book.Transactions {
+		pays[transaction.From_account] = true
+		receives[transaction.To_account] = true
+	}
+
+	own := map[int64]bool{}
+	for id := range pays {
+		if receives[id] {
+			own[id] = true
+		}
+	}
+	if len(own) == 0 {
+		return pays
+	}
+	return own
+}
+
+// Index the book, the names are given in order of id so they stay the same in a next export
+func (book *Book) index() bookIndex {
+	index := bookIndex{accounts: map[int64]domain.Account{}, targets: map[int64]domain.Target{},
+		accountNames: map[int64]string{}, targetNames: map[int64]string{}, own: book.ownAccounts()}
+
+	accounts := make([]domain.Account, len(book.Accounts))
+	copy(accounts, book.Accounts)
+	sort.SliceStable(accounts, func(i, j int) bool { return accounts[i].Id < accounts[j].Id })
+
+	taken := map[string]bool{}
+	for _, account := range accounts {
+		if _, ok := index.accounts[account.Id]; ok {
+			continue
+		}
+		index.accounts[account.Id] = account
+		index.accountNames[account.Id] = bookUnique(taken, BookAccounts+":"+bookComponent(account.Number))
+	}
+
+	targets := make([]domain.Target, len(book.Targets))
+	copy(targets, book.Targets)
+	sort.SliceStable(targets, func(i, j int) bool { return targets[i].Id < targets[j].Id })
+
+	taken = map[string]bool{}
+	for _, target := range targets {
+		if _, ok := index.targets[target.Id]; ok {
+			continue
+		}
+		index.targets[target.Id] = target
+		index.targetNames[target.Id] = bookUnique(taken, bookComponent(target.Name))
+	}
+
+	return index
+}
+
+// The accounts in order of id
+func (index bookIndex) sortedAccounts() []domain.Account {
+	accounts := []domain.Account{}
+	for _, account := range index.accounts {
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Id < accounts[j].Id })
+	return accounts
+}
+
+// The targets in order of id
+func (index bookIndex) sortedTargets() []domain.Target {
+	targets := []domain.Target{}
+	for _, target := range index.targets {
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Id < targets[j].Id })
+	return targets
+}
+
+// Postings of a transaction, the first posting always has the negative amount
+func (index bookIndex) postings(transaction domain.Transaction) []bookPosting {
+	from := index.accountNames[transaction.From_account]
+	to := index.accountNames[transaction.To_account]
+	target := index.targetNames[transaction.Target]
+
+	fromOwn := index.own[transaction.From_account]
+	toOwn := index.own[transaction.To_account]
+
+	if fromOwn && !toOwn {
+		to = BookExpenses + ":" + target
+	} else if !fromOwn && toOwn {
+		from = BookIncome + ":" + target
+	}
+
+	return []bookPosting{
+		{Account: from, Amount: -transaction.Amount},
+		{Account: to, Amount: transaction.Amount},
+	}
+}
+
+// Transactions ordered by date, as journals require
+func (book *Book) sortedTransactions() []domain.Transaction {
+	transactions := make([]domain.Transaction, len(book.Transactions))
+	copy(transactions, book.Transactions)
+
+	sort.SliceStable(transactions, func(i, j int) bool {
+		if transactions[i].Date.Equal(transactions[j].Date) {
+			return transactions[i].Id < transactions[j].Id
+		}
+		return transactions[i].Date.Before(transactions[j].Date)
+	})
+
+	return transactions
+}
@@ -0,0 +1,112 @@
+package convert
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bank/domain"
+)
+
+// go test ./convert -update writes the golden files again
+var update = flag.Bool("update", false, "update the golden files")
+
+// Compare output with the golden file of name in testdata
+func golden(t *testing.T, name string, output []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+
+	if *update {
+		if err := os.WriteFile(path, output, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output, want) {
+		t.Errorf("%s differs, got:\n%s", name, output)
+	}
+}
+
+func day(date string) time.Time {
+	value, _ := time.Parse("2006-01-02", date)
+	return value
+}
+
+// A checking account that pays and receives, a shop, an employer and two accounts of which the numbers
+// only differ in a character not allowed in an account name
+func testBook() Book {
+	return Book{
+		Accounts: []domain.Account{
+			{Id: 5, Number: "NL01-X", Description: "x with a dash"},
+			{Id: 1, Number: "NL01BANK0001", Description: "checking"},
+			{Id: 2, Number: "NL02SHOP0002", Description: "shop"},
+			{Id: 3, Number: "NL03WORK0003", Description: "employer"},
+			{Id: 4, Number: "NL01 X", Description: "x with a space"},
+		},
+		Targets: []domain.Target{
+			{Id: 1, Name: "groceries", Description: "food"},
+			{Id: 2, Name: "salary"},
+			{Id: 3, Name: "holiday", Description: "not used"},
+		},
+		Transactions: []domain.Transaction{
+			{Id: 2, From_account: 3, To_account: 1, Target: 2, Amount: 250000, Description: "salary march", Date: day("2024-03-25")},
+			{Id: 1, From_account: 1, To_account: 2, Target: 1, Amount: 1250, Description: "weekly shopping", Date: day("2024-03-02")},
+			{Id: 3, From_account: 1, To_account: 4, Target: 1, Amount: 500, Description: "to x with a space", Date: day("2024-03-05")},
+			{Id: 4, From_account: 5, To_account: 1, Target: 1, Amount: 100, Description: "from x with a dash", Date: day("2024-03-06")},
+		},
+		Currency: "EUR",
+	}
+}
+
+func TestWriteLedger(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := WriteLedger(&buffer, testBook()); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "book.ledger", buffer.Bytes())
+}
+
+func TestWriteBeancount(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := WriteBeancount(&buffer, testBook()); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "book.beancount", buffer.Bytes())
+
+	// the journal is read again with the identifications of the bank
+	imported, err := ReadBeancount(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported.Accounts) != 5 || len(imported.Targets) != 3 || len(imported.Entries) != 4 {
+		t.Fatalf("got %+v, want all accounts, targets and transactions", imported)
+	}
+	entry := imported.Entries[1]
+	if entry.From != "NL01BANK0001" || entry.To != "NL01 X" || entry.Target != "groceries" || entry.Transaction.Amount != 500 {
+		t.Errorf("got %+v, want the transaction to x with a space", entry)
+	}
+}
+
+func TestBookOwnAccounts(t *testing.T) {
+	book := testBook()
+	if own := book.ownAccounts(); len(own) != 1 || !own[1] {
+		t.Errorf("got %v, want the account that pays and receives", own)
+	}
+
+	book.Own = map[int64]bool{3: true}
+	if own := book.ownAccounts(); len(own) != 1 || !own[3] {
+		t.Errorf("got %v, want the given account", own)
+	}
+
+	// nobody pays and receives, those paying are own
+	book = Book{Transactions: []domain.Transaction{{From_account: 1, To_account: 2}, {From_account: 3, To_account: 4}}}
+	if own := book.ownAccounts(); len(own) != 2 || !own[1] || !own[3] {
+		t.Errorf("got %v, want the accounts that pay", own)
+	}
+}
@@ -0,0 +1,187 @@
+package convert
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bank/domain"
+	log "github.com/sirupsen/logrus"
+)
+
+// One line of a bank csv file seen from the account the file belongs to.
+// A negative amount leaves that account, a positive amount arrives.
+type CsvLine struct {
+	Line         int       `json:"line"`
+	Date         time.Time `json:"date"`
+	Amount       int64     `json:"amount"`
+	Counterparty string    `json:"counterparty"`
+	Description  string    `json:"description"`
+}
+
+// Read all lines of a csv file using the column mapping of profile
+func ReadCsv(r io.Reader, profile domain.CsvProfile) ([]CsvLine, error) {
+	lines := []CsvLine{}
+
+	reader := csv.NewReader(r)
+	reader.Comma = []rune(profile.Delimiter)[0]
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Read csv - parse error")
+		return lines, err
+	}
+
+	for index, record := range records {
+		if index == 0 && profile.Header {
+			continue
+		}
+
+		line, err := readCsvRecord(record, index+1, profile)
+		if err != nil {
+			return lines, err
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, nil
+}
+
+func readCsvRecord(record []string, number int, profile domain.CsvProfile) (CsvLine, error) {
+	line := CsvLine{Line: number}
+
+	column := func(index int) (string, error) {
+		if index >= len(record) {
+			return "", fmt.Errorf("line %d: column %d missing", number, index)
+		}
+		return strings.TrimSpace(record[index]), nil
+	}
+
+	value, err := column(profile.DateColumn)
+	if err != nil {
+		return line, err
+	}
+	line.Date, err = time.Parse(profile.DateFormat, value)
+	if err != nil {
+		return line, fmt.Errorf("line %d: invalid date %s", number, value)
+	}
+
+	value, err = column(profile.AmountColumn)
+	if err != nil {
+		return line, err
+	}
+	line.Amount, err = ParseAmount(value, profile.DecimalSeparator)
+	if err != nil {
+		return line, fmt.Errorf("line %d: %v", number, err)
+	}
+
+	switch profile.SignConvention {
+	case domain.SignPlusIsDebit:
+		line.Amount = -line.Amount
+	case domain.SignIndicator:
+		value, err = column(profile.IndicatorColumn)
+		if err != nil {
+			return line, err
+		}
+		if line.Amount < 0 {
+			line.Amount = -line.Amount
+		}
+		if strings.EqualFold(value, profile.DebitIndicator) {
+			line.Amount = -line.Amount
+		}
+	}
+
+	line.Counterparty, err = column(profile.CounterpartyColumn)
+	if err != nil {
+		return line, err
+	}
+
+	line.Description, err = column(profile.DescriptionColumn)
+	if err != nil {
+		return line, err
+	}
+
+	return line, nil
+}
+
+// Parse a decimal amount like "-1.234,56" into cents
+func ParseAmount(value string, decimalSeparator string) (int64, error) {
+	var thousandSeparator = ","
+	if decimalSeparator == "," {
+		thousandSeparator = "."
+	}
+
+	value = strings.ReplaceAll(strings.TrimSpace(value), thousandSeparator, "")
+	value = strings.ReplaceAll(value, " ", "")
+
+	negative := false
+	if strings.HasPrefix(value, "-") {
+		negative = true
+		value = value[1:]
+	} else if strings.HasPrefix(value, "+") {
+		value = value[1:]
+	}
+
+	units, fraction, _ := strings.Cut(value, decimalSeparator)
+	if len(fraction) > 2 {
+		return 0, fmt.Errorf("invalid amount %s, more than 2 decimals", value)
+	}
+	fraction = fraction + strings.Repeat("0", 2-len(fraction))
+	if len(units) == 0 {
+		units = "0"
+	}
+
+	cents, err := strconv.ParseInt(units+fraction, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %s", value)
+	}
+
+	if negative {
+		cents = -cents
+	}
+	return cents, nil
+}
+
+// Format cents as a decimal amount like "-1234,56"
+func FormatAmount(cents int64, decimalSeparator string) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d%s%02d", sign, cents/100, decimalSeparator, cents%100)
+}
+
+// Write transactions as csv, accounts and targets are used to show numbers and names instead of ids
+func WriteCsv(w io.Writer, transactions []domain.Transaction, accounts map[int64]domain.Account, targets map[int64]domain.Target, delimiter rune, decimalSeparator string) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = delimiter
+
+	err := writer.Write([]string{"id", "date", "from", "to", "target", "amount", "description"})
+	if err != nil {
+		return err
+	}
+
+	for _, transaction := range transactions {
+		err = writer.Write([]string{
+			strconv.FormatInt(transaction.Id, 10),
+			transaction.Date.Format("2006-01-02"),
+			accounts[transaction.From_account].Number,
+			accounts[transaction.To_account].Number,
+			targets[transaction.Target].Name,
+			FormatAmount(transaction.Amount, decimalSeparator),
+			transaction.Description,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
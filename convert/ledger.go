@@ -0,0 +1,52 @@
+package convert
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func ledgerValue(value string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(value, "\r", ""), "\n", " ")
+}
+
+// Write the book as ledger-cli journal.
+// The bank identifications are kept as metadata comments.
+func WriteLedger(w io.Writer, book Book) error {
+	writer := bufio.NewWriter(w)
+	index := book.index()
+
+	for _, account := range index.sortedAccounts() {
+		fmt.Fprintf(writer, "account %s\n", index.accountNames[account.Id])
+		fmt.Fprintf(writer, "    ; number: %s\n", ledgerValue(account.Number))
+		if len(account.Description) > 0 {
+			fmt.Fprintf(writer, "    note %s\n", ledgerValue(account.Description))
+		}
+	}
+
+	for _, target := range index.sortedTargets() {
+		for _, root := range []string{BookExpenses, BookIncome} {
+			fmt.Fprintf(writer, "account %s:%s\n", root, index.targetNames[target.Id])
+			fmt.Fprintf(writer, "    ; name: %s\n", ledgerValue(target.Name))
+			if len(target.Description) > 0 {
+				fmt.Fprintf(writer, "    note %s\n", ledgerValue(target.Description))
+			}
+		}
+	}
+
+	for _, transaction := range book.sortedTransactions() {
+		fmt.Fprintln(writer)
+		fmt.Fprintf(writer, "%s * %s\n", transaction.Date.Format("2006/01/02"), ledgerValue(transaction.Description))
+		fmt.Fprintf(writer, "    ; id: %d\n", transaction.Id)
+		fmt.Fprintf(writer, "    ; from: %s\n", ledgerValue(index.accounts[transaction.From_account].Number))
+		fmt.Fprintf(writer, "    ; to: %s\n", ledgerValue(index.accounts[transaction.To_account].Number))
+		fmt.Fprintf(writer, "    ; target: %s\n", ledgerValue(index.targets[transaction.Target].Name))
+
+		for _, posting := range index.postings(transaction) {
+			fmt.Fprintf(writer, "    %-50s %12s %s\n", posting.Account, FormatAmount(posting.Amount, "."), book.Currency)
+		}
+	}
+
+	return writer.Flush()
+}
@@ -0,0 +1,144 @@
+package convert
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/bank/domain"
+)
+
+// The bank of an OFX statement and the currency of its amounts, the bank model has neither
+type OfxBank struct {
+	Id       string // BANKID, the routing number or other identification of the bank
+	Currency string // CURDEF, ISO 4217 code of the amounts
+}
+
+// The time of the statement, replaced by the tests
+var now = time.Now
+
+const ofxHeader = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="211" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+`
+
+type ofxDocument struct {
+	XMLName xml.Name     `xml:"OFX"`
+	Signon  ofxSignon    `xml:"SIGNONMSGSRSV1>SONRS"`
+	Bank    ofxStatement `xml:"BANKMSGSRSV1>STMTTRNRS"`
+}
+
+type ofxStatus struct {
+	Code     int    `xml:"CODE"`
+	Severity string `xml:"SEVERITY"`
+}
+
+type ofxSignon struct {
+	Status   ofxStatus `xml:"STATUS"`
+	Server   string    `xml:"DTSERVER"`
+	Language string    `xml:"LANGUAGE"`
+}
+
+type ofxStatement struct {
+	Uid          string           `xml:"TRNUID"`
+	Status       ofxStatus        `xml:"STATUS"`
+	Currency     string           `xml:"STMTRS>CURDEF"`
+	BankId       string           `xml:"STMTRS>BANKACCTFROM>BANKID"`
+	AccountId    string           `xml:"STMTRS>BANKACCTFROM>ACCTID"`
+	AccountType  string           `xml:"STMTRS>BANKACCTFROM>ACCTTYPE"`
+	Start        string           `xml:"STMTRS>BANKTRANLIST>DTSTART"`
+	End          string           `xml:"STMTRS>BANKTRANLIST>DTEND"`
+	Transactions []ofxTransaction `xml:"STMTRS>BANKTRANLIST>STMTTRN"`
+	Balance      ofxLedgerBalance `xml:"STMTRS>LEDGERBAL"`
+}
+
+type ofxTransaction struct {
+	Type   string `xml:"TRNTYPE"`
+	Posted string `xml:"DTPOSTED"`
+	Amount string `xml:"TRNAMT"`
+	Id     string `xml:"FITID"`
+	Name   string `xml:"NAME,omitempty"`
+	Memo   string `xml:"MEMO,omitempty"`
+}
+
+type ofxLedgerBalance struct {
+	Amount string `xml:"BALAMT"`
+	AsOf   string `xml:"DTASOF"`
+}
+
+func ofxDate(date time.Time) string {
+	return date.Format("20060102")
+}
+
+// Write the transactions of account as OFX 2.x bank statement.
+// OFX has no category, the target name is put in front of the memo.
+// Balance is the balance of the account at the end of the statement.
+func WriteOfx(w io.Writer, bank OfxBank, account domain.Account, transactions []domain.Transaction, accounts map[int64]domain.Account, targets map[int64]domain.Target, from time.Time, to time.Time, balance int64) error {
+	now := now()
+
+	if to.IsZero() {
+		to = now
+	}
+	if from.IsZero() && len(transactions) > 0 {
+		from = transactions[0].Date
+	}
+
+	document := ofxDocument{
+		Signon: ofxSignon{
+			Status:   ofxStatus{Code: 0, Severity: "INFO"},
+			Server:   now.Format("20060102150405"),
+			Language: "ENG",
+		},
+		Bank: ofxStatement{
+			Uid:          "0",
+			Status:       ofxStatus{Code: 0, Severity: "INFO"},
+			Currency:     bank.Currency,
+			BankId:       bank.Id,
+			AccountId:    account.Number,
+			AccountType:  "CHECKING",
+			Start:        ofxDate(from),
+			End:          ofxDate(to),
+			Transactions: []ofxTransaction{},
+			Balance: ofxLedgerBalance{
+				Amount: FormatAmount(balance, "."),
+				AsOf:   ofxDate(to),
+			},
+		},
+	}
+
+	for _, transaction := range transactions {
+		amount := transaction.SignedAmount(account.Id)
+
+		trntype := "CREDIT"
+		if amount < 0 {
+			trntype = "DEBIT"
+		}
+
+		memo := transaction.Description
+		if target, ok := targets[transaction.Target]; ok {
+			memo = target.Name + ": " + memo
+		}
+
+		document.Bank.Transactions = append(document.Bank.Transactions, ofxTransaction{
+			Type:   trntype,
+			Posted: ofxDate(transaction.Date),
+			Amount: FormatAmount(amount, "."),
+			Id:     strconv.FormatInt(transaction.Id, 10),
+			Name:   accounts[transaction.Counterparty(account.Id)].Number,
+			Memo:   memo,
+		})
+	}
+
+	if _, err := io.WriteString(w, ofxHeader); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
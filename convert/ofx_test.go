@@ -0,0 +1,57 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bank/domain"
+)
+
+// The transactions of the checking account of testBook by date, with the accounts and targets by id
+func testStatement() (domain.Account, []domain.Transaction, map[int64]domain.Account, map[int64]domain.Target) {
+	book := testBook()
+	accounts := map[int64]domain.Account{}
+	for _, account := range book.Accounts {
+		accounts[account.Id] = account
+	}
+	targets := map[int64]domain.Target{}
+	for _, target := range book.Targets {
+		targets[target.Id] = target
+	}
+	transactions := []domain.Transaction{}
+	for _, id := range []int64{1, 3, 4, 2} {
+		for _, transaction := range book.Transactions {
+			if transaction.Id == id {
+				transactions = append(transactions, transaction)
+			}
+		}
+	}
+	return accounts[1], transactions, accounts, targets
+}
+
+func TestWriteOfx(t *testing.T) {
+	current := now
+	t.Cleanup(func() { now = current })
+	now = func() time.Time { return time.Date(2024, 4, 2, 10, 30, 0, 0, time.UTC) }
+
+	account, transactions, accounts, targets := testStatement()
+	var buffer bytes.Buffer
+	err := WriteOfx(&buffer, OfxBank{Id: "INGBNL2A", Currency: "USD"}, account, transactions, accounts, targets,
+		day("2024-03-01"), day("2024-03-31"), 248350)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "statement.ofx", buffer.Bytes())
+
+	// the statement is well formed xml with the bank and currency that are given
+	var document ofxDocument
+	if err := xml.NewDecoder(strings.NewReader(strings.TrimPrefix(buffer.String(), ofxHeader))).Decode(&document); err != nil {
+		t.Fatal(err)
+	}
+	if document.Bank.BankId != "INGBNL2A" || document.Bank.Currency != "USD" || len(document.Bank.Transactions) != 4 {
+		t.Errorf("got %+v, want the statement of bank INGBNL2A in USD", document.Bank)
+	}
+}
@@ -0,0 +1,41 @@
+package convert
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bank/domain"
+)
+
+// QIF fields are line based, a value can not contain a newline
+func qifValue(value string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(value, "\r", ""), "\n", " ")
+}
+
+// Write the transactions of account as QIF bank register, with the target name as category
+func WriteQif(w io.Writer, account domain.Account, transactions []domain.Transaction, accounts map[int64]domain.Account, targets map[int64]domain.Target) error {
+	writer := bufio.NewWriter(w)
+
+	fmt.Fprintln(writer, "!Account")
+	fmt.Fprintf(writer, "N%s\n", qifValue(account.Number))
+	fmt.Fprintf(writer, "D%s\n", qifValue(account.Description))
+	fmt.Fprintln(writer, "TBank")
+	fmt.Fprintln(writer, "^")
+	fmt.Fprintln(writer, "!Type:Bank")
+
+	for _, transaction := range transactions {
+		fmt.Fprintf(writer, "D%s\n", transaction.Date.Format("01/02/2006"))
+		fmt.Fprintf(writer, "T%s\n", FormatAmount(transaction.SignedAmount(account.Id), "."))
+		fmt.Fprintf(writer, "N%d\n", transaction.Id)
+		fmt.Fprintf(writer, "P%s\n", qifValue(accounts[transaction.Counterparty(account.Id)].Number))
+		fmt.Fprintf(writer, "M%s\n", qifValue(transaction.Description))
+		if target, ok := targets[transaction.Target]; ok {
+			fmt.Fprintf(writer, "L%s\n", qifValue(target.Name))
+		}
+		fmt.Fprintln(writer, "^")
+	}
+
+	return writer.Flush()
+}
@@ -0,0 +1,18 @@
+package convert
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteQif(t *testing.T) {
+	account, transactions, accounts, targets := testStatement()
+	// a value is on one line
+	transactions[0].Description = "weekly\r\nshopping"
+
+	var buffer bytes.Buffer
+	if err := WriteQif(&buffer, account, transactions, accounts, targets); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "statement.qif", buffer.Bytes())
+}
@@ -2,26 +2,44 @@ package domain
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v4"
-	"github.com/jackc/pgx/v4/pgxpool"
 	log "github.com/sirupsen/logrus"
 )
 
 type Account struct {
-	Id          int64  `json:"id"`
-	Number      string `json:"number"`
-	Description string `json:"description"`
+	Id          int64      `json:"id"`
+	Number      string     `json:"number"`
+	Description string     `json:"description"`
+	Deleted     *time.Time `json:"deleted,omitempty"`
 }
 
+// An account found by search, with its rank and the number and description with the matching words marked
+type AccountMatch struct {
+	Account
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// Searched text of an account, equal to the expression of the search indexes
+const accountDocument = "number || ' ' || coalesce(description, '')"
+
 type IAccount interface {
-	DeleteById(dbpool *pgxpool.Pool, id string) error
-	Read(dbpool *pgxpool.Pool, number string, limit int64) ([]Account, error)
-	ReadById(dbpool *pgxpool.Pool) (Account, error)
-	Search(dbpool *pgxpool.Pool, search string, limit int64) ([]Account, error)
-	Update(dbpool *pgxpool.Pool) (int64, error)
-	Write(dbpool *pgxpool.Pool) (int64, error)
+	Balances(ctx context.Context, dbpool Db, ids []int64) (map[int64]int64, error)
+	DeleteById(ctx context.Context, dbpool Db, id string) error
+	Purge(ctx context.Context, dbpool Db, before time.Time) ([]Account, error)
+	Read(ctx context.Context, dbpool Db, number string, page *Page, includeDeleted bool) ([]Account, error)
+	ReadById(ctx context.Context, dbpool Db, id string, includeDeleted bool) (Account, error)
+	ReadByIds(ctx context.Context, dbpool Db, ids []int64) (map[int64]Account, error)
+	ReadByNumber(ctx context.Context, dbpool Db, number string, includeDeleted bool) (Account, error)
+	ReadForUpdate(ctx context.Context, dbpool Db, id string) (Account, error)
+	Restore(ctx context.Context, dbpool Db, id string) error
+	Search(ctx context.Context, dbpool Db, term string, config string, page *Page, includeDeleted bool) ([]AccountMatch, error)
+	Update(ctx context.Context, dbpool Db) (int64, error)
+	Write(ctx context.Context, dbpool Db) (int64, error)
 	GetDescription() string
 	GetId() int64
 	GetNumber() string
@@ -31,50 +49,112 @@ type IAccount interface {
 	SetNumberDescription(number string, description string)
 }
 
-func (account *Account) DeleteById(dbpool *pgxpool.Pool, id string) error {
+// Balance in cents of the accounts with the ids, the sum of all their transactions.
+// Accounts without transactions have balance 0.
+func (account *Account) Balances(ctx context.Context, dbpool Db, ids []int64) (map[int64]int64, error) {
+	balances := map[int64]int64{}
+	for _, id := range ids {
+		balances[id] = 0
+	}
+
+	rows, err := dbpool.Query(ctx,
+		"SELECT account, coalesce(sum(amount), 0) from ("+
+			"SELECT to_account as account, amount from transaction where to_account = any($1) union all "+
+			"SELECT from_account as account, -amount from transaction where from_account = any($1)"+
+			") as mutation group by account", ids)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Balance of accounts - reading result error")
+		return balances, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, balance int64
+
+		if err = rows.Scan(&id, &balance); err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Balance of accounts - reading result error")
+			return balances, err
+		}
+		balances[id] = balance
+	}
+	return balances, rows.Err()
+}
+
+// Mark the account deleted, it is kept until it is purged and can be restored until then
+func (account *Account) DeleteById(ctx context.Context, dbpool Db, id string) error {
 	var acc Account
 	var err error
 
-	// check if account exists
-	rows := dbpool.QueryRow(context.Background(), "SELECT * from account where id = $1", id)
+	// check if account exists and is not deleted already
+	rows := dbpool.QueryRow(ctx, "SELECT * from account where id = $1 and deleted is null", id)
 
-	err = rows.Scan(&acc.Id, &acc.Number, &acc.Description)
+	err = rows.Scan(&acc.Id, &acc.Number, &acc.Description, &acc.Deleted)
 
 	if err == nil {
-		_, err = dbpool.Exec(context.Background(), "DELETE from account where id = $1", id)
+		_, err = dbpool.Exec(ctx, "UPDATE account set deleted = now() where id = $1", id)
 		log.WithFields(log.Fields{"error": err}).Trace("Delete account")
 	}
-	return err
+	return dbErr(err)
+}
+
+// Remove accounts deleted before a moment, accounts still used by transactions or reconciliations are kept
+func (account *Account) Purge(ctx context.Context, dbpool Db, before time.Time) ([]Account, error) {
+	accounts := []Account{}
+
+	rows, err := dbpool.Query(ctx,
+		`DELETE from account a where a.deleted < $1
+		and not exists (SELECT 1 from transaction t where t.from_account = a.id or t.to_account = a.id)
+		and not exists (SELECT 1 from reconciliation r where r.account = a.id)
+		RETURNING *`, before)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Purge account - delete error")
+		return accounts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		acc := Account{}
+		err = rows.Scan(&acc.Id, &acc.Number, &acc.Description, &acc.Deleted)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Purge account - reading result error")
+			return accounts, err
+		}
+		accounts = append(accounts, acc)
+	}
+	return accounts, rows.Err()
 }
 
-func (account *Account) Read(dbpool *pgxpool.Pool, number string, limit int64) ([]Account, error) {
+// Read accounts, deleted accounts are only included on request
+func (account *Account) Read(ctx context.Context, dbpool Db, number string, page *Page, includeDeleted bool) ([]Account, error) {
 	var rows pgx.Rows
 	var err error
-	var query string = "SELECT * from account"
-	var orderby string = " order by id desc"
-	var where string = " where number='" + number + "'"
 
 	accounts := []Account{}
+	query := selectFrom("account")
 
 	if len(number) > 0 {
-		query = query + where
+		query.where("number = ?", number)
+	}
+	if !includeDeleted {
+		query.where("deleted is null")
 	}
 
-	query = query + orderby
+	if err = page.count(ctx, dbpool, query); err != nil {
+		return accounts, err
+	}
 
-	if limit > 0 {
-		query = query + " limit $1"
-		rows, err = dbpool.Query(context.Background(), query, limit)
-	} else {
-		rows, err = dbpool.Query(context.Background(), query)
+	if query, err = page.apply(query, nil); err != nil {
+		return accounts, err
 	}
+	rows, err = query.rows(ctx, dbpool)
 
 	if err == nil {
+		defer rows.Close()
 		var index = 0
 
 		for rows.Next() {
 			account := Account{}
-			err := rows.Scan(&account.Id, &account.Number, &account.Description)
+			err := rows.Scan(&account.Id, &account.Number, &account.Description, &account.Deleted)
 
 			if err == nil {
 				accounts = append(accounts, account)
@@ -84,80 +164,139 @@ func (account *Account) Read(dbpool *pgxpool.Pool, number string, limit int64) (
 				return accounts, err
 			}
 		}
-		return accounts, nil
+		if err := rows.Err(); err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Read account - reading result error")
+			return accounts, err
+		}
+		return pageRows(page, accounts, func(account Account) int64 { return account.Id }), nil
 	} else {
-		if err.Error() != "no rows in result set" { // nothing found functional error
+		if !errors.Is(err, pgx.ErrNoRows) { // nothing found functional error
 			log.WithFields(log.Fields{"error": err}).Error("Read account - reading result error")
 		}
 		return accounts, err
 	}
 }
 
-func (account *Account) ReadById(dbpool *pgxpool.Pool, id string) (Account, error) {
+// Read the account with the id, a deleted account is only read on request
+func (account *Account) ReadById(ctx context.Context, dbpool Db, id string, includeDeleted bool) (Account, error) {
 	var acc Account
 
-	rows := dbpool.QueryRow(context.Background(), "SELECT * from account where id = $1", id)
+	rows := dbpool.QueryRow(ctx, "SELECT * from account where id = $1"+undeleted(includeDeleted), id)
 
-	err := rows.Scan(&acc.Id, &acc.Number, &acc.Description)
+	err := rows.Scan(&acc.Id, &acc.Number, &acc.Description, &acc.Deleted)
 	log.WithFields(log.Fields{"error": err, "account": acc}).Trace("Read account - reading result after scan error")
 
 	if err == nil {
 		return acc, err
 	} else {
-		if err.Error() != "no rows in result set" { // wrong id, functional error
+		if !errors.Is(err, pgx.ErrNoRows) { // wrong id, functional error
 			log.WithFields(log.Fields{"id": id, "error": err}).Error("Read account - reading result error")
 		}
-		return acc, err
+		return acc, dbErr(err)
 	}
 }
 
-func (account *Account) Search(dbpool *pgxpool.Pool, search string, limit int64) ([]Account, error) {
-	var rows pgx.Rows
-	var err error
-	var query string = "SELECT * from account"
-	var orderby string = " order by id desc"
-	var where string = " where number like '%" + search + "%' or description like '%" + search + "%'"
+// Read the account with the id and lock it until the end of the transaction of dbpool,
+// a concurrent change of the account waits for the transaction
+func (account *Account) ReadForUpdate(ctx context.Context, dbpool Db, id string) (Account, error) {
+	if err := lockRow(ctx, dbpool, "account", id); err != nil {
+		return Account{}, err
+	}
+	return account.ReadById(ctx, dbpool, id, false)
+}
 
-	accounts := []Account{}
+// Read the accounts with the ids by id, deleted accounts included
+func (account *Account) ReadByIds(ctx context.Context, dbpool Db, ids []int64) (map[int64]Account, error) {
+	accounts := map[int64]Account{}
+
+	rows, err := selectFrom("account").whereIn("id", ids).rows(ctx, dbpool)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Read accounts by id - reading result error")
+		return accounts, err
+	}
+	defer rows.Close()
 
-	if len(search) > 0 {
-		query = query + where
+	for rows.Next() {
+		acc := Account{}
+		if err = rows.Scan(&acc.Id, &acc.Number, &acc.Description, &acc.Deleted); err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Read accounts by id - reading result error")
+			return accounts, err
+		}
+		accounts[acc.Id] = acc
 	}
+	return accounts, rows.Err()
+}
 
-	query = query + orderby
+// Read the account with the number, a deleted account is only read on request
+func (account *Account) ReadByNumber(ctx context.Context, dbpool Db, number string, includeDeleted bool) (Account, error) {
+	var acc Account
 
-	if limit > 0 {
-		query = query + " limit $1"
-		rows, err = dbpool.Query(context.Background(), query, limit)
-	} else {
-		rows, err = dbpool.Query(context.Background(), query)
+	rows := dbpool.QueryRow(ctx, "SELECT * from account where number = $1"+undeleted(includeDeleted), number)
+
+	err := rows.Scan(&acc.Id, &acc.Number, &acc.Description, &acc.Deleted)
+	log.WithFields(log.Fields{"error": err, "account": acc}).Trace("Read account by number - reading result after scan error")
+
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) { // unknown number, functional error
+		log.WithFields(log.Fields{"number": number, "error": err}).Error("Read account by number - reading result error")
 	}
+	return acc, dbErr(err)
+}
 
-	if err == nil {
-		var index = 0
+// Full text search of accounts by number and description, deleted accounts are only included on request.
+// Config is the text search configuration, see SearchConfigs.
+func (account *Account) Search(ctx context.Context, dbpool Db, term string, config string, page *Page, includeDeleted bool) ([]AccountMatch, error) {
+	matches := []AccountMatch{}
 
-		for rows.Next() {
-			account := Account{}
-			err := rows.Scan(&account.Id, &account.Number, &account.Description)
+	search, err := newTextSearch(config, accountDocument, term)
+	if err != nil {
+		return matches, err
+	}
 
-			if err == nil {
-				accounts = append(accounts, account)
-				index++
-			} else {
-				log.WithFields(log.Fields{"error": err}).Error("Search account - reading result error")
-				return accounts, err
-			}
-		}
-		return accounts, nil
-	} else {
-		if err.Error() != "no rows in result set" { // nothing found functional error
+	query := search.where(selectFrom("account"))
+	if !includeDeleted {
+		query.where("deleted is null")
+	}
+
+	if err = page.count(ctx, dbpool, query); err != nil {
+		return matches, err
+	}
+
+	rows, err := search.page(query, page).rows(ctx, dbpool)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Search account - reading result error")
+		return matches, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		match := AccountMatch{}
+		err = rows.Scan(&match.Id, &match.Number, &match.Description, &match.Deleted, &match.Rank, &match.Snippet)
+		if err != nil {
 			log.WithFields(log.Fields{"error": err}).Error("Search account - reading result error")
+			return matches, err
 		}
-		return accounts, err
+		matches = append(matches, match)
+	}
+	return pageRows(page, matches, func(match AccountMatch) int64 { return match.Id }), rows.Err()
+}
+
+// Undo the delete of an account
+func (account *Account) Restore(ctx context.Context, dbpool Db, id string) error {
+	var acc Account
+
+	// check if account exists and is deleted
+	rows := dbpool.QueryRow(ctx, "SELECT * from account where id = $1 and deleted is not null", id)
+
+	err := rows.Scan(&acc.Id, &acc.Number, &acc.Description, &acc.Deleted)
+
+	if err == nil {
+		_, err = dbpool.Exec(ctx, "UPDATE account set deleted = null where id = $1", id)
+		log.WithFields(log.Fields{"error": err}).Trace("Restore account")
 	}
+	return dbErr(err)
 }
 
-func (account *Account) Update(dbpool *pgxpool.Pool) (int64, error) {
+func (account *Account) Update(ctx context.Context, dbpool Db) (int64, error) {
 	var err error
 	var lastInsertedId int64 = 0
 
@@ -165,17 +304,17 @@ func (account *Account) Update(dbpool *pgxpool.Pool) (int64, error) {
 
 	if account.Id == 0 {
 		log.WithFields(log.Fields{"id": account.Id, "number": account.Number, "description": account.Description, "account": account}).Error("Update account - no id specified")
-		return lastInsertedId, fmt.Errorf("identification for account is missing")
+		return lastInsertedId, invalid("identification for account is missing")
 	}
 
 	//updateStmt := `update "account" set "number"=$2, "description"=$3 where "id"=$1`
-	//_, err := dbpool.Exec(context.Background(), updateStmt, account.Id, account.Number, account.Description)
+	//_, err := dbpool.Exec(ctx, updateStmt, account.Id, account.Number, account.Description)
 
-	_, err = dbpool.Exec(context.Background(), `update "account" set "number"=$2, "description"=$3 where "id"=$1`, account.Id, account.Number, account.Description)
+	_, err = dbpool.Exec(ctx, `update "account" set "number"=$2, "description"=$3 where "id"=$1`, account.Id, account.Number, account.Description)
 
 	if err != nil {
 		log.WithFields(log.Fields{"error": err, "account": account}).Error("update account: Error during update account")
-		return 0, fmt.Errorf("update Account insert: %v", err)
+		return 0, fmt.Errorf("update Account insert: %w", dbErr(err))
 	} else {
 		lastInsertedId = account.Id
 		log.WithFields(log.Fields{"lastInsertedId": lastInsertedId}).Trace("update account: update account")
@@ -184,7 +323,7 @@ func (account *Account) Update(dbpool *pgxpool.Pool) (int64, error) {
 	return lastInsertedId, nil
 }
 
-func (account *Account) Write(dbpool *pgxpool.Pool) (int64, error) {
+func (account *Account) Write(ctx context.Context, dbpool Db) (int64, error) {
 
 	log.WithFields(log.Fields{"id": account.Id, "number": account.Number, "description": account.Description}).Trace("Write account")
 
@@ -192,15 +331,15 @@ func (account *Account) Write(dbpool *pgxpool.Pool) (int64, error) {
 	var lastInsertedId int64 = 0
 
 	if account.Id != 0 {
-		_, err = dbpool.Exec(context.Background(), "INSERT INTO account (id, number, description) VALUES ($1, $2, $3)", account.Id, account.Number, account.Description)
+		_, err = dbpool.Exec(ctx, "INSERT INTO account (id, number, description) VALUES ($1, $2, $3)", account.Id, account.Number, account.Description)
 		lastInsertedId = account.Id
 	} else {
-		err = dbpool.QueryRow(context.Background(), "INSERT INTO account (number, description) VALUES ($1, $2) RETURNING id", account.Number, account.Description).Scan(&lastInsertedId)
+		err = dbpool.QueryRow(ctx, "INSERT INTO account (number, description) VALUES ($1, $2) RETURNING id", account.Number, account.Description).Scan(&lastInsertedId)
 		account.Id = lastInsertedId
 	}
 	if err != nil {
 		log.WithFields(log.Fields{"error": err, "account": account}).Error("addAccount: Error during insert account")
-		return 0, fmt.Errorf("addAccount insert: %v", err)
+		return 0, fmt.Errorf("addAccount insert: %w", dbErr(err))
 	} else {
 		log.WithFields(log.Fields{"lastInsertedId": lastInsertedId}).Trace("addAccount: insert account")
 	}
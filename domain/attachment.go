@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// A document attached to a transaction, like a receipt.
+// The content is stored outside the database by its SHA-256 hash.
+type Attachment struct {
+	Id          int64     `json:"id"`
+	Transaction int64     `json:"transaction"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"contenttype"`
+	Size        int64     `json:"size"`
+	Hash        string    `json:"hash"`
+	Created     time.Time `json:"created"`
+}
+
+type IAttachment interface {
+	CountByHash(ctx context.Context, dbpool Db, hash string) (int64, error)
+	DeleteById(ctx context.Context, dbpool Db, transaction string, id string) error
+	Read(ctx context.Context, dbpool Db, transaction string) ([]Attachment, error)
+	ReadById(ctx context.Context, dbpool Db, transaction string, id string) (Attachment, error)
+	Write(ctx context.Context, dbpool Db) (int64, error)
+}
+
+func (attachment *Attachment) scan(row pgx.Row) error {
+	return row.Scan(&attachment.Id, &attachment.Transaction, &attachment.Filename, &attachment.ContentType,
+		&attachment.Size, &attachment.Hash, &attachment.Created)
+}
+
+// Number of attachments sharing the content with hash
+func (attachment *Attachment) CountByHash(ctx context.Context, dbpool Db, hash string) (int64, error) {
+	var count int64
+
+	err := dbpool.QueryRow(ctx, "SELECT count(*) from attachment where hash = $1", hash).Scan(&count)
+	if err != nil {
+		log.WithFields(log.Fields{"hash": hash, "error": err}).Error("Count attachment - reading result error")
+	}
+	return count, err
+}
+
+func (attachment *Attachment) DeleteById(ctx context.Context, dbpool Db, transaction string, id string) error {
+	var att Attachment
+
+	// check if attachment exists
+	err := att.scan(dbpool.QueryRow(ctx, "SELECT * from attachment where transaction = $1 and id = $2", transaction, id))
+
+	if err == nil {
+		_, err = dbpool.Exec(ctx, "DELETE from attachment where id = $1", id)
+		log.WithFields(log.Fields{"error": err}).Trace("Delete attachment")
+	}
+	return dbErr(err)
+}
+
+func (attachment *Attachment) Read(ctx context.Context, dbpool Db, transaction string) ([]Attachment, error) {
+	attachments := []Attachment{}
+
+	rows, err := dbpool.Query(ctx, "SELECT * from attachment where transaction = $1 order by id", transaction)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Read attachment - reading result error")
+		return attachments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		att := Attachment{}
+		err = att.scan(rows)
+
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Read attachment - reading result error")
+			return attachments, err
+		}
+		attachments = append(attachments, att)
+	}
+	return attachments, rows.Err()
+}
+
+func (attachment *Attachment) ReadById(ctx context.Context, dbpool Db, transaction string, id string) (Attachment, error) {
+	var att Attachment
+
+	err := att.scan(dbpool.QueryRow(ctx, "SELECT * from attachment where transaction = $1 and id = $2", transaction, id))
+
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) { // wrong id, functional error
+		log.WithFields(log.Fields{"id": id, "error": err}).Error("Read attachment - reading result error")
+	}
+	return att, dbErr(err)
+}
+
+func (attachment *Attachment) Write(ctx context.Context, dbpool Db) (int64, error) {
+	var lastInsertedId int64 = 0
+
+	err := dbpool.QueryRow(ctx,
+		"INSERT INTO attachment (transaction, filename, contenttype, size, hash) VALUES ($1, $2, $3, $4, $5) RETURNING id, created",
+		attachment.Transaction, attachment.Filename, attachment.ContentType, attachment.Size, attachment.Hash).Scan(&lastInsertedId, &attachment.Created)
+
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "attachment": attachment}).Error("addAttachment: Error during insert attachment")
+		return 0, fmt.Errorf("addAttachment insert: %w", dbErr(err))
+	}
+
+	attachment.Id = lastInsertedId
+	return lastInsertedId, nil
+}
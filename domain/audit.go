@@ -0,0 +1,131 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Audited entities
+const (
+	AuditAccount       = "account"
+	AuditTarget        = "target"
+	AuditTransaction   = "transaction"
+	AuditStatementLine = "statementline"
+)
+
+// Audited actions
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+)
+
+// A mutation of an entity, with the entity as json before and after the mutation.
+// A mutation that failed has the ticket of the error returned to the client.
+type Audit struct {
+	Id        int64           `json:"id"`
+	Entity    string          `json:"entity"`
+	EntityId  int64           `json:"entityid"`
+	Action    string          `json:"action"`
+	Old       json.RawMessage `json:"old"`
+	New       json.RawMessage `json:"new"`
+	Actor     string          `json:"actor"`
+	RequestId string          `json:"requestid"`
+	Ticket    string          `json:"ticket"`
+	Created   time.Time       `json:"created"`
+}
+
+type IAudit interface {
+	Read(ctx context.Context, dbpool Db, entity string, id int64, from time.Time, to time.Time, limit int64) ([]Audit, error)
+	Write(ctx context.Context, dbpool Db) (int64, error)
+}
+
+// json of an entity for the audit, nil when there is no entity
+func AuditJson(entity any) json.RawMessage {
+	if entity == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(entity)
+	if err != nil {
+		log.WithFields(log.Fields{"entity": entity, "error": err}).Error("Audit json - marshal error")
+		return nil
+	}
+	return b
+}
+
+func jsonText(value json.RawMessage) *string {
+	if value == nil {
+		return nil
+	}
+	text := string(value)
+	return &text
+}
+
+// Read audit records, an empty entity, zero id and zero times select everything
+func (audit *Audit) Read(ctx context.Context, dbpool Db, entity string, id int64, from time.Time, to time.Time, limit int64) ([]Audit, error) {
+	audits := []Audit{}
+	query := selectFrom("audit")
+
+	if len(entity) > 0 {
+		query.where("entity = ?", entity)
+	}
+	if id != 0 {
+		query.where("entity_id = ?", id)
+	}
+	if !from.IsZero() {
+		query.where("created >= ?", from)
+	}
+	if !to.IsZero() {
+		query.where("created < ?", to)
+	}
+
+	rows, err := query.selecting("id, entity, entity_id, action, old::text, new::text, actor, request_id, ticket, created").order("id desc").limitTo(limit).rows(ctx, dbpool)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Read audit - reading result error")
+		return audits, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var old, new *string
+		a := Audit{}
+
+		err = rows.Scan(&a.Id, &a.Entity, &a.EntityId, &a.Action, &old, &new, &a.Actor, &a.RequestId, &a.Ticket, &a.Created)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Read audit - reading result error")
+			return audits, err
+		}
+		if old != nil {
+			a.Old = json.RawMessage(*old)
+		}
+		if new != nil {
+			a.New = json.RawMessage(*new)
+		}
+		audits = append(audits, a)
+	}
+	return audits, rows.Err()
+}
+
+func (audit *Audit) Write(ctx context.Context, dbpool Db) (int64, error) {
+	var lastInsertedId int64 = 0
+
+	err := dbpool.QueryRow(ctx,
+		`INSERT INTO audit (entity, entity_id, action, old, new, actor, request_id, ticket)
+		VALUES ($1, $2, $3, $4::jsonb, $5::jsonb, $6, $7, $8) RETURNING id, created`,
+		audit.Entity, audit.EntityId, audit.Action, jsonText(audit.Old), jsonText(audit.New), audit.Actor, audit.RequestId, audit.Ticket).Scan(&lastInsertedId, &audit.Created)
+
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "audit": audit}).Error("addAudit: Error during insert audit")
+		return 0, fmt.Errorf("addAudit insert: %w", dbErr(err))
+	}
+
+	audit.Id = lastInsertedId
+	return lastInsertedId, nil
+}
@@ -0,0 +1,201 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// Sign conventions used by banks in their csv exports
+const (
+	SignMinusIsDebit = "minus"     // negative amounts leave the account
+	SignPlusIsDebit  = "plus"      // positive amounts leave the account
+	SignIndicator    = "indicator" // separate column tells if amount leaves the account
+)
+
+// Column mapping of a csv file, columns are counted from 0 and -1 is no column
+type CsvProfile struct {
+	Id                 int64  `json:"id"`
+	Name               string `json:"name"`
+	Delimiter          string `json:"delimiter"`
+	Header             bool   `json:"header"`
+	DateColumn         int    `json:"datecolumn"`
+	DateFormat         string `json:"dateformat"`
+	AmountColumn       int    `json:"amountcolumn"`
+	SignConvention     string `json:"signconvention"`
+	IndicatorColumn    int    `json:"indicatorcolumn"`
+	DebitIndicator     string `json:"debitindicator"`
+	CounterpartyColumn int    `json:"counterpartycolumn"`
+	DescriptionColumn  int    `json:"descriptioncolumn"`
+	DecimalSeparator   string `json:"decimalseparator"`
+}
+
+// The columns missing in the json are -1, so Validate finds them missing instead of taking column 0
+func (profile *CsvProfile) UnmarshalJSON(data []byte) error {
+	type plain CsvProfile
+	decoded := plain{DateColumn: -1, AmountColumn: -1, IndicatorColumn: -1, CounterpartyColumn: -1, DescriptionColumn: -1}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	*profile = CsvProfile(decoded)
+	return nil
+}
+
+type ICsvProfile interface {
+	DeleteByName(ctx context.Context, dbpool Db, name string) error
+	Read(ctx context.Context, dbpool Db, limit int64) ([]CsvProfile, error)
+	ReadByName(ctx context.Context, dbpool Db, name string) (CsvProfile, error)
+	Update(ctx context.Context, dbpool Db) (int64, error)
+	Write(ctx context.Context, dbpool Db) (int64, error)
+	Validate() error
+}
+
+func (profile *CsvProfile) scan(row pgx.Row) error {
+	return row.Scan(&profile.Id, &profile.Name, &profile.Delimiter, &profile.Header,
+		&profile.DateColumn, &profile.DateFormat, &profile.AmountColumn, &profile.SignConvention,
+		&profile.IndicatorColumn, &profile.DebitIndicator, &profile.CounterpartyColumn,
+		&profile.DescriptionColumn, &profile.DecimalSeparator)
+}
+
+func (profile *CsvProfile) DeleteByName(ctx context.Context, dbpool Db, name string) error {
+	var prof CsvProfile
+	var err error
+
+	// check if profile exists
+	err = prof.scan(dbpool.QueryRow(ctx, "SELECT * from csvprofile where name = $1", name))
+
+	if err == nil {
+		_, err = dbpool.Exec(ctx, "DELETE from csvprofile where name = $1", name)
+		log.WithFields(log.Fields{"error": err}).Trace("Delete csvprofile")
+	}
+	return dbErr(err)
+}
+
+func (profile *CsvProfile) Read(ctx context.Context, dbpool Db, limit int64) ([]CsvProfile, error) {
+	profiles := []CsvProfile{}
+
+	rows, err := selectFrom("csvprofile").order("name").limitTo(limit).rows(ctx, dbpool)
+
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Read csvprofile - reading result error")
+		return profiles, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		prof := CsvProfile{}
+		err = prof.scan(rows)
+
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Read csvprofile - reading result error")
+			return profiles, err
+		}
+		profiles = append(profiles, prof)
+	}
+	return profiles, rows.Err()
+}
+
+func (profile *CsvProfile) ReadByName(ctx context.Context, dbpool Db, name string) (CsvProfile, error) {
+	var prof CsvProfile
+
+	err := prof.scan(dbpool.QueryRow(ctx, "SELECT * from csvprofile where name = $1", name))
+	log.WithFields(log.Fields{"error": err, "csvprofile": prof}).Trace("Read csvprofile - reading result after scan error")
+
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) { // wrong name, functional error
+		log.WithFields(log.Fields{"name": name, "error": err}).Error("Read csvprofile - reading result error")
+	}
+	return prof, dbErr(err)
+}
+
+func (profile *CsvProfile) Update(ctx context.Context, dbpool Db) (int64, error) {
+	var err error
+
+	if profile.Id == 0 {
+		return 0, invalid("identification for csvprofile is missing")
+	}
+
+	_, err = dbpool.Exec(ctx,
+		`UPDATE csvprofile set name = $2, delimiter = $3, header = $4, date_column = $5, date_format = $6, amount_column = $7,
+		sign_convention = $8, indicator_column = $9, debit_indicator = $10, counterparty_column = $11, description_column = $12,
+		decimal_separator = $13 where id = $1`,
+		profile.Id, profile.Name, profile.Delimiter, profile.Header, profile.DateColumn, profile.DateFormat, profile.AmountColumn,
+		profile.SignConvention, profile.IndicatorColumn, profile.DebitIndicator, profile.CounterpartyColumn, profile.DescriptionColumn,
+		profile.DecimalSeparator)
+
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "csvprofile": profile}).Error("update csvprofile: Error during update csvprofile")
+		return 0, fmt.Errorf("update csvprofile: %w", dbErr(err))
+	}
+
+	return profile.Id, nil
+}
+
+func (profile *CsvProfile) Write(ctx context.Context, dbpool Db) (int64, error) {
+	var lastInsertedId int64 = 0
+
+	log.WithFields(log.Fields{"csvprofile": profile}).Trace("Write csvprofile")
+
+	err := dbpool.QueryRow(ctx,
+		`INSERT INTO csvprofile (name, delimiter, header, date_column, date_format, amount_column, sign_convention,
+		indicator_column, debit_indicator, counterparty_column, description_column, decimal_separator)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id`,
+		profile.Name, profile.Delimiter, profile.Header, profile.DateColumn, profile.DateFormat, profile.AmountColumn, profile.SignConvention,
+		profile.IndicatorColumn, profile.DebitIndicator, profile.CounterpartyColumn, profile.DescriptionColumn, profile.DecimalSeparator).Scan(&lastInsertedId)
+
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "csvprofile": profile}).Error("addCsvProfile: Error during insert csvprofile")
+		return 0, fmt.Errorf("addCsvProfile insert: %w", dbErr(err))
+	}
+
+	profile.Id = lastInsertedId
+	return lastInsertedId, nil
+}
+
+// Fill in defaults for omitted settings and check the mapping is usable
+func (profile *CsvProfile) Validate() error {
+	if len(profile.Name) == 0 {
+		return invalid("name of csvprofile is missing")
+	}
+	if len(profile.Delimiter) == 0 {
+		profile.Delimiter = ","
+	}
+	if len([]rune(profile.Delimiter)) != 1 {
+		return invalid("delimiter must be a single character")
+	}
+	if len(profile.DateFormat) == 0 {
+		profile.DateFormat = "2006-01-02"
+	}
+	if len(profile.DecimalSeparator) == 0 {
+		profile.DecimalSeparator = "."
+	}
+	if profile.DecimalSeparator != "." && profile.DecimalSeparator != "," {
+		return invalid("decimal separator must be '.' or ','")
+	}
+	if len(profile.SignConvention) == 0 {
+		profile.SignConvention = SignMinusIsDebit
+	}
+
+	switch profile.SignConvention {
+	case SignMinusIsDebit, SignPlusIsDebit:
+	case SignIndicator:
+		if profile.IndicatorColumn < 0 || len(profile.DebitIndicator) == 0 {
+			return invalid("sign convention indicator requires indicatorcolumn and debitindicator")
+		}
+	default:
+		return invalid("unknown sign convention %s", profile.SignConvention)
+	}
+
+	if profile.DateColumn < 0 || profile.AmountColumn < 0 || profile.CounterpartyColumn < 0 || profile.DescriptionColumn < 0 {
+		return invalid("date, amount, counterparty and description columns are required")
+	}
+	if profile.IndicatorColumn < -1 {
+		return invalid("indicator column must be -1 for none or a column")
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package domain
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Errors of the domain methods, test them with errors.Is
+var (
+	ErrNotFound   = errors.New("not found")             // no entity with the id, number or name
+	ErrConflict   = errors.New("conflict")              // a unique value, like the number of an account, exists already
+	ErrForeignKey = errors.New("foreign key violation") // a referenced entity does not exist or the entity is still referenced
+	ErrValidation = errors.New("validation error")      // a value is not allowed
+)
+
+// postgres error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+	pgNotNullViolation    = "23502"
+	pgCheckViolation      = "23514"
+	pgDataException       = "22" // class of invalid values, like a too large number
+)
+
+// An error of the database that is one of the domain errors, the message stays the message of the database
+type dbError struct {
+	kind   error
+	reason string
+	err    error
+}
+
+func (e *dbError) Error() string {
+	return e.err.Error()
+}
+
+func (e *dbError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *dbError) Unwrap() error {
+	return e.err
+}
+
+// A value that is not allowed, the reason tells which value and why
+type ValidationError struct {
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Reason
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+func invalid(format string, args ...any) error {
+	return &ValidationError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// a change that is not possible in the current state, the reason tells why
+func conflict(format string, args ...any) error {
+	reason := fmt.Sprintf(format, args...)
+	return &dbError{kind: ErrConflict, reason: reason, err: errors.New(reason)}
+}
+
+// Map an error of pgx to the domain error it is, other errors are returned unchanged
+func dbErr(err error) error {
+	var pgErr *pgconn.PgError
+	var known *dbError
+
+	switch {
+	case err == nil || errors.As(err, &known):
+		return err
+	case errors.Is(err, pgx.ErrNoRows):
+		return &dbError{kind: ErrNotFound, err: err}
+	case !errors.As(err, &pgErr):
+		return err
+	}
+
+	reason := pgErr.Detail
+	if len(reason) == 0 {
+		reason = pgErr.Message
+	}
+	switch {
+	case pgErr.Code == pgUniqueViolation:
+		return &dbError{kind: ErrConflict, reason: reason, err: err}
+	case pgErr.Code == pgForeignKeyViolation:
+		return &dbError{kind: ErrForeignKey, reason: reason, err: err}
+	case pgErr.Code == pgNotNullViolation, pgErr.Code == pgCheckViolation, strings.HasPrefix(pgErr.Code, pgDataException):
+		return &dbError{kind: ErrValidation, reason: reason, err: err}
+	}
+	return err
+}
+
+// the code sqlite appends to its message, e.g. UNIQUE constraint failed: account.number (2067)
+var sqliteCode = regexp.MustCompile(` \(\d+\)$`)
+
+// Map an error of sqlite to the domain error it is, like dbErr does for postgres
+func sqliteErr(err error) error {
+	var sqliteError *sqlite.Error
+	var known *dbError
+
+	switch {
+	case err == nil || errors.As(err, &known):
+		return err
+	case errors.Is(err, sql.ErrNoRows):
+		return &dbError{kind: ErrNotFound, err: err}
+	case !errors.As(err, &sqliteError):
+		return err
+	}
+
+	// the message is the kind of error followed by the message of the statement
+	reason := sqliteError.Error()
+	if i := strings.Index(reason, ": "); i >= 0 {
+		reason = reason[i+2:]
+	}
+	reason = sqliteCode.ReplaceAllString(reason, "")
+	switch sqliteError.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return &dbError{kind: ErrConflict, reason: reason, err: err}
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		return &dbError{kind: ErrForeignKey, reason: reason, err: err}
+	case sqlite3.SQLITE_CONSTRAINT_NOTNULL, sqlite3.SQLITE_CONSTRAINT_CHECK:
+		return &dbError{kind: ErrValidation, reason: reason, err: err}
+	}
+	return err
+}
+
+// Reason of a domain error that a client can correct, e.g. Key (number)=(NL01) already exists.
+// Other errors have no reason, their message is for the log only.
+func Reason(err error) string {
+	var validation *ValidationError
+	var known *dbError
+
+	switch {
+	case errors.As(err, &validation):
+		return validation.Reason
+	case errors.As(err, &known):
+		return known.reason
+	}
+	return ""
+}
@@ -0,0 +1,1310 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Accounts, targets, transactions and the entities around them kept in memory, to run the api without postgres.
+// The constraints of the database are checked the same way, nothing is kept when the server stops.
+type memoryStore struct {
+	mutex              sync.RWMutex
+	accounts           map[int64]Account
+	targets            map[int64]Target
+	transactions       map[int64]Transaction
+	tags               map[string]int64
+	attachments        map[int64]Attachment
+	reconciliations    map[int64]Reconciliation
+	statementLines     map[int64]StatementLine
+	csvProfiles        map[int64]CsvProfile
+	audits             []Audit
+	lastAccount        int64
+	lastTarget         int64
+	lastTransaction    int64
+	lastTag            int64
+	lastAttachment     int64
+	lastReconciliation int64
+	lastStatementLine  int64
+	lastCsvProfile     int64
+}
+
+// Repositories sharing one empty memory store
+func MemoryRepositories() Repositories {
+	store := &memoryStore{
+		accounts:        map[int64]Account{},
+		targets:         map[int64]Target{},
+		transactions:    map[int64]Transaction{},
+		tags:            map[string]int64{},
+		attachments:     map[int64]Attachment{},
+		reconciliations: map[int64]Reconciliation{},
+		statementLines:  map[int64]StatementLine{},
+		csvProfiles:     map[int64]CsvProfile{},
+	}
+	return store.repositories()
+}
+
+func (store *memoryStore) repositories() Repositories {
+	return Repositories{
+		Accounts:        memoryAccounts{store},
+		Targets:         memoryTargets{store},
+		Transactions:    memoryTransactions{store},
+		Tags:            memoryTags{store},
+		Attachments:     memoryAttachments{store},
+		Reconciliations: memoryReconciliations{store},
+		StatementLines:  memoryStatementLines{store},
+		CsvProfiles:     memoryCsvProfiles{store},
+		Audits:          memoryAudits{store},
+		atomic:          store.atomic,
+	}
+}
+
+// Run work on a copy of the store, that replaces the store when work succeeds.
+// The store is locked meanwhile, others wait like they wait for a transaction of the database.
+func (store *memoryStore) atomic(ctx context.Context, work func(storage Repositories) error) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	copy := store.copy()
+	if err := work(copy.repositories()); err != nil {
+		return err
+	}
+
+	store.accounts, store.targets, store.transactions = copy.accounts, copy.targets, copy.transactions
+	store.tags, store.attachments, store.reconciliations = copy.tags, copy.attachments, copy.reconciliations
+	store.statementLines, store.csvProfiles, store.audits = copy.statementLines, copy.csvProfiles, copy.audits
+	store.lastAccount, store.lastTarget, store.lastTransaction = copy.lastAccount, copy.lastTarget, copy.lastTransaction
+	store.lastTag, store.lastAttachment, store.lastReconciliation = copy.lastTag, copy.lastAttachment, copy.lastReconciliation
+	store.lastStatementLine, store.lastCsvProfile = copy.lastStatementLine, copy.lastCsvProfile
+	return nil
+}
+
+// a copy of the entities of the store, the caller holds the lock
+func (store *memoryStore) copy() *memoryStore {
+	copy := &memoryStore{
+		accounts:           copyMap(store.accounts),
+		targets:            copyMap(store.targets),
+		transactions:       copyMap(store.transactions),
+		tags:               copyMap(store.tags),
+		attachments:        copyMap(store.attachments),
+		reconciliations:    copyMap(store.reconciliations),
+		statementLines:     copyMap(store.statementLines),
+		csvProfiles:        copyMap(store.csvProfiles),
+		audits:             append([]Audit{}, store.audits...),
+		lastAccount:        store.lastAccount,
+		lastTarget:         store.lastTarget,
+		lastTransaction:    store.lastTransaction,
+		lastTag:            store.lastTag,
+		lastAttachment:     store.lastAttachment,
+		lastReconciliation: store.lastReconciliation,
+		lastStatementLine:  store.lastStatementLine,
+		lastCsvProfile:     store.lastCsvProfile,
+	}
+	// the tags are appended to in place
+	for id, transaction := range copy.transactions {
+		if transaction.Tags != nil {
+			transaction.Tags = append([]string{}, transaction.Tags...)
+			copy.transactions[id] = transaction
+		}
+	}
+	return copy
+}
+
+func copyMap[K comparable, V any](entities map[K]V) map[K]V {
+	copy := make(map[K]V, len(entities))
+	for key, entity := range entities {
+		copy[key] = entity
+	}
+	return copy
+}
+
+// error of a row that does not exist, as returned by postgres
+func memoryNotFound() error {
+	return dbErr(pgx.ErrNoRows)
+}
+
+// error of a violated constraint, as returned by postgres
+func memoryViolation(kind error, format string, args ...any) error {
+	reason := fmt.Sprintf(format, args...)
+	return &dbError{kind: kind, reason: reason, err: errors.New(reason)}
+}
+
+// the id of a path, an id that is no number does not exist
+func memoryId(id string) (int64, error) {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, memoryNotFound()
+	}
+	return n, nil
+}
+
+// Page of rows, all rows matching the criteria in any order. The rows are ordered by compare with id as tie breaker,
+// descending unless the page is ascending. After looks up the row the page starts after, like the keyset of Page.apply.
+func memoryPage[T any](page *Page, rows []T, id func(T) int64, compare func(a T, b T) int, after func(id int64) (T, bool)) []T {
+	order := func(a T, b T) int {
+		if c := compare(a, b); c != 0 {
+			return c
+		}
+		return compareInt(id(a), id(b))
+	}
+	if !page.Ascending {
+		ascending := order
+		order = func(a T, b T) int { return -ascending(a, b) }
+	}
+
+	if page.Count {
+		page.Total = int64(len(rows))
+	}
+	sort.Slice(rows, func(i, j int) bool { return order(rows[i], rows[j]) < 0 })
+
+	if page.After > 0 {
+		last, ok := after(page.After)
+		start := len(rows)
+		if ok {
+			start = sort.Search(len(rows), func(i int) bool { return order(rows[i], last) > 0 })
+		}
+		rows = rows[start:]
+	}
+	if page.Limit > 0 && int64(len(rows)) > page.Limit+1 {
+		rows = rows[:page.Limit+1]
+	}
+	return pageRows(page, rows, id)
+}
+
+// Match of a document with all words of a search term, without the languages of postgres.
+// The rank is the number of times the words occur, the snippet is the html escaped document with the words marked.
+func memoryMatch(document string, term string) (float32, string, bool) {
+	var rank float32
+	var words []string
+
+	for _, word := range strings.Fields(strings.ToLower(term)) {
+		n := strings.Count(strings.ToLower(document), word)
+		if n == 0 {
+			return 0, "", false
+		}
+		rank += float32(n)
+		words = append(words, regexp.QuoteMeta(word))
+	}
+	if len(words) == 0 {
+		return 0, "", false
+	}
+
+	// the text around and of the marks is escaped, the marks are the only markup of the snippet
+	var snippet strings.Builder
+	last := 0
+	marked := regexp.MustCompile("(?i)" + strings.Join(words, "|"))
+	for _, match := range marked.FindAllStringIndex(document, -1) {
+		snippet.WriteString(html.EscapeString(document[last:match[0]]))
+		snippet.WriteString("<mark>" + html.EscapeString(document[match[0]:match[1]]) + "</mark>")
+		last = match[1]
+	}
+	snippet.WriteString(html.EscapeString(document[last:]))
+	return rank, snippet.String(), true
+}
+
+// the day of a moment, as a date column of postgres keeps it
+func memoryDate(moment time.Time) time.Time {
+	return time.Date(moment.Year(), moment.Month(), moment.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// order of a and b, -1, 0 or 1
+func compareInt(a int64, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+type memoryAccounts struct {
+	store *memoryStore
+}
+
+func (repository memoryAccounts) Balances(ctx context.Context, ids []int64) (map[int64]int64, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	balances := map[int64]int64{}
+	for _, id := range ids {
+		balances[id] = 0
+	}
+	for _, transaction := range store.transactions {
+		if _, ok := balances[transaction.To_account]; ok {
+			balances[transaction.To_account] += transaction.Amount
+		}
+		if _, ok := balances[transaction.From_account]; ok {
+			balances[transaction.From_account] -= transaction.Amount
+		}
+	}
+	return balances, nil
+}
+
+func (repository memoryAccounts) DeleteById(ctx context.Context, id string) error {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	n, err := memoryId(id)
+	if err != nil {
+		return err
+	}
+	account, ok := store.accounts[n]
+	if !ok || account.Deleted != nil {
+		return memoryNotFound()
+	}
+	now := time.Now()
+	account.Deleted = &now
+	store.accounts[n] = account
+	return nil
+}
+
+func (repository memoryAccounts) Purge(ctx context.Context, before time.Time) ([]Account, error) {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	used := map[int64]bool{}
+	for _, transaction := range store.transactions {
+		used[transaction.From_account] = true
+		used[transaction.To_account] = true
+	}
+
+	accounts := []Account{}
+	for id, account := range store.accounts {
+		if account.Deleted != nil && account.Deleted.Before(before) && !used[id] {
+			delete(store.accounts, id)
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts, nil
+}
+
+func (repository memoryAccounts) Read(ctx context.Context, number string, page *Page, includeDeleted bool) ([]Account, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	accounts := []Account{}
+	for _, account := range store.accounts {
+		if (len(number) == 0 || account.Number == number) && (includeDeleted || account.Deleted == nil) {
+			accounts = append(accounts, account)
+		}
+	}
+	return memoryPage(page, accounts, func(account Account) int64 { return account.Id },
+		func(a Account, b Account) int { return 0 },
+		func(id int64) (Account, bool) { account, ok := store.accounts[id]; return account, ok }), nil
+}
+
+func (repository memoryAccounts) ReadById(ctx context.Context, id string, includeDeleted bool) (Account, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	n, err := memoryId(id)
+	if err != nil {
+		return Account{}, err
+	}
+	account, ok := store.accounts[n]
+	if !ok || (!includeDeleted && account.Deleted != nil) {
+		return Account{}, memoryNotFound()
+	}
+	return account, nil
+}
+
+// within Atomic the store is locked already
+func (repository memoryAccounts) ReadForUpdate(ctx context.Context, id string) (Account, error) {
+	return repository.ReadById(ctx, id, false)
+}
+
+func (repository memoryAccounts) ReadByIds(ctx context.Context, ids []int64) (map[int64]Account, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	accounts := map[int64]Account{}
+	for _, id := range ids {
+		if account, ok := store.accounts[id]; ok {
+			accounts[id] = account
+		}
+	}
+	return accounts, nil
+}
+
+func (repository memoryAccounts) ReadByNumber(ctx context.Context, number string, includeDeleted bool) (Account, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	for _, account := range store.accounts {
+		if account.Number == number && (includeDeleted || account.Deleted == nil) {
+			return account, nil
+		}
+	}
+	return Account{}, memoryNotFound()
+}
+
+func (repository memoryAccounts) Restore(ctx context.Context, id string) error {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	n, err := memoryId(id)
+	if err != nil {
+		return err
+	}
+	account, ok := store.accounts[n]
+	if !ok || account.Deleted == nil {
+		return memoryNotFound()
+	}
+	account.Deleted = nil
+	store.accounts[n] = account
+	return nil
+}
+
+func (repository memoryAccounts) Search(ctx context.Context, term string, config string, page *Page, includeDeleted bool) ([]AccountMatch, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	matches := []AccountMatch{}
+	if _, err := newTextSearch(config, accountDocument, term); err != nil {
+		return matches, err
+	}
+
+	found := map[int64]AccountMatch{}
+	for _, account := range store.accounts {
+		if !includeDeleted && account.Deleted != nil {
+			continue
+		}
+		if rank, snippet, ok := memoryMatch(account.Number+" "+account.Description, term); ok {
+			found[account.Id] = AccountMatch{Account: account, Rank: rank, Snippet: snippet}
+			matches = append(matches, found[account.Id])
+		}
+	}
+	page.Ascending = false
+	return memoryPage(page, matches, func(match AccountMatch) int64 { return match.Id },
+		func(a AccountMatch, b AccountMatch) int { return compareInt(int64(a.Rank*1000), int64(b.Rank*1000)) },
+		func(id int64) (AccountMatch, bool) { match, ok := found[id]; return match, ok }), nil
+}
+
+// the number of an account is unique
+func (store *memoryStore) checkAccount(account *Account) error {
+	for _, other := range store.accounts {
+		if other.Number == account.Number && other.Id != account.Id {
+			return memoryViolation(ErrConflict, "Key (number)=(%s) already exists.", account.Number)
+		}
+	}
+	return nil
+}
+
+func (repository memoryAccounts) Update(ctx context.Context, account *Account) (int64, error) {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if account.Id == 0 {
+		return 0, invalid("identification for account is missing")
+	}
+	if err := store.checkAccount(account); err != nil {
+		return 0, err
+	}
+	if existing, ok := store.accounts[account.Id]; ok {
+		existing.Number = account.Number
+		existing.Description = account.Description
+		store.accounts[account.Id] = existing
+	}
+	return account.Id, nil
+}
+
+func (repository memoryAccounts) Write(ctx context.Context, account *Account) (int64, error) {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.accounts[account.Id]; ok {
+		return 0, memoryViolation(ErrConflict, "Key (id)=(%d) already exists.", account.Id)
+	}
+	if err := store.checkAccount(account); err != nil {
+		return 0, err
+	}
+	if account.Id == 0 {
+		store.lastAccount++
+		account.Id = store.lastAccount
+	} else if account.Id > store.lastAccount {
+		store.lastAccount = account.Id
+	}
+	store.accounts[account.Id] = Account{Id: account.Id, Number: account.Number, Description: account.Description}
+	return account.Id, nil
+}
+
+type memoryTargets struct {
+	store *memoryStore
+}
+
+func (repository memoryTargets) DeleteById(ctx context.Context, id string) error {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	n, err := memoryId(id)
+	if err != nil {
+		return err
+	}
+	target, ok := store.targets[n]
+	if !ok || target.Deleted != nil {
+		return memoryNotFound()
+	}
+	now := time.Now()
+	target.Deleted = &now
+	store.targets[n] = target
+	return nil
+}
+
+func (repository memoryTargets) Purge(ctx context.Context, before time.Time) ([]Target, error) {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	used := map[int64]bool{}
+	for _, transaction := range store.transactions {
+		used[transaction.Target] = true
+	}
+
+	targets := []Target{}
+	for id, target := range store.targets {
+		if target.Deleted != nil && target.Deleted.Before(before) && !used[id] {
+			delete(store.targets, id)
+			targets = append(targets, target)
+		}
+	}
+	return targets, nil
+}
+
+func (repository memoryTargets) Read(ctx context.Context, name string, page *Page, includeDeleted bool) ([]Target, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	targets := []Target{}
+	for _, target := range store.targets {
+		if (len(name) == 0 || target.Name == name) && (includeDeleted || target.Deleted == nil) {
+			targets = append(targets, target)
+		}
+	}
+	return memoryPage(page, targets, func(target Target) int64 { return target.Id },
+		func(a Target, b Target) int { return 0 },
+		func(id int64) (Target, bool) { target, ok := store.targets[id]; return target, ok }), nil
+}
+
+func (repository memoryTargets) ReadById(ctx context.Context, id string, includeDeleted bool) (Target, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	n, err := memoryId(id)
+	if err != nil {
+		return Target{}, err
+	}
+	target, ok := store.targets[n]
+	if !ok || (!includeDeleted && target.Deleted != nil) {
+		return Target{}, memoryNotFound()
+	}
+	return target, nil
+}
+
+// within Atomic the store is locked already
+func (repository memoryTargets) ReadForUpdate(ctx context.Context, id string) (Target, error) {
+	return repository.ReadById(ctx, id, false)
+}
+
+func (repository memoryTargets) ReadByIds(ctx context.Context, ids []int64) (map[int64]Target, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	targets := map[int64]Target{}
+	for _, id := range ids {
+		if target, ok := store.targets[id]; ok {
+			targets[id] = target
+		}
+	}
+	return targets, nil
+}
+
+func (repository memoryTargets) ReadByName(ctx context.Context, name string, includeDeleted bool) (Target, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	for _, target := range store.targets {
+		if target.Name == name && (includeDeleted || target.Deleted == nil) {
+			return target, nil
+		}
+	}
+	return Target{}, memoryNotFound()
+}
+
+func (repository memoryTargets) Restore(ctx context.Context, id string) error {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	n, err := memoryId(id)
+	if err != nil {
+		return err
+	}
+	target, ok := store.targets[n]
+	if !ok || target.Deleted == nil {
+		return memoryNotFound()
+	}
+	target.Deleted = nil
+	store.targets[n] = target
+	return nil
+}
+
+func (repository memoryTargets) Search(ctx context.Context, term string, config string, page *Page, includeDeleted bool) ([]TargetMatch, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	matches := []TargetMatch{}
+	if _, err := newTextSearch(config, targetDocument, term); err != nil {
+		return matches, err
+	}
+
+	found := map[int64]TargetMatch{}
+	for _, target := range store.targets {
+		if !includeDeleted && target.Deleted != nil {
+			continue
+		}
+		if rank, snippet, ok := memoryMatch(target.Name+" "+target.Description, term); ok {
+			found[target.Id] = TargetMatch{Target: target, Rank: rank, Snippet: snippet}
+			matches = append(matches, found[target.Id])
+		}
+	}
+	page.Ascending = false
+	return memoryPage(page, matches, func(match TargetMatch) int64 { return match.Id },
+		func(a TargetMatch, b TargetMatch) int { return compareInt(int64(a.Rank*1000), int64(b.Rank*1000)) },
+		func(id int64) (TargetMatch, bool) { match, ok := found[id]; return match, ok }), nil
+}
+
+// the name of a target is unique
+func (store *memoryStore) checkTarget(target *Target) error {
+	for _, other := range store.targets {
+		if other.Name == target.Name && other.Id != target.Id {
+			return memoryViolation(ErrConflict, "Key (name)=(%s) already exists.", target.Name)
+		}
+	}
+	return nil
+}
+
+func (repository memoryTargets) Update(ctx context.Context, target *Target) (int64, error) {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if target.Id == 0 {
+		return 0, invalid("identification for target is missing")
+	}
+	if err := store.checkTarget(target); err != nil {
+		return 0, err
+	}
+	if existing, ok := store.targets[target.Id]; ok {
+		existing.Name = target.Name
+		existing.Description = target.Description
+		store.targets[target.Id] = existing
+	}
+	return target.Id, nil
+}
+
+func (repository memoryTargets) Write(ctx context.Context, target *Target) (int64, error) {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.targets[target.Id]; ok {
+		return 0, memoryViolation(ErrConflict, "Key (id)=(%d) already exists.", target.Id)
+	}
+	if err := store.checkTarget(target); err != nil {
+		return 0, err
+	}
+	if target.Id == 0 {
+		store.lastTarget++
+		target.Id = store.lastTarget
+	} else if target.Id > store.lastTarget {
+		store.lastTarget = target.Id
+	}
+	store.targets[target.Id] = Target{Id: target.Id, Name: target.Name, Description: target.Description}
+	return target.Id, nil
+}
+
+type memoryTransactions struct {
+	store *memoryStore
+}
+
+// a copy of a stored transaction, the tags ordered by name
+func (store *memoryStore) transaction(id int64) (Transaction, bool) {
+	transaction, ok := store.transactions[id]
+	transaction.Tags = append([]string{}, transaction.Tags...)
+	sort.Strings(transaction.Tags)
+	return transaction, ok
+}
+
+// the copies of the stored transactions selected by filter
+func (store *memoryStore) selectTransactions(filter TransactionFilter) []Transaction {
+	transactions := []Transaction{}
+	for id := range store.transactions {
+		if transaction, _ := store.transaction(id); filter.matches(transaction) {
+			transactions = append(transactions, transaction)
+		}
+	}
+	return transactions
+}
+
+func (repository memoryTransactions) AddTag(ctx context.Context, transaction *Transaction, tag string) error {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	tag, err := NormalizeTag(tag)
+	if err != nil {
+		return err
+	}
+	stored, ok := store.transactions[transaction.Id]
+	if !ok {
+		return memoryViolation(ErrForeignKey, "Key (transaction)=(%d) is not present in table \"transaction\".", transaction.Id)
+	}
+	if _, ok := store.tags[tag]; !ok {
+		store.lastTag++
+		store.tags[tag] = store.lastTag
+	}
+	if !stored.HasTag(tag) {
+		stored.Tags = append(stored.Tags, tag)
+		store.transactions[transaction.Id] = stored
+	}
+	if !transaction.HasTag(tag) {
+		transaction.Tags = append(transaction.Tags, tag)
+	}
+	return nil
+}
+
+func (repository memoryTransactions) DeleteById(ctx context.Context, id string) error {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	n, err := memoryId(id)
+	if err != nil {
+		return err
+	}
+	if _, ok := store.transactions[n]; !ok {
+		return memoryNotFound()
+	}
+	delete(store.transactions, n)
+
+	// the attachments are deleted with the transaction and the statement lines no longer refer to it
+	for id, attachment := range store.attachments {
+		if attachment.Transaction == n {
+			delete(store.attachments, id)
+		}
+	}
+	for id, line := range store.statementLines {
+		if line.Transaction != nil && *line.Transaction == n {
+			line.Transaction = nil
+			store.statementLines[id] = line
+		}
+	}
+	return nil
+}
+
+func (repository memoryTransactions) Read(ctx context.Context, filter TransactionFilter, page *Page) ([]Transaction, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	if len(page.Sort) > 0 && !TransactionSort[page.Sort] {
+		return []Transaction{}, invalid("unknown sort column %s", page.Sort)
+	}
+
+	return memoryPage(page, store.selectTransactions(filter), func(transaction Transaction) int64 { return transaction.Id },
+		func(a Transaction, b Transaction) int { return a.compare(b, page.Sort) },
+		store.transaction), nil
+}
+
+func (repository memoryTransactions) ReadByAccount(ctx context.Context, account int64, from time.Time, to time.Time, tag string) ([]Transaction, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	transactions := store.selectTransactions(TransactionFilter{Account: account, FromDate: from, ToDate: to, Tag: tag})
+	sort.Slice(transactions, func(i, j int) bool {
+		if c := transactions[i].compare(transactions[j], "date"); c != 0 {
+			return c < 0
+		}
+		return transactions[i].Id < transactions[j].Id
+	})
+	return transactions, nil
+}
+
+func (repository memoryTransactions) ReadById(ctx context.Context, id string) (Transaction, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	n, err := memoryId(id)
+	if err != nil {
+		return Transaction{}, err
+	}
+	transaction, ok := store.transaction(n)
+	if !ok {
+		return Transaction{}, memoryNotFound()
+	}
+	return transaction, nil
+}
+
+// within Atomic the store is locked already
+func (repository memoryTransactions) ReadForUpdate(ctx context.Context, id string) (Transaction, error) {
+	return repository.ReadById(ctx, id)
+}
+
+func (repository memoryTransactions) RemoveTag(ctx context.Context, transaction *Transaction, tag string) error {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	tag, err := NormalizeTag(tag)
+	if err != nil {
+		return err
+	}
+	without := func(tags []string) []string {
+		kept := []string{}
+		for _, name := range tags {
+			if name != tag {
+				kept = append(kept, name)
+			}
+		}
+		return kept
+	}
+	if stored, ok := store.transactions[transaction.Id]; ok {
+		stored.Tags = without(stored.Tags)
+		store.transactions[transaction.Id] = stored
+	}
+	transaction.Tags = without(transaction.Tags)
+	return nil
+}
+
+func (repository memoryTransactions) Search(ctx context.Context, term string, config string, page *Page) ([]TransactionMatch, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	matches := []TransactionMatch{}
+	if _, err := newTextSearch(config, transactionDocument, term); err != nil {
+		return matches, err
+	}
+
+	found := map[int64]TransactionMatch{}
+	for _, transaction := range store.selectTransactions(TransactionFilter{}) {
+		if rank, snippet, ok := memoryMatch(transaction.Description, term); ok {
+			found[transaction.Id] = TransactionMatch{Transaction: transaction, Rank: rank, Snippet: snippet}
+			matches = append(matches, found[transaction.Id])
+		}
+	}
+	page.Ascending = false
+	return memoryPage(page, matches, func(match TransactionMatch) int64 { return match.Id },
+		func(a TransactionMatch, b TransactionMatch) int {
+			return compareInt(int64(a.Rank*1000), int64(b.Rank*1000))
+		},
+		func(id int64) (TransactionMatch, bool) { match, ok := found[id]; return match, ok }), nil
+}
+
+// the accounts and target of a transaction exist
+func (store *memoryStore) checkTransaction(transaction *Transaction) error {
+	if _, ok := store.accounts[transaction.From_account]; !ok {
+		return memoryViolation(ErrForeignKey, "Key (from_account)=(%d) is not present in table \"account\".", transaction.From_account)
+	}
+	if _, ok := store.accounts[transaction.To_account]; !ok {
+		return memoryViolation(ErrForeignKey, "Key (to_account)=(%d) is not present in table \"account\".", transaction.To_account)
+	}
+	if _, ok := store.targets[transaction.Target]; !ok {
+		return memoryViolation(ErrForeignKey, "Key (target)=(%d) is not present in table \"target\".", transaction.Target)
+	}
+	return nil
+}
+
+func (repository memoryTransactions) Update(ctx context.Context, transaction *Transaction) (int64, error) {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if transaction.Id == 0 {
+		return 0, invalid("identification for transaction is missing")
+	}
+	transaction.Date = memoryDate(transaction.Date)
+	if err := store.checkTransaction(transaction); err != nil {
+		return 0, err
+	}
+	if existing, ok := store.transactions[transaction.Id]; ok {
+		existing.From_account = transaction.From_account
+		existing.To_account = transaction.To_account
+		existing.Target = transaction.Target
+		existing.Amount = transaction.Amount
+		existing.Description = transaction.Description
+		existing.Date = transaction.Date
+		store.transactions[transaction.Id] = existing
+	}
+	return transaction.Id, nil
+}
+
+func (repository memoryTransactions) Write(ctx context.Context, transaction *Transaction) (int64, error) {
+	store := repository.store
+	store.mutex.Lock()
+
+	if transaction.Date.IsZero() {
+		transaction.Date = time.Now()
+	}
+	transaction.Date = memoryDate(transaction.Date)
+	if _, ok := store.transactions[transaction.Id]; ok {
+		store.mutex.Unlock()
+		return 0, memoryViolation(ErrConflict, "Key (id)=(%d) already exists.", transaction.Id)
+	}
+	if err := store.checkTransaction(transaction); err != nil {
+		store.mutex.Unlock()
+		return 0, err
+	}
+	if transaction.Id == 0 {
+		store.lastTransaction++
+		transaction.Id = store.lastTransaction
+	} else if transaction.Id > store.lastTransaction {
+		store.lastTransaction = transaction.Id
+	}
+	stored := *transaction
+	stored.Reconciled = false
+	stored.Tags = nil
+	store.transactions[transaction.Id] = stored
+	store.mutex.Unlock()
+
+	// the tags are added like Transaction.Write does
+	tags := transaction.Tags
+	transaction.Tags = []string{}
+	for _, tag := range tags {
+		if err := repository.AddTag(ctx, transaction, tag); err != nil {
+			return transaction.Id, err
+		}
+	}
+	return transaction.Id, nil
+}
+
+type memoryTags struct {
+	store *memoryStore
+}
+
+func (repository memoryTags) Read(ctx context.Context) ([]Tag, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	counts := map[string]int64{}
+	for _, transaction := range store.transactions {
+		for _, name := range transaction.Tags {
+			counts[name]++
+		}
+	}
+
+	tags := []Tag{}
+	for name, id := range store.tags {
+		tags = append(tags, Tag{Id: id, Name: name, Transactions: counts[name]})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+type memoryAttachments struct {
+	store *memoryStore
+}
+
+func (repository memoryAttachments) CountByHash(ctx context.Context, hash string) (int64, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	var count int64
+	for _, attachment := range store.attachments {
+		if attachment.Hash == hash {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (repository memoryAttachments) DeleteById(ctx context.Context, transaction string, id string) error {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	attachment, err := store.attachment(transaction, id)
+	if err != nil {
+		return err
+	}
+	delete(store.attachments, attachment.Id)
+	return nil
+}
+
+// the attachment with id of transaction
+func (store *memoryStore) attachment(transaction string, id string) (Attachment, error) {
+	t, err := memoryId(transaction)
+	if err != nil {
+		return Attachment{}, err
+	}
+	n, err := memoryId(id)
+	if err != nil {
+		return Attachment{}, err
+	}
+	attachment, ok := store.attachments[n]
+	if !ok || attachment.Transaction != t {
+		return Attachment{}, memoryNotFound()
+	}
+	return attachment, nil
+}
+
+func (repository memoryAttachments) Read(ctx context.Context, transaction string) ([]Attachment, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	attachments := []Attachment{}
+	t, err := memoryId(transaction)
+	if err != nil {
+		return attachments, nil
+	}
+	for _, attachment := range store.attachments {
+		if attachment.Transaction == t {
+			attachments = append(attachments, attachment)
+		}
+	}
+	sort.Slice(attachments, func(i, j int) bool { return attachments[i].Id < attachments[j].Id })
+	return attachments, nil
+}
+
+func (repository memoryAttachments) ReadById(ctx context.Context, transaction string, id string) (Attachment, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return store.attachment(transaction, id)
+}
+
+func (repository memoryAttachments) Write(ctx context.Context, attachment *Attachment) (int64, error) {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.transactions[attachment.Transaction]; !ok {
+		return 0, memoryViolation(ErrForeignKey, "Key (transaction)=(%d) is not present in table \"transaction\".", attachment.Transaction)
+	}
+	store.lastAttachment++
+	attachment.Id = store.lastAttachment
+	attachment.Created = time.Now()
+	store.attachments[attachment.Id] = *attachment
+	return attachment.Id, nil
+}
+
+type memoryReconciliations struct {
+	store *memoryStore
+}
+
+func (repository memoryReconciliations) ReadById(ctx context.Context, id string) (Reconciliation, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	n, err := memoryId(id)
+	if err != nil {
+		return Reconciliation{}, err
+	}
+	reconciliation, ok := store.reconciliations[n]
+	if !ok {
+		return Reconciliation{}, memoryNotFound()
+	}
+	return reconciliation, nil
+}
+
+func (repository memoryReconciliations) Write(ctx context.Context, reconciliation *Reconciliation) (int64, error) {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.accounts[reconciliation.Account]; !ok {
+		return 0, memoryViolation(ErrForeignKey, "Key (account)=(%d) is not present in table \"account\".", reconciliation.Account)
+	}
+	store.lastReconciliation++
+	reconciliation.Id = store.lastReconciliation
+	reconciliation.From = memoryDate(reconciliation.From)
+	reconciliation.To = memoryDate(reconciliation.To)
+	reconciliation.Created = time.Now()
+	store.reconciliations[reconciliation.Id] = *reconciliation
+	return reconciliation.Id, nil
+}
+
+type memoryStatementLines struct {
+	store *memoryStore
+}
+
+// a copy of a stored statement line, not sharing its transaction
+func (store *memoryStore) statementLine(id int64) (StatementLine, bool) {
+	line, ok := store.statementLines[id]
+	if line.Transaction != nil {
+		transaction := *line.Transaction
+		line.Transaction = &transaction
+	}
+	return line, ok
+}
+
+func (repository memoryStatementLines) Ignore(ctx context.Context, line *StatementLine) error {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	stored, ok := store.statementLines[line.Id]
+	if !ok || stored.Status != StatementLineOpen {
+		return conflict("statement line %d is not open", line.Id)
+	}
+	stored.Status = StatementLineIgnored
+	store.statementLines[line.Id] = stored
+	line.Status = StatementLineIgnored
+	return nil
+}
+
+func (repository memoryStatementLines) Link(ctx context.Context, line *StatementLine, transaction int64) error {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	linked, ok := store.transactions[transaction]
+	if !ok {
+		return memoryViolation(ErrForeignKey, "Key (transaction)=(%d) is not present in table \"transaction\".", transaction)
+	}
+	if linked.Reconciled {
+		return conflict("transaction %d is already reconciled", transaction)
+	}
+	stored, ok := store.statementLines[line.Id]
+	if !ok || stored.Status != StatementLineOpen {
+		return conflict("statement line %d is not open", line.Id)
+	}
+	stored.Status = StatementLineLinked
+	stored.Transaction = &transaction
+	store.statementLines[line.Id] = stored
+	linked.Reconciled = true
+	store.transactions[transaction] = linked
+
+	line.Status = StatementLineLinked
+	line.Transaction = &transaction
+	return nil
+}
+
+func (repository memoryStatementLines) Read(ctx context.Context, reconciliation int64) ([]StatementLine, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	lines := []StatementLine{}
+	for id := range store.statementLines {
+		if line, _ := store.statementLine(id); line.Reconciliation == reconciliation {
+			lines = append(lines, line)
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].Line < lines[j].Line })
+	return lines, nil
+}
+
+func (repository memoryStatementLines) ReadById(ctx context.Context, reconciliation int64, id int64) (StatementLine, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	line, ok := store.statementLine(id)
+	if !ok || line.Reconciliation != reconciliation {
+		return StatementLine{}, memoryNotFound()
+	}
+	return line, nil
+}
+
+func (repository memoryStatementLines) UnlinkTransaction(ctx context.Context, transaction int64) error {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for id, line := range store.statementLines {
+		if line.Transaction != nil && *line.Transaction == transaction {
+			line.Status = StatementLineOpen
+			line.Transaction = nil
+			store.statementLines[id] = line
+		}
+	}
+	if unlinked, ok := store.transactions[transaction]; ok {
+		unlinked.Reconciled = false
+		store.transactions[transaction] = unlinked
+	}
+	return nil
+}
+
+func (repository memoryStatementLines) Write(ctx context.Context, line *StatementLine) (int64, error) {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.reconciliations[line.Reconciliation]; !ok {
+		return 0, memoryViolation(ErrForeignKey, "Key (reconciliation)=(%d) is not present in table \"reconciliation\".", line.Reconciliation)
+	}
+	if line.Transaction != nil {
+		if _, ok := store.transactions[*line.Transaction]; !ok {
+			return 0, memoryViolation(ErrForeignKey, "Key (transaction)=(%d) is not present in table \"transaction\".", *line.Transaction)
+		}
+	}
+	if len(line.Status) == 0 {
+		line.Status = StatementLineOpen
+	}
+	store.lastStatementLine++
+	line.Id = store.lastStatementLine
+	line.Date = memoryDate(line.Date)
+	stored := *line
+	if line.Transaction != nil {
+		transaction := *line.Transaction
+		stored.Transaction = &transaction
+	}
+	store.statementLines[line.Id] = stored
+	return line.Id, nil
+}
+
+type memoryCsvProfiles struct {
+	store *memoryStore
+}
+
+// the name of a csv profile is unique
+func (store *memoryStore) checkCsvProfile(profile *CsvProfile) error {
+	for _, other := range store.csvProfiles {
+		if other.Name == profile.Name && other.Id != profile.Id {
+			return memoryViolation(ErrConflict, "Key (name)=(%s) already exists.", profile.Name)
+		}
+	}
+	return nil
+}
+
+func (repository memoryCsvProfiles) DeleteByName(ctx context.Context, name string) error {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for id, profile := range store.csvProfiles {
+		if profile.Name == name {
+			delete(store.csvProfiles, id)
+			return nil
+		}
+	}
+	return memoryNotFound()
+}
+
+func (repository memoryCsvProfiles) Read(ctx context.Context, limit int64) ([]CsvProfile, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	profiles := []CsvProfile{}
+	for _, profile := range store.csvProfiles {
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	if limit > 0 && int64(len(profiles)) > limit {
+		profiles = profiles[:limit]
+	}
+	return profiles, nil
+}
+
+func (repository memoryCsvProfiles) ReadByName(ctx context.Context, name string) (CsvProfile, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	for _, profile := range store.csvProfiles {
+		if profile.Name == name {
+			return profile, nil
+		}
+	}
+	return CsvProfile{}, memoryNotFound()
+}
+
+func (repository memoryCsvProfiles) Update(ctx context.Context, profile *CsvProfile) (int64, error) {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if profile.Id == 0 {
+		return 0, invalid("identification for csvprofile is missing")
+	}
+	if err := store.checkCsvProfile(profile); err != nil {
+		return 0, err
+	}
+	if _, ok := store.csvProfiles[profile.Id]; ok {
+		store.csvProfiles[profile.Id] = *profile
+	}
+	return profile.Id, nil
+}
+
+func (repository memoryCsvProfiles) Write(ctx context.Context, profile *CsvProfile) (int64, error) {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	profile.Id = 0
+	if err := store.checkCsvProfile(profile); err != nil {
+		return 0, err
+	}
+	store.lastCsvProfile++
+	profile.Id = store.lastCsvProfile
+	store.csvProfiles[profile.Id] = *profile
+	return profile.Id, nil
+}
+
+type memoryAudits struct {
+	store *memoryStore
+}
+
+func (repository memoryAudits) Read(ctx context.Context, entity string, id int64, from time.Time, to time.Time, limit int64) ([]Audit, error) {
+	store := repository.store
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	audits := []Audit{}
+	for i := len(store.audits) - 1; i >= 0 && (limit == 0 || int64(len(audits)) < limit); i-- {
+		audit := store.audits[i]
+		if (len(entity) == 0 || audit.Entity == entity) && (id == 0 || audit.EntityId == id) &&
+			(from.IsZero() || !audit.Created.Before(from)) && (to.IsZero() || audit.Created.Before(to)) {
+			audits = append(audits, audit)
+		}
+	}
+	return audits, nil
+}
+
+// The audit is append-only, a record is never changed after it is written
+func (repository memoryAudits) Write(ctx context.Context, audit *Audit) (int64, error) {
+	store := repository.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	audit.Id = int64(len(store.audits)) + 1
+	audit.Created = time.Now()
+	store.audits = append(store.audits, *audit)
+	return audit.Id, nil
+}
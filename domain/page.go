@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+)
+
+// A page of a list, ordered by id descending unless another order is given.
+// The next page starts after the last id of the previous page, so rows added meanwhile do not shift the pages.
+type Page struct {
+	After     int64  // id after which the page starts, 0 starts at the beginning
+	Limit     int64  // maximum number of rows, 0 is no maximum
+	Count     bool   // count all rows matching the criteria in Total
+	Sort      string // column to order by with id as tie breaker, empty is id. Must be a known column of the list
+	Ascending bool   // order ascending instead of descending
+	Next      int64  // set by reading, id after which the next page starts, 0 when this is the last page
+	Total     int64  // set by reading when Count is requested
+}
+
+// count the rows of the query, only when requested
+func (page *Page) count(ctx context.Context, dbpool Db, q *query) error {
+	var err error
+
+	if !page.Count {
+		return nil
+	}
+
+	page.Total, err = q.count(ctx, dbpool)
+	if err != nil {
+		log.WithFields(log.Fields{"table": q.table, "error": err}).Error("Count page - reading result error")
+	}
+	return err
+}
+
+// add the keyset condition, order and limit of the page to the query. The sort column must be one of columns,
+// which maps it to the expression ordering it, id is always known. The sort is never a parameter of the sql.
+// One row more than the limit is read to know if there is a next page.
+func (page *Page) apply(q *query, columns map[string]string) (*query, error) {
+	var direction string = "desc"
+	var comparison string = "<"
+
+	if page.Ascending {
+		direction = "asc"
+		comparison = ">"
+	}
+
+	if len(page.Sort) == 0 || page.Sort == "id" {
+		if page.After > 0 {
+			q.where("id "+comparison+" ?", page.After)
+		}
+		q.order("id " + direction)
+	} else {
+		sort, ok := columns[page.Sort]
+		if !ok {
+			return q, invalid("unknown sort column %s", page.Sort)
+		}
+		if page.After > 0 {
+			// continue after the sort value of the last row, rows with an equal value by id. The expression
+			// has a value for every row, a null would compare as unknown and end the list
+			q.where("("+sort+", id) "+comparison+" (SELECT "+sort+", id from "+q.table+" where id = ?)", page.After)
+		}
+		q.order(sort + " " + direction + ", id " + direction)
+	}
+	if page.Limit > 0 {
+		q.limitTo(page.Limit + 1)
+	}
+	return q, nil
+}
+
+// drop the extra row read for clause and set Next
+func pageRows[T any](page *Page, rows []T, id func(T) int64) []T {
+	page.Next = 0
+	if page.Limit > 0 && int64(len(rows)) > page.Limit {
+		rows = rows[:page.Limit]
+		page.Next = id(rows[len(rows)-1])
+	}
+	return rows
+}
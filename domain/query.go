@@ -0,0 +1,169 @@
+package domain
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// The sql of a database, conditions are written in the sql both postgres and sqlite understand
+// and the differences are added by the methods of query
+type dialect int
+
+const (
+	postgresDialect dialect = iota
+	sqliteDialect
+)
+
+// A select on one table built from conditions.
+// Values are never part of the sql, each ? in a condition is bound to the next value.
+// Table, column and order names are written in code, they never come from a request.
+type query struct {
+	dialect    dialect
+	table      string
+	columns    string
+	columnArgs []any
+	conditions []string
+	args       []any
+	orderBy    string
+	limit      int64
+}
+
+func selectFrom(table string) *query {
+	return &query{table: table, columns: "*"}
+}
+
+func sqliteSelectFrom(table string) *query {
+	return &query{dialect: sqliteDialect, table: table, columns: "*"}
+}
+
+// select columns instead of all columns, each ? is bound to the next of values
+func (q *query) selecting(columns string, values ...any) *query {
+	q.columns = columns
+	q.columnArgs = values
+	return q
+}
+
+// add a condition, each ? is bound to the next of values
+func (q *query) where(condition string, values ...any) *query {
+	q.conditions = append(q.conditions, condition)
+	q.args = append(q.args, values...)
+	return q
+}
+
+// add the condition that column is one of values, no values selects nothing
+func (q *query) whereIn(column string, values []int64) *query {
+	if len(values) == 0 {
+		return q.where("1 = 0")
+	}
+	args := make([]any, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return q.where(column+" in ("+placeholders(len(values))+")", args...)
+}
+
+// add the condition that the text of column contains value, case insensitive
+func (q *query) whereContains(column string, value string) *query {
+	if q.dialect == sqliteDialect {
+		return q.where("instr(lower("+column+"), lower(?)) > 0", value)
+	}
+	return q.where("strpos(lower("+column+"), lower(?)) > 0", value)
+}
+
+func (q *query) order(orderBy string) *query {
+	q.orderBy = orderBy
+	return q
+}
+
+// the condition added to a select of one row by key that leaves out a soft deleted row, unless it is included
+func undeleted(includeDeleted bool) string {
+	if includeDeleted {
+		return ""
+	}
+	return " and deleted is null"
+}
+
+// maximum number of rows, 0 is no maximum
+func (q *query) limitTo(limit int64) *query {
+	q.limit = limit
+	return q
+}
+
+// sql and values of the query
+func (q *query) sql() (string, []any) {
+	var sql strings.Builder
+	args := append(append([]any{}, q.columnArgs...), q.args...)
+
+	sql.WriteString("SELECT " + q.columns + " from " + q.table)
+	for i, condition := range q.conditions {
+		if i == 0 {
+			sql.WriteString(" where ")
+		} else {
+			sql.WriteString(" and ")
+		}
+		sql.WriteString(condition)
+	}
+	if len(q.orderBy) > 0 {
+		sql.WriteString(" order by " + q.orderBy)
+	}
+	if q.limit > 0 {
+		args = append(args, q.limit)
+		sql.WriteString(" limit ?")
+	}
+	if q.dialect == sqliteDialect {
+		return sql.String(), args
+	}
+	return numberPlaceholders(sql.String()), args
+}
+
+// n placeholders separated by commas
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// replace the ? placeholders by the numbered placeholders $1, $2, ... of postgres
+func numberPlaceholders(sql string) string {
+	var numbered strings.Builder
+	var n int
+
+	for _, r := range sql {
+		if r == '?' {
+			n++
+			numbered.WriteString("$" + strconv.Itoa(n))
+		} else {
+			numbered.WriteRune(r)
+		}
+	}
+	return numbered.String()
+}
+
+func (q *query) rows(ctx context.Context, dbpool Db) (pgx.Rows, error) {
+	sql, args := q.sql()
+	log.WithFields(log.Fields{"query": sql}).Trace("Query")
+	return dbpool.Query(ctx, sql, args...)
+}
+
+// lock the row of table with the id until the end of the transaction of dbpool, outside a transaction only for the statement
+func lockRow(ctx context.Context, dbpool Db, table string, id string) error {
+	var locked int64
+	err := dbpool.QueryRow(ctx, "SELECT id from "+table+" where id = $1 FOR UPDATE", id).Scan(&locked)
+	return dbErr(err)
+}
+
+// number of rows matching the conditions, order and limit are ignored
+func (q *query) count(ctx context.Context, dbpool Db) (int64, error) {
+	var count int64
+
+	counter := *q
+	counter.columns = "count(*)"
+	counter.columnArgs = nil
+	counter.orderBy = ""
+	counter.limit = 0
+	sql, args := counter.sql()
+	err := dbpool.QueryRow(ctx, sql, args...).Scan(&count)
+	return count, err
+}
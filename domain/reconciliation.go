@@ -0,0 +1,362 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// Status of a statement line
+const (
+	StatementLineOpen    = "open"
+	StatementLineLinked  = "linked"
+	StatementLineIgnored = "ignored"
+)
+
+// A bank statement of an account for a period, to be reconciled with the transactions
+type Reconciliation struct {
+	Id      int64     `json:"id"`
+	Account int64     `json:"account"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Created time.Time `json:"created"`
+}
+
+// A line of a bank statement, a negative amount leaves the account
+type StatementLine struct {
+	Id             int64     `json:"id"`
+	Reconciliation int64     `json:"reconciliation"`
+	Line           int       `json:"line"`
+	Date           time.Time `json:"date"`
+	Amount         int64     `json:"amount"`
+	Counterparty   string    `json:"counterparty"`
+	Description    string    `json:"description"`
+	Status         string    `json:"status"`
+	Transaction    *int64    `json:"transaction"`
+}
+
+// A statement line matched with a transaction, suggested matches are not confirmed yet
+type ReconciliationMatch struct {
+	Line        StatementLine `json:"line"`
+	Transaction Transaction   `json:"transaction"`
+	Suggested   bool          `json:"suggested"`
+	Score       float64       `json:"score"`
+}
+
+type ReconciliationReport struct {
+	Reconciliation  Reconciliation        `json:"reconciliation"`
+	Matched         []ReconciliationMatch `json:"matched"`
+	UnmatchedBank   []StatementLine       `json:"unmatchedbank"`
+	UnmatchedLedger []Transaction         `json:"unmatchedledger"`
+	Ignored         []StatementLine       `json:"ignored"`
+}
+
+// Body of the link, create and ignore actions on a reconciliation
+type ReconciliationAction struct {
+	Line        int64 `json:"line"`
+	Transaction int64 `json:"transaction"`
+	Target      int64 `json:"target"`
+}
+
+type IReconciliation interface {
+	ReadById(ctx context.Context, dbpool Db, id string) (Reconciliation, error)
+	Write(ctx context.Context, dbpool Db) (int64, error)
+}
+
+type IStatementLine interface {
+	Read(ctx context.Context, dbpool Db, reconciliation int64) ([]StatementLine, error)
+	ReadById(ctx context.Context, dbpool Db, reconciliation int64, id int64) (StatementLine, error)
+	Write(ctx context.Context, dbpool Db) (int64, error)
+	Link(ctx context.Context, dbpool Db, transaction int64) error
+	Ignore(ctx context.Context, dbpool Db) error
+	UnlinkTransaction(ctx context.Context, dbpool Db, transaction int64) error
+}
+
+func (reconciliation *Reconciliation) ReadById(ctx context.Context, dbpool Db, id string) (Reconciliation, error) {
+	var rec Reconciliation
+
+	rows := dbpool.QueryRow(ctx, "SELECT * from reconciliation where id = $1", id)
+
+	err := rows.Scan(&rec.Id, &rec.Account, &rec.From, &rec.To, &rec.Created)
+	log.WithFields(log.Fields{"error": err, "reconciliation": rec}).Trace("Read reconciliation - reading result after scan error")
+
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) { // wrong id, functional error
+		log.WithFields(log.Fields{"id": id, "error": err}).Error("Read reconciliation - reading result error")
+	}
+	return rec, dbErr(err)
+}
+
+func (reconciliation *Reconciliation) Write(ctx context.Context, dbpool Db) (int64, error) {
+	var lastInsertedId int64 = 0
+
+	err := dbpool.QueryRow(ctx,
+		"INSERT INTO reconciliation (account, period_from, period_to) VALUES ($1, $2, $3) RETURNING id, created",
+		reconciliation.Account, reconciliation.From, reconciliation.To).Scan(&lastInsertedId, &reconciliation.Created)
+
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "reconciliation": reconciliation}).Error("addReconciliation: Error during insert reconciliation")
+		return 0, fmt.Errorf("addReconciliation insert: %w", dbErr(err))
+	}
+
+	reconciliation.Id = lastInsertedId
+	return lastInsertedId, nil
+}
+
+func (line *StatementLine) scan(row pgx.Row) error {
+	return row.Scan(&line.Id, &line.Reconciliation, &line.Line, &line.Date, &line.Amount,
+		&line.Counterparty, &line.Description, &line.Status, &line.Transaction)
+}
+
+func (line *StatementLine) Read(ctx context.Context, dbpool Db, reconciliation int64) ([]StatementLine, error) {
+	lines := []StatementLine{}
+
+	rows, err := dbpool.Query(ctx, "SELECT * from statementline where reconciliation = $1 order by line", reconciliation)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Read statementline - reading result error")
+		return lines, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		statementLine := StatementLine{}
+		err = statementLine.scan(rows)
+
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Read statementline - reading result error")
+			return lines, err
+		}
+		lines = append(lines, statementLine)
+	}
+	return lines, rows.Err()
+}
+
+func (line *StatementLine) ReadById(ctx context.Context, dbpool Db, reconciliation int64, id int64) (StatementLine, error) {
+	var statementLine StatementLine
+
+	err := statementLine.scan(dbpool.QueryRow(ctx, "SELECT * from statementline where reconciliation = $1 and id = $2", reconciliation, id))
+
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) { // wrong id, functional error
+		log.WithFields(log.Fields{"id": id, "error": err}).Error("Read statementline - reading result error")
+	}
+	return statementLine, dbErr(err)
+}
+
+func (line *StatementLine) Write(ctx context.Context, dbpool Db) (int64, error) {
+	var lastInsertedId int64 = 0
+
+	if len(line.Status) == 0 {
+		line.Status = StatementLineOpen
+	}
+
+	err := dbpool.QueryRow(ctx,
+		`INSERT INTO statementline (reconciliation, line, date, amount, counterparty, description, status, transaction)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+		line.Reconciliation, line.Line, line.Date, line.Amount, line.Counterparty, line.Description, line.Status, line.Transaction).Scan(&lastInsertedId)
+
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "statementline": line}).Error("addStatementLine: Error during insert statementline")
+		return 0, fmt.Errorf("addStatementLine insert: %w", dbErr(err))
+	}
+
+	line.Id = lastInsertedId
+	return lastInsertedId, nil
+}
+
+// Link the line to transaction and mark the transaction reconciled
+func (line *StatementLine) Link(ctx context.Context, dbpool Db, transaction int64) error {
+	tx, err := dbpool.Begin(ctx)
+	if err != nil {
+		return dbErr(err)
+	}
+	defer tx.Rollback(ctx)
+
+	// a line is linked once, also when two links are made at the same time
+	tag, err := tx.Exec(ctx, "UPDATE statementline set status = $2, transaction = $3 where id = $1 and status = $4", line.Id, StatementLineLinked, transaction, StatementLineOpen)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = conflict("statement line %d is not open", line.Id)
+	}
+	if err == nil {
+		// a transaction is linked to one statement line, also when two links are made at the same time
+		tag, err = tx.Exec(ctx, "UPDATE transaction set reconciled = true where id = $1 and reconciled = false", transaction)
+		if err == nil && tag.RowsAffected() == 0 {
+			err = conflict("transaction %d is already reconciled", transaction)
+		}
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "statementline": line, "transaction": transaction}).Error("link statementline: Error during update")
+		return fmt.Errorf("link statementline: %w", dbErr(err))
+	}
+
+	line.Status = StatementLineLinked
+	line.Transaction = &transaction
+	return tx.Commit(ctx)
+}
+
+func (line *StatementLine) Ignore(ctx context.Context, dbpool Db) error {
+	tag, err := dbpool.Exec(ctx, "UPDATE statementline set status = $2 where id = $1 and status = $3", line.Id, StatementLineIgnored, StatementLineOpen)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = conflict("statement line %d is not open", line.Id)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "statementline": line}).Error("ignore statementline: Error during update")
+		return fmt.Errorf("ignore statementline: %w", dbErr(err))
+	}
+
+	line.Status = StatementLineIgnored
+	return nil
+}
+
+// Mark the transaction not reconciled and reopen the lines linked to it
+func (line *StatementLine) UnlinkTransaction(ctx context.Context, dbpool Db, transaction int64) error {
+	tx, err := dbpool.Begin(ctx)
+	if err != nil {
+		return dbErr(err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "UPDATE statementline set status = $2, transaction = null where transaction = $1", transaction, StatementLineOpen)
+	if err == nil {
+		_, err = tx.Exec(ctx, "UPDATE transaction set reconciled = false where id = $1", transaction)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "transaction": transaction}).Error("unlink transaction: Error during update")
+		return fmt.Errorf("unlink transaction: %w", dbErr(err))
+	}
+
+	return tx.Commit(ctx)
+}
+
+func descriptionWords(description string) map[string]bool {
+	words := map[string]bool{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(description), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words[word] = true
+	}
+	return words
+}
+
+// Share of words the descriptions have in common, between 0 and 1
+func descriptionSimilarity(a string, b string) float64 {
+	wordsA := descriptionWords(a)
+	wordsB := descriptionWords(b)
+
+	common := 0
+	for word := range wordsA {
+		if wordsB[word] {
+			common++
+		}
+	}
+
+	total := len(wordsA) + len(wordsB) - common
+	if total == 0 {
+		return 0
+	}
+	return float64(common) / float64(total)
+}
+
+func daysBetween(a time.Time, b time.Time) int {
+	days := int(a.Sub(b).Hours() / 24)
+	if days < 0 {
+		return -days
+	}
+	return days
+}
+
+// Match statement lines with the transactions of the account of the reconciliation.
+// Linked lines are matched with their transaction. Open lines are matched with a
+// transaction with the same amount within window days, the best match on date and
+// description wins. Transactions outside the period are only used for matching.
+func (reconciliation *Reconciliation) Match(lines []StatementLine, transactions []Transaction, window int) ReconciliationReport {
+	report := ReconciliationReport{
+		Reconciliation:  *reconciliation,
+		Matched:         []ReconciliationMatch{},
+		UnmatchedBank:   []StatementLine{},
+		UnmatchedLedger: []Transaction{},
+		Ignored:         []StatementLine{},
+	}
+
+	byId := map[int64]Transaction{}
+	for _, transaction := range transactions {
+		byId[transaction.Id] = transaction
+	}
+
+	usedLines := map[int64]bool{}
+	usedTransactions := map[int64]bool{}
+
+	type candidate struct {
+		line        StatementLine
+		transaction Transaction
+		score       float64
+	}
+	candidates := []candidate{}
+
+	for _, line := range lines {
+		switch line.Status {
+		case StatementLineIgnored:
+			report.Ignored = append(report.Ignored, line)
+			usedLines[line.Id] = true
+		case StatementLineLinked:
+			if line.Transaction != nil {
+				report.Matched = append(report.Matched, ReconciliationMatch{Line: line, Transaction: byId[*line.Transaction], Score: 1})
+				usedTransactions[*line.Transaction] = true
+			}
+			usedLines[line.Id] = true
+		}
+	}
+
+	for _, line := range lines {
+		if usedLines[line.Id] {
+			continue
+		}
+		for _, transaction := range transactions {
+			if usedTransactions[transaction.Id] || transaction.Reconciled {
+				continue
+			}
+			if transaction.SignedAmount(reconciliation.Account) != line.Amount {
+				continue
+			}
+			days := daysBetween(line.Date, transaction.Date)
+			if days > window {
+				continue
+			}
+			score := 0.5*(1-float64(days)/float64(window+1)) + 0.5*descriptionSimilarity(line.Counterparty+" "+line.Description, transaction.Description)
+			candidates = append(candidates, candidate{line: line, transaction: transaction, score: score})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	for _, candidate := range candidates {
+		if usedLines[candidate.line.Id] || usedTransactions[candidate.transaction.Id] {
+			continue
+		}
+		usedLines[candidate.line.Id] = true
+		usedTransactions[candidate.transaction.Id] = true
+		report.Matched = append(report.Matched, ReconciliationMatch{Line: candidate.line, Transaction: candidate.transaction, Suggested: true, Score: candidate.score})
+	}
+
+	for _, line := range lines {
+		if !usedLines[line.Id] {
+			report.UnmatchedBank = append(report.UnmatchedBank, line)
+		}
+	}
+
+	for _, transaction := range transactions {
+		if usedTransactions[transaction.Id] || transaction.Reconciled || transaction.Date.Before(reconciliation.From) || transaction.Date.After(reconciliation.To) {
+			continue
+		}
+		report.UnmatchedLedger = append(report.UnmatchedLedger, transaction)
+	}
+
+	return report
+}
@@ -0,0 +1,450 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// The postgres pool or a transaction of it, the methods of the domain run on both
+type Db interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Storage of accounts, the methods are those of IAccount without the pool
+type AccountRepository interface {
+	Balances(ctx context.Context, ids []int64) (map[int64]int64, error)
+	DeleteById(ctx context.Context, id string) error
+	Purge(ctx context.Context, before time.Time) ([]Account, error)
+	Read(ctx context.Context, number string, page *Page, includeDeleted bool) ([]Account, error)
+	ReadById(ctx context.Context, id string, includeDeleted bool) (Account, error)
+	ReadByIds(ctx context.Context, ids []int64) (map[int64]Account, error)
+	ReadByNumber(ctx context.Context, number string, includeDeleted bool) (Account, error)
+	ReadForUpdate(ctx context.Context, id string) (Account, error)
+	Restore(ctx context.Context, id string) error
+	Search(ctx context.Context, term string, config string, page *Page, includeDeleted bool) ([]AccountMatch, error)
+	Update(ctx context.Context, account *Account) (int64, error)
+	Write(ctx context.Context, account *Account) (int64, error)
+}
+
+// Storage of targets, the methods are those of ITarget without the pool
+type TargetRepository interface {
+	DeleteById(ctx context.Context, id string) error
+	Purge(ctx context.Context, before time.Time) ([]Target, error)
+	Read(ctx context.Context, name string, page *Page, includeDeleted bool) ([]Target, error)
+	ReadById(ctx context.Context, id string, includeDeleted bool) (Target, error)
+	ReadByIds(ctx context.Context, ids []int64) (map[int64]Target, error)
+	ReadByName(ctx context.Context, name string, includeDeleted bool) (Target, error)
+	ReadForUpdate(ctx context.Context, id string) (Target, error)
+	Restore(ctx context.Context, id string) error
+	Search(ctx context.Context, term string, config string, page *Page, includeDeleted bool) ([]TargetMatch, error)
+	Update(ctx context.Context, target *Target) (int64, error)
+	Write(ctx context.Context, target *Target) (int64, error)
+}
+
+// Storage of transactions and their tags, the methods are those of ITransaction without the pool
+type TransactionRepository interface {
+	AddTag(ctx context.Context, transaction *Transaction, tag string) error
+	DeleteById(ctx context.Context, id string) error
+	Read(ctx context.Context, filter TransactionFilter, page *Page) ([]Transaction, error)
+	ReadByAccount(ctx context.Context, account int64, from time.Time, to time.Time, tag string) ([]Transaction, error)
+	ReadById(ctx context.Context, id string) (Transaction, error)
+	ReadForUpdate(ctx context.Context, id string) (Transaction, error)
+	RemoveTag(ctx context.Context, transaction *Transaction, tag string) error
+	Search(ctx context.Context, term string, config string, page *Page) ([]TransactionMatch, error)
+	Update(ctx context.Context, transaction *Transaction) (int64, error)
+	Write(ctx context.Context, transaction *Transaction) (int64, error)
+}
+
+// Storage of tags, the methods are those of ITag without the pool
+type TagRepository interface {
+	Read(ctx context.Context) ([]Tag, error)
+}
+
+// Storage of the attachments of transactions, the methods are those of IAttachment without the pool
+type AttachmentRepository interface {
+	CountByHash(ctx context.Context, hash string) (int64, error)
+	DeleteById(ctx context.Context, transaction string, id string) error
+	Read(ctx context.Context, transaction string) ([]Attachment, error)
+	ReadById(ctx context.Context, transaction string, id string) (Attachment, error)
+	Write(ctx context.Context, attachment *Attachment) (int64, error)
+}
+
+// Storage of reconciliations, the methods are those of IReconciliation without the pool
+type ReconciliationRepository interface {
+	ReadById(ctx context.Context, id string) (Reconciliation, error)
+	Write(ctx context.Context, reconciliation *Reconciliation) (int64, error)
+}
+
+// Storage of statement lines, the methods are those of IStatementLine without the pool
+type StatementLineRepository interface {
+	Ignore(ctx context.Context, line *StatementLine) error
+	Link(ctx context.Context, line *StatementLine, transaction int64) error
+	Read(ctx context.Context, reconciliation int64) ([]StatementLine, error)
+	ReadById(ctx context.Context, reconciliation int64, id int64) (StatementLine, error)
+	UnlinkTransaction(ctx context.Context, transaction int64) error
+	Write(ctx context.Context, line *StatementLine) (int64, error)
+}
+
+// Storage of csv profiles, the methods are those of ICsvProfile without the pool
+type CsvProfileRepository interface {
+	DeleteByName(ctx context.Context, name string) error
+	Read(ctx context.Context, limit int64) ([]CsvProfile, error)
+	ReadByName(ctx context.Context, name string) (CsvProfile, error)
+	Update(ctx context.Context, profile *CsvProfile) (int64, error)
+	Write(ctx context.Context, profile *CsvProfile) (int64, error)
+}
+
+// Storage of the audit, the methods are those of IAudit without the pool
+type AuditRepository interface {
+	Read(ctx context.Context, entity string, id int64, from time.Time, to time.Time, limit int64) ([]Audit, error)
+	Write(ctx context.Context, audit *Audit) (int64, error)
+}
+
+// The repositories the server works with
+type Repositories struct {
+	Accounts        AccountRepository
+	Targets         TargetRepository
+	Transactions    TransactionRepository
+	Tags            TagRepository
+	Attachments     AttachmentRepository
+	Reconciliations ReconciliationRepository
+	StatementLines  StatementLineRepository
+	CsvProfiles     CsvProfileRepository
+	Audits          AuditRepository
+	atomic          func(ctx context.Context, work func(storage Repositories) error) error
+}
+
+// Run work with the repositories of one database transaction, it is committed when work returns nil and rolled back
+// when work returns an error. Work only uses the repositories it is given, within work Atomic nests.
+func (storage Repositories) Atomic(ctx context.Context, work func(storage Repositories) error) error {
+	return storage.atomic(ctx, work)
+}
+
+// Repositories of the postgres database of dbpool
+func PgRepositories(dbpool *pgxpool.Pool) Repositories {
+	return pgRepositories(dbpool)
+}
+
+func pgRepositories(dbpool Db) Repositories {
+	return Repositories{
+		Accounts:        pgAccounts{dbpool: dbpool},
+		Targets:         pgTargets{dbpool: dbpool},
+		Transactions:    pgTransactions{dbpool: dbpool},
+		Tags:            pgTags{dbpool: dbpool},
+		Attachments:     pgAttachments{dbpool: dbpool},
+		Reconciliations: pgReconciliations{dbpool: dbpool},
+		StatementLines:  pgStatementLines{dbpool: dbpool},
+		CsvProfiles:     pgCsvProfiles{dbpool: dbpool},
+		Audits:          pgAudits{dbpool: dbpool},
+		atomic: func(ctx context.Context, work func(storage Repositories) error) error {
+			// within a transaction Begin makes a savepoint
+			tx, err := dbpool.Begin(ctx)
+			if err != nil {
+				return dbErr(err)
+			}
+			defer tx.Rollback(ctx)
+
+			if err := work(pgRepositories(tx)); err != nil {
+				return err
+			}
+			return dbErr(tx.Commit(ctx))
+		},
+	}
+}
+
+type pgAccounts struct {
+	dbpool Db
+}
+
+func (repository pgAccounts) Balances(ctx context.Context, ids []int64) (map[int64]int64, error) {
+	account := Account{}
+	return account.Balances(ctx, repository.dbpool, ids)
+}
+
+func (repository pgAccounts) DeleteById(ctx context.Context, id string) error {
+	account := Account{}
+	return account.DeleteById(ctx, repository.dbpool, id)
+}
+
+func (repository pgAccounts) Purge(ctx context.Context, before time.Time) ([]Account, error) {
+	account := Account{}
+	return account.Purge(ctx, repository.dbpool, before)
+}
+
+func (repository pgAccounts) Read(ctx context.Context, number string, page *Page, includeDeleted bool) ([]Account, error) {
+	account := Account{}
+	return account.Read(ctx, repository.dbpool, number, page, includeDeleted)
+}
+
+func (repository pgAccounts) ReadById(ctx context.Context, id string, includeDeleted bool) (Account, error) {
+	account := Account{}
+	return account.ReadById(ctx, repository.dbpool, id, includeDeleted)
+}
+
+func (repository pgAccounts) ReadForUpdate(ctx context.Context, id string) (Account, error) {
+	account := Account{}
+	return account.ReadForUpdate(ctx, repository.dbpool, id)
+}
+
+func (repository pgAccounts) ReadByIds(ctx context.Context, ids []int64) (map[int64]Account, error) {
+	account := Account{}
+	return account.ReadByIds(ctx, repository.dbpool, ids)
+}
+
+func (repository pgAccounts) ReadByNumber(ctx context.Context, number string, includeDeleted bool) (Account, error) {
+	account := Account{}
+	return account.ReadByNumber(ctx, repository.dbpool, number, includeDeleted)
+}
+
+func (repository pgAccounts) Restore(ctx context.Context, id string) error {
+	account := Account{}
+	return account.Restore(ctx, repository.dbpool, id)
+}
+
+func (repository pgAccounts) Search(ctx context.Context, term string, config string, page *Page, includeDeleted bool) ([]AccountMatch, error) {
+	account := Account{}
+	return account.Search(ctx, repository.dbpool, term, config, page, includeDeleted)
+}
+
+func (repository pgAccounts) Update(ctx context.Context, account *Account) (int64, error) {
+	return account.Update(ctx, repository.dbpool)
+}
+
+func (repository pgAccounts) Write(ctx context.Context, account *Account) (int64, error) {
+	return account.Write(ctx, repository.dbpool)
+}
+
+type pgTargets struct {
+	dbpool Db
+}
+
+func (repository pgTargets) DeleteById(ctx context.Context, id string) error {
+	target := Target{}
+	return target.DeleteById(ctx, repository.dbpool, id)
+}
+
+func (repository pgTargets) Purge(ctx context.Context, before time.Time) ([]Target, error) {
+	target := Target{}
+	return target.Purge(ctx, repository.dbpool, before)
+}
+
+func (repository pgTargets) Read(ctx context.Context, name string, page *Page, includeDeleted bool) ([]Target, error) {
+	target := Target{}
+	return target.Read(ctx, repository.dbpool, name, page, includeDeleted)
+}
+
+func (repository pgTargets) ReadById(ctx context.Context, id string, includeDeleted bool) (Target, error) {
+	target := Target{}
+	return target.ReadById(ctx, repository.dbpool, id, includeDeleted)
+}
+
+func (repository pgTargets) ReadForUpdate(ctx context.Context, id string) (Target, error) {
+	target := Target{}
+	return target.ReadForUpdate(ctx, repository.dbpool, id)
+}
+
+func (repository pgTargets) ReadByIds(ctx context.Context, ids []int64) (map[int64]Target, error) {
+	target := Target{}
+	return target.ReadByIds(ctx, repository.dbpool, ids)
+}
+
+func (repository pgTargets) ReadByName(ctx context.Context, name string, includeDeleted bool) (Target, error) {
+	target := Target{}
+	return target.ReadByName(ctx, repository.dbpool, name, includeDeleted)
+}
+
+func (repository pgTargets) Restore(ctx context.Context, id string) error {
+	target := Target{}
+	return target.Restore(ctx, repository.dbpool, id)
+}
+
+func (repository pgTargets) Search(ctx context.Context, term string, config string, page *Page, includeDeleted bool) ([]TargetMatch, error) {
+	target := Target{}
+	return target.Search(ctx, repository.dbpool, term, config, page, includeDeleted)
+}
+
+func (repository pgTargets) Update(ctx context.Context, target *Target) (int64, error) {
+	return target.Update(ctx, repository.dbpool)
+}
+
+func (repository pgTargets) Write(ctx context.Context, target *Target) (int64, error) {
+	return target.Write(ctx, repository.dbpool)
+}
+
+type pgTransactions struct {
+	dbpool Db
+}
+
+func (repository pgTransactions) AddTag(ctx context.Context, transaction *Transaction, tag string) error {
+	return transaction.AddTag(ctx, repository.dbpool, tag)
+}
+
+func (repository pgTransactions) DeleteById(ctx context.Context, id string) error {
+	transaction := Transaction{}
+	return transaction.DeleteById(ctx, repository.dbpool, id)
+}
+
+func (repository pgTransactions) Read(ctx context.Context, filter TransactionFilter, page *Page) ([]Transaction, error) {
+	transaction := Transaction{}
+	return transaction.Read(ctx, repository.dbpool, filter, page)
+}
+
+func (repository pgTransactions) ReadByAccount(ctx context.Context, account int64, from time.Time, to time.Time, tag string) ([]Transaction, error) {
+	transaction := Transaction{}
+	return transaction.ReadByAccount(ctx, repository.dbpool, account, from, to, tag)
+}
+
+func (repository pgTransactions) ReadById(ctx context.Context, id string) (Transaction, error) {
+	transaction := Transaction{}
+	return transaction.ReadById(ctx, repository.dbpool, id)
+}
+
+func (repository pgTransactions) ReadForUpdate(ctx context.Context, id string) (Transaction, error) {
+	transaction := Transaction{}
+	return transaction.ReadForUpdate(ctx, repository.dbpool, id)
+}
+
+func (repository pgTransactions) RemoveTag(ctx context.Context, transaction *Transaction, tag string) error {
+	return transaction.RemoveTag(ctx, repository.dbpool, tag)
+}
+
+func (repository pgTransactions) Search(ctx context.Context, term string, config string, page *Page) ([]TransactionMatch, error) {
+	transaction := Transaction{}
+	return transaction.Search(ctx, repository.dbpool, term, config, page)
+}
+
+func (repository pgTransactions) Update(ctx context.Context, transaction *Transaction) (int64, error) {
+	return transaction.Update(ctx, repository.dbpool)
+}
+
+func (repository pgTransactions) Write(ctx context.Context, transaction *Transaction) (int64, error) {
+	return transaction.Write(ctx, repository.dbpool)
+}
+
+type pgTags struct {
+	dbpool Db
+}
+
+func (repository pgTags) Read(ctx context.Context) ([]Tag, error) {
+	tag := Tag{}
+	return tag.Read(ctx, repository.dbpool)
+}
+
+type pgAttachments struct {
+	dbpool Db
+}
+
+func (repository pgAttachments) CountByHash(ctx context.Context, hash string) (int64, error) {
+	attachment := Attachment{}
+	return attachment.CountByHash(ctx, repository.dbpool, hash)
+}
+
+func (repository pgAttachments) DeleteById(ctx context.Context, transaction string, id string) error {
+	attachment := Attachment{}
+	return attachment.DeleteById(ctx, repository.dbpool, transaction, id)
+}
+
+func (repository pgAttachments) Read(ctx context.Context, transaction string) ([]Attachment, error) {
+	attachment := Attachment{}
+	return attachment.Read(ctx, repository.dbpool, transaction)
+}
+
+func (repository pgAttachments) ReadById(ctx context.Context, transaction string, id string) (Attachment, error) {
+	attachment := Attachment{}
+	return attachment.ReadById(ctx, repository.dbpool, transaction, id)
+}
+
+func (repository pgAttachments) Write(ctx context.Context, attachment *Attachment) (int64, error) {
+	return attachment.Write(ctx, repository.dbpool)
+}
+
+type pgReconciliations struct {
+	dbpool Db
+}
+
+func (repository pgReconciliations) ReadById(ctx context.Context, id string) (Reconciliation, error) {
+	reconciliation := Reconciliation{}
+	return reconciliation.ReadById(ctx, repository.dbpool, id)
+}
+
+func (repository pgReconciliations) Write(ctx context.Context, reconciliation *Reconciliation) (int64, error) {
+	return reconciliation.Write(ctx, repository.dbpool)
+}
+
+type pgStatementLines struct {
+	dbpool Db
+}
+
+func (repository pgStatementLines) Ignore(ctx context.Context, line *StatementLine) error {
+	return line.Ignore(ctx, repository.dbpool)
+}
+
+func (repository pgStatementLines) Link(ctx context.Context, line *StatementLine, transaction int64) error {
+	return line.Link(ctx, repository.dbpool, transaction)
+}
+
+func (repository pgStatementLines) Read(ctx context.Context, reconciliation int64) ([]StatementLine, error) {
+	line := StatementLine{}
+	return line.Read(ctx, repository.dbpool, reconciliation)
+}
+
+func (repository pgStatementLines) ReadById(ctx context.Context, reconciliation int64, id int64) (StatementLine, error) {
+	line := StatementLine{}
+	return line.ReadById(ctx, repository.dbpool, reconciliation, id)
+}
+
+func (repository pgStatementLines) UnlinkTransaction(ctx context.Context, transaction int64) error {
+	line := StatementLine{}
+	return line.UnlinkTransaction(ctx, repository.dbpool, transaction)
+}
+
+func (repository pgStatementLines) Write(ctx context.Context, line *StatementLine) (int64, error) {
+	return line.Write(ctx, repository.dbpool)
+}
+
+type pgCsvProfiles struct {
+	dbpool Db
+}
+
+func (repository pgCsvProfiles) DeleteByName(ctx context.Context, name string) error {
+	profile := CsvProfile{}
+	return profile.DeleteByName(ctx, repository.dbpool, name)
+}
+
+func (repository pgCsvProfiles) Read(ctx context.Context, limit int64) ([]CsvProfile, error) {
+	profile := CsvProfile{}
+	return profile.Read(ctx, repository.dbpool, limit)
+}
+
+func (repository pgCsvProfiles) ReadByName(ctx context.Context, name string) (CsvProfile, error) {
+	profile := CsvProfile{}
+	return profile.ReadByName(ctx, repository.dbpool, name)
+}
+
+func (repository pgCsvProfiles) Update(ctx context.Context, profile *CsvProfile) (int64, error) {
+	return profile.Update(ctx, repository.dbpool)
+}
+
+func (repository pgCsvProfiles) Write(ctx context.Context, profile *CsvProfile) (int64, error) {
+	return profile.Write(ctx, repository.dbpool)
+}
+
+type pgAudits struct {
+	dbpool Db
+}
+
+func (repository pgAudits) Read(ctx context.Context, entity string, id int64, from time.Time, to time.Time, limit int64) ([]Audit, error) {
+	audit := Audit{}
+	return audit.Read(ctx, repository.dbpool, entity, id, from, to, limit)
+}
+
+func (repository pgAudits) Write(ctx context.Context, audit *Audit) (int64, error) {
+	return audit.Write(ctx, repository.dbpool)
+}
@@ -0,0 +1,524 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bank/migrations"
+	"github.com/bank/util"
+	"github.com/jackc/pgx/v4/pgxpool"
+	_ "modernc.org/sqlite"
+)
+
+// Run test against every storage, postgres only when TEST_DATABASE_URL is set as the test writes into the database
+func eachStorage(t *testing.T, test func(t *testing.T, storage Repositories)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, MemoryRepositories())
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "bank.db")
+		db, err := util.SqliteOpen(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if _, err := migrations.Up(context.Background(), migrations.Sqlite(db)); err != nil {
+			t.Fatal(err)
+		}
+		test(t, SqliteRepositories(db))
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		url := os.Getenv("TEST_DATABASE_URL")
+		if len(url) == 0 {
+			t.Skip("TEST_DATABASE_URL is not set")
+		}
+		dbpool, err := pgxpool.Connect(context.Background(), url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dbpool.Close()
+		if _, err := migrations.Up(context.Background(), migrations.Postgres(dbpool)); err != nil {
+			t.Fatal(err)
+		}
+		test(t, PgRepositories(dbpool))
+	})
+}
+
+// name made unique, the postgres database keeps the rows of former runs
+func unique(name string) string {
+	return name + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+func id(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+// a transaction between two new accounts
+func writeTransaction(t *testing.T, storage Repositories) Transaction {
+	ctx := context.Background()
+
+	from := Account{Number: unique("NL01FROM"), Description: "from"}
+	to := Account{Number: unique("NL01TO"), Description: "to"}
+	target := Target{Name: unique("groceries")}
+	if _, err := storage.Accounts.Write(ctx, &from); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Accounts.Write(ctx, &to); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Targets.Write(ctx, &target); err != nil {
+		t.Fatal(err)
+	}
+
+	transaction := Transaction{From_account: from.Id, To_account: to.Id, Target: target.Id, Amount: 1250,
+		Description: "weekly shopping", Date: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}
+	if _, err := storage.Transactions.Write(ctx, &transaction); err != nil {
+		t.Fatal(err)
+	}
+	return transaction
+}
+
+func TestAccountRepository(t *testing.T) {
+	eachStorage(t, func(t *testing.T, storage Repositories) {
+		ctx := context.Background()
+
+		account := Account{Number: unique("NL01BANK"), Description: "savings"}
+		if _, err := storage.Accounts.Write(ctx, &account); err != nil {
+			t.Fatal(err)
+		}
+		duplicate := Account{Number: account.Number}
+		if _, err := storage.Accounts.Write(ctx, &duplicate); !errors.Is(err, ErrConflict) {
+			t.Errorf("write of a duplicate number: got %v, want %v", err, ErrConflict)
+		}
+
+		read, err := storage.Accounts.ReadByNumber(ctx, account.Number, false)
+		if err != nil || read.Id != account.Id || read.Description != "savings" {
+			t.Errorf("read by number: got %+v, %v", read, err)
+		}
+
+		if err := storage.Accounts.DeleteById(ctx, id(account.Id)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := storage.Accounts.ReadById(ctx, id(account.Id), false); !errors.Is(err, ErrNotFound) {
+			t.Errorf("read of a deleted account: got %v, want %v", err, ErrNotFound)
+		}
+		if err := storage.Accounts.Restore(ctx, id(account.Id)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := storage.Accounts.ReadById(ctx, id(account.Id), false); err != nil {
+			t.Errorf("read of a restored account: %v", err)
+		}
+	})
+}
+
+func TestTransactionRepository(t *testing.T) {
+	eachStorage(t, func(t *testing.T, storage Repositories) {
+		ctx := context.Background()
+		transaction := writeTransaction(t, storage)
+
+		tag := unique("holiday")
+		if err := storage.Transactions.AddTag(ctx, &transaction, tag); err != nil {
+			t.Fatal(err)
+		}
+		read, err := storage.Transactions.ReadById(ctx, id(transaction.Id))
+		if err != nil || read.Amount != 1250 || len(read.Tags) != 1 || read.Tags[0] != tag {
+			t.Errorf("read by id: got %+v, %v", read, err)
+		}
+
+		tags, err := storage.Tags.Read(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found := findTag(tags, tag); found == nil || found.Transactions != 1 {
+			t.Errorf("tag %s: got %+v", tag, found)
+		}
+
+		if err := storage.Transactions.DeleteById(ctx, id(transaction.Id)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := storage.Transactions.ReadById(ctx, id(transaction.Id)); !errors.Is(err, ErrNotFound) {
+			t.Errorf("read of a deleted transaction: got %v, want %v", err, ErrNotFound)
+		}
+		if err := storage.Transactions.DeleteById(ctx, id(transaction.Id)); !errors.Is(err, ErrNotFound) {
+			t.Errorf("second delete: got %v, want %v", err, ErrNotFound)
+		}
+	})
+}
+
+func findTag(tags []Tag, name string) *Tag {
+	for i := range tags {
+		if tags[i].Name == name {
+			return &tags[i]
+		}
+	}
+	return nil
+}
+
+func TestAttachmentRepository(t *testing.T) {
+	eachStorage(t, func(t *testing.T, storage Repositories) {
+		ctx := context.Background()
+		transaction := writeTransaction(t, storage)
+
+		hash := unique("hash")
+		attachment := Attachment{Transaction: transaction.Id, Filename: "receipt.pdf", ContentType: "application/pdf", Size: 3, Hash: hash}
+		if _, err := storage.Attachments.Write(ctx, &attachment); err != nil {
+			t.Fatal(err)
+		}
+		if attachment.Id == 0 || attachment.Created.IsZero() {
+			t.Errorf("write: got %+v", attachment)
+		}
+
+		read, err := storage.Attachments.ReadById(ctx, id(transaction.Id), id(attachment.Id))
+		if err != nil || read.Filename != "receipt.pdf" || read.Hash != hash {
+			t.Errorf("read by id: got %+v, %v", read, err)
+		}
+		if _, err := storage.Attachments.ReadById(ctx, id(transaction.Id+1000), id(attachment.Id)); !errors.Is(err, ErrNotFound) {
+			t.Errorf("read by id of another transaction: got %v, want %v", err, ErrNotFound)
+		}
+		if count, err := storage.Attachments.CountByHash(ctx, hash); err != nil || count != 1 {
+			t.Errorf("count by hash: got %d, %v", count, err)
+		}
+
+		// the attachments go with their transaction
+		if err := storage.Transactions.DeleteById(ctx, id(transaction.Id)); err != nil {
+			t.Fatal(err)
+		}
+		if count, err := storage.Attachments.CountByHash(ctx, hash); err != nil || count != 0 {
+			t.Errorf("count by hash after delete of the transaction: got %d, %v", count, err)
+		}
+	})
+}
+
+func TestReconciliationRepository(t *testing.T) {
+	eachStorage(t, func(t *testing.T, storage Repositories) {
+		ctx := context.Background()
+		transaction := writeTransaction(t, storage)
+
+		reconciliation := Reconciliation{Account: transaction.From_account,
+			From: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)}
+		if _, err := storage.Reconciliations.Write(ctx, &reconciliation); err != nil {
+			t.Fatal(err)
+		}
+		read, err := storage.Reconciliations.ReadById(ctx, id(reconciliation.Id))
+		if err != nil || read.Account != transaction.From_account || !read.To.Equal(reconciliation.To) {
+			t.Errorf("read by id: got %+v, %v", read, err)
+		}
+
+		lines := []StatementLine{
+			{Reconciliation: reconciliation.Id, Line: 1, Date: transaction.Date, Amount: -1250, Counterparty: "shop", Description: "weekly shopping"},
+			{Reconciliation: reconciliation.Id, Line: 2, Date: transaction.Date, Amount: -5, Counterparty: "bank", Description: "fee"},
+		}
+		for i := range lines {
+			if _, err := storage.StatementLines.Write(ctx, &lines[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := storage.StatementLines.Link(ctx, &lines[0], transaction.Id); err != nil {
+			t.Fatal(err)
+		}
+		// a transaction is linked once
+		if err := storage.Atomic(ctx, func(storage Repositories) error {
+			return storage.StatementLines.Link(ctx, &lines[1], transaction.Id)
+		}); !errors.Is(err, ErrConflict) {
+			t.Errorf("second link: got %v, want %v", err, ErrConflict)
+		}
+		if err := storage.StatementLines.Ignore(ctx, &lines[1]); err != nil {
+			t.Fatal(err)
+		}
+		// a line is linked or ignored once
+		ignored := lines[1]
+		if err := storage.StatementLines.Ignore(ctx, &ignored); !errors.Is(err, ErrConflict) {
+			t.Errorf("second ignore: got %v, want %v", err, ErrConflict)
+		}
+		other := writeTransaction(t, storage)
+		if err := storage.Atomic(ctx, func(storage Repositories) error {
+			return storage.StatementLines.Link(ctx, &ignored, other.Id)
+		}); !errors.Is(err, ErrConflict) {
+			t.Errorf("link of an ignored line: got %v, want %v", err, ErrConflict)
+		}
+		if reconciled, _ := storage.Transactions.ReadById(ctx, id(transaction.Id)); !reconciled.Reconciled {
+			t.Error("the linked transaction is not reconciled")
+		}
+
+		saved, err := storage.StatementLines.Read(ctx, reconciliation.Id)
+		if err != nil || len(saved) != 2 {
+			t.Fatalf("read: got %+v, %v", saved, err)
+		}
+		if saved[0].Status != StatementLineLinked || saved[0].Transaction == nil || *saved[0].Transaction != transaction.Id {
+			t.Errorf("linked line: got %+v", saved[0])
+		}
+		if saved[1].Status != StatementLineIgnored || saved[1].Transaction != nil {
+			t.Errorf("ignored line: got %+v", saved[1])
+		}
+
+		if err := storage.StatementLines.UnlinkTransaction(ctx, transaction.Id); err != nil {
+			t.Fatal(err)
+		}
+		line, err := storage.StatementLines.ReadById(ctx, reconciliation.Id, lines[0].Id)
+		if err != nil || line.Status != StatementLineOpen || line.Transaction != nil {
+			t.Errorf("unlinked line: got %+v, %v", line, err)
+		}
+		if unreconciled, _ := storage.Transactions.ReadById(ctx, id(transaction.Id)); unreconciled.Reconciled {
+			t.Error("the unlinked transaction is still reconciled")
+		}
+	})
+}
+
+func TestCsvProfileRepository(t *testing.T) {
+	eachStorage(t, func(t *testing.T, storage Repositories) {
+		ctx := context.Background()
+
+		profile := CsvProfile{Name: unique("bank"), Delimiter: ";", Header: true, DateColumn: 0, DateFormat: "02-01-2006",
+			AmountColumn: 1, SignConvention: "minus", IndicatorColumn: -1, CounterpartyColumn: 2, DescriptionColumn: 3, DecimalSeparator: ","}
+		if _, err := storage.CsvProfiles.Write(ctx, &profile); err != nil {
+			t.Fatal(err)
+		}
+		duplicate := profile
+		if _, err := storage.CsvProfiles.Write(ctx, &duplicate); !errors.Is(err, ErrConflict) {
+			t.Errorf("write of a duplicate name: got %v, want %v", err, ErrConflict)
+		}
+
+		profile.Delimiter = ","
+		if _, err := storage.CsvProfiles.Update(ctx, &profile); err != nil {
+			t.Fatal(err)
+		}
+		read, err := storage.CsvProfiles.ReadByName(ctx, profile.Name)
+		if err != nil || read != profile {
+			t.Errorf("read by name: got %+v, %v, want %+v", read, err, profile)
+		}
+
+		if err := storage.CsvProfiles.DeleteByName(ctx, profile.Name); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := storage.CsvProfiles.ReadByName(ctx, profile.Name); !errors.Is(err, ErrNotFound) {
+			t.Errorf("read of a deleted profile: got %v, want %v", err, ErrNotFound)
+		}
+		if err := storage.CsvProfiles.DeleteByName(ctx, profile.Name); !errors.Is(err, ErrNotFound) {
+			t.Errorf("second delete: got %v, want %v", err, ErrNotFound)
+		}
+	})
+}
+
+func TestAuditRepository(t *testing.T) {
+	eachStorage(t, func(t *testing.T, storage Repositories) {
+		ctx := context.Background()
+		entity := time.Now().UnixNano()
+
+		for i, action := range []string{AuditCreate, AuditUpdate} {
+			audit := Audit{Entity: AuditAccount, EntityId: entity, Action: action, New: AuditJson(map[string]int{"version": i}),
+				Actor: "tester", RequestId: fmt.Sprint("request", i)}
+			if _, err := storage.Audits.Write(ctx, &audit); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		audits, err := storage.Audits.Read(ctx, AuditAccount, entity, time.Time{}, time.Time{}, 0)
+		if err != nil || len(audits) != 2 {
+			t.Fatalf("read: got %+v, %v", audits, err)
+		}
+		if audits[0].Action != AuditUpdate || audits[1].Action != AuditCreate {
+			t.Errorf("read is not newest first: got %s, %s", audits[0].Action, audits[1].Action)
+		}
+		if string(audits[1].New) != `{"version":0}` || audits[1].Old != nil || audits[1].Actor != "tester" {
+			t.Errorf("created record: got %+v", audits[1])
+		}
+
+		limited, err := storage.Audits.Read(ctx, AuditAccount, entity, time.Time{}, time.Time{}, 1)
+		if err != nil || len(limited) != 1 || limited[0].Id != audits[0].Id {
+			t.Errorf("read with limit: got %+v, %v", limited, err)
+		}
+		later, err := storage.Audits.Read(ctx, AuditAccount, entity, time.Now().Add(time.Hour), time.Time{}, 0)
+		if err != nil || len(later) != 0 {
+			t.Errorf("read from a later time: got %+v, %v", later, err)
+		}
+	})
+}
+
+func TestAtomic(t *testing.T) {
+	eachStorage(t, func(t *testing.T, storage Repositories) {
+		ctx := context.Background()
+		failed := errors.New("failed")
+
+		committed := Account{Number: unique("NL01KEPT")}
+		rolledBack := Account{Number: unique("NL01GONE")}
+		nested := Account{Number: unique("NL01NEST")}
+		err := storage.Atomic(ctx, func(storage Repositories) error {
+			if _, err := storage.Accounts.Write(ctx, &committed); err != nil {
+				return err
+			}
+			// a failing nested work is rolled back on its own
+			err := storage.Atomic(ctx, func(storage Repositories) error {
+				if _, err := storage.Accounts.Write(ctx, &nested); err != nil {
+					return err
+				}
+				return failed
+			})
+			if !errors.Is(err, failed) {
+				return fmt.Errorf("nested: got %v, want %v", err, failed)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = storage.Atomic(ctx, func(storage Repositories) error {
+			if _, err := storage.Accounts.Write(ctx, &rolledBack); err != nil {
+				return err
+			}
+			audit := Audit{Entity: AuditAccount, EntityId: rolledBack.Id, Action: AuditCreate, Actor: "tester", RequestId: "request"}
+			if _, err := storage.Audits.Write(ctx, &audit); err != nil {
+				return err
+			}
+			return failed
+		})
+		if !errors.Is(err, failed) {
+			t.Errorf("got %v, want %v", err, failed)
+		}
+
+		if _, err := storage.Accounts.ReadByNumber(ctx, committed.Number, false); err != nil {
+			t.Errorf("committed account: %v", err)
+		}
+		for _, gone := range []Account{nested, rolledBack} {
+			if _, err := storage.Accounts.ReadByNumber(ctx, gone.Number, true); !errors.Is(err, ErrNotFound) {
+				t.Errorf("rolled back account %s: got %v, want %v", gone.Number, err, ErrNotFound)
+			}
+		}
+		if audits, err := storage.Audits.Read(ctx, AuditAccount, rolledBack.Id, time.Time{}, time.Time{}, 0); err != nil || len(audits) != 0 {
+			t.Errorf("audit of the rolled back account: got %+v, %v", audits, err)
+		}
+	})
+}
+
+// Writers of sqlite that read before they write wait for each other, none fails and no update is lost
+func TestSqliteConcurrentWriters(t *testing.T) {
+	ctx := context.Background()
+	db, err := util.SqliteOpen(filepath.Join(t.TempDir(), "bank.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := migrations.Up(ctx, migrations.Sqlite(db)); err != nil {
+		t.Fatal(err)
+	}
+	storage := SqliteRepositories(db)
+
+	counter := Account{Number: unique("NL01COUNT"), Description: "0"}
+	if _, err := storage.Accounts.Write(ctx, &counter); err != nil {
+		t.Fatal(err)
+	}
+
+	const writers = 8
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		go func() {
+			errs <- storage.Atomic(ctx, func(storage Repositories) error {
+				account, err := storage.Accounts.ReadById(ctx, id(counter.Id), false)
+				if err != nil {
+					return err
+				}
+				count, _ := strconv.Atoi(account.Description)
+				// the other writers read in the mean time
+				time.Sleep(10 * time.Millisecond)
+				account.Description = strconv.Itoa(count + 1)
+				_, err = storage.Accounts.Update(ctx, &account)
+				return err
+			})
+		}()
+	}
+	for i := 0; i < writers; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("writer: %v", err)
+		}
+	}
+
+	account, err := storage.Accounts.ReadById(ctx, id(counter.Id), false)
+	if err != nil || account.Description != strconv.Itoa(writers) {
+		t.Errorf("got count %q, %v, want %d", account.Description, err, writers)
+	}
+}
+
+// Search answers the best match first, ties newest first, the same order on every storage and page by page
+func TestSearchRanking(t *testing.T) {
+	// written in this order, the word occurring 1, 3, 0, 2 and 1 times
+	descriptions := []string{"%s other", "%s %s %s", "nothing", "%s %s", "other %s"}
+	want := []int{1, 3, 4, 0}
+	orders := map[string][]int{}
+
+	eachStorage(t, func(t *testing.T, storage Repositories) {
+		ctx := context.Background()
+		word := unique("rent")
+		transaction := writeTransaction(t, storage)
+
+		accounts := map[int64]int{}
+		transactions := map[int64]int{}
+		for i, description := range descriptions {
+			description = strings.ReplaceAll(description, "%s", word)
+			account := Account{Number: unique("NL01RANK"), Description: description}
+			if _, err := storage.Accounts.Write(ctx, &account); err != nil {
+				t.Fatal(err)
+			}
+			accounts[account.Id] = i
+			written := Transaction{From_account: transaction.From_account, To_account: transaction.To_account,
+				Target: transaction.Target, Amount: 100, Description: description, Date: transaction.Date}
+			if _, err := storage.Transactions.Write(ctx, &written); err != nil {
+				t.Fatal(err)
+			}
+			transactions[written.Id] = i
+		}
+
+		matches, err := storage.Accounts.Search(ctx, word, "simple", &Page{}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		order := []int{}
+		for i, match := range matches {
+			order = append(order, accounts[match.Id])
+			if i > 0 && match.Rank > matches[i-1].Rank {
+				t.Errorf("rank %v after %v, want the best match first", match.Rank, matches[i-1].Rank)
+			}
+		}
+		if !reflect.DeepEqual(order, want) {
+			t.Errorf("accounts in order %v, want %v", order, want)
+		}
+
+		// page by page of one transaction
+		order = []int{}
+		page := Page{Limit: 1}
+		for {
+			matches, err := storage.Transactions.Search(ctx, word, "simple", &page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(matches) != 1 || len(order) > len(want) {
+				t.Fatalf("page after %d has %d matches, want one", page.After, len(matches))
+			}
+			order = append(order, transactions[matches[0].Id])
+			if page.Next == 0 {
+				break
+			}
+			page.After = page.Next
+		}
+		if !reflect.DeepEqual(order, want) {
+			t.Errorf("transactions in order %v, want %v", order, want)
+		}
+		orders[t.Name()] = order
+	})
+
+	for name, order := range orders {
+		if !reflect.DeepEqual(order, orders[t.Name()+"/memory"]) {
+			t.Errorf("%s in order %v, memory in order %v", name, order, orders[t.Name()+"/memory"])
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package domain
+
+import "strings"
+
+// Text search configurations of postgres that can be searched with, each has a search index
+var SearchConfigs = map[string]bool{"simple": true, "dutch": true}
+
+// Words of the snippet matching the search are marked, the text of the snippet is html escaped
+// so the stored text cannot add markup of its own
+const snippetOptions = "StartSel=<mark>, StopSel=</mark>, MaxFragments=2"
+
+// the characters html escaped in snippets, as html.EscapeString does
+var snippetEscapes = [][2]string{{"&", "&amp;"}, {"<", "&lt;"}, {">", "&gt;"}, {`"`, "&#34;"}, {"'", "&#39;"}}
+
+// Full text search of the document of a table, best match first.
+// The document expression must be the expression of the search indexes of the table.
+type textSearch struct {
+	config   string
+	document string
+	term     string
+}
+
+func newTextSearch(config string, document string, term string) (textSearch, error) {
+	if len(config) == 0 {
+		config = "simple"
+	}
+	if !SearchConfigs[config] {
+		return textSearch{}, invalid("unknown text search configuration %s", config)
+	}
+	return textSearch{config: config, document: document, term: term}, nil
+}
+
+func (search textSearch) vector() string {
+	return "to_tsvector('" + search.config + "', " + search.document + ")"
+}
+
+func (search textSearch) tsquery() string {
+	return "plainto_tsquery('" + search.config + "', ?)"
+}
+
+func (search textSearch) rank() string {
+	return "ts_rank(" + search.vector() + ", " + search.tsquery() + ")"
+}
+
+// select the rows matching the term
+func (search textSearch) where(q *query) *query {
+	return q.where(search.vector()+" @@ "+search.tsquery(), search.term)
+}
+
+// the document with its text html escaped, & first so the escapes themselves are not escaped again
+func (search textSearch) escaped() string {
+	escaped := search.document
+	for _, escape := range snippetEscapes {
+		escaped = "replace(" + escaped + ", '" + strings.ReplaceAll(escape[0], "'", "''") + "', '" + escape[1] + "')"
+	}
+	return escaped
+}
+
+// select all columns followed by rank and snippet, ordered by rank and limited to the page
+func (search textSearch) page(q *query, page *Page) *query {
+	q.selecting("*, "+search.rank()+" as rank, ts_headline('"+search.config+"', "+search.escaped()+", "+search.tsquery()+", '"+snippetOptions+"')",
+		search.term, search.term)
+
+	if page.After > 0 {
+		q.where("("+search.rank()+", id) < (SELECT "+search.rank()+", id from "+q.table+" where id = ?)", search.term, search.term, page.After)
+	}
+	q.order("rank desc, id desc")
+	if page.Limit > 0 {
+		q.limitTo(page.Limit + 1)
+	}
+	return q
+}
@@ -1,10 +1,34 @@
 package domain
 
-import "github.com/google/uuid"
+import (
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
 
 type ServerError struct {
-	Message string `json:"message"`
-	Ticket  string `json:"ticket"`
+	Message string         `json:"message"`
+	Ticket  string         `json:"ticket"`
+	Invalid []InvalidValue `json:"invalid,omitempty"`
+}
+
+// A value of a request that does not match the OpenAPI document
+type InvalidValue struct {
+	In     string `json:"in"`   // path, query, header or body
+	Name   string `json:"name"` // name of the parameter or json pointer of the value in the body
+	Reason string `json:"reason"`
+}
+
+// An error as application/problem+json of RFC 7807, the ticket and the invalid values are extensions
+type Problem struct {
+	Type     string         `json:"type"`
+	Title    string         `json:"title"`
+	Status   int            `json:"status"`
+	Detail   string         `json:"detail"`
+	Instance string         `json:"instance"`
+	Ticket   string         `json:"ticket"`
+	Invalid  []InvalidValue `json:"invalid,omitempty"`
 }
 
 func GenerateServerError(msg string) ServerError {
@@ -18,3 +42,19 @@ func GenerateServerError(msg string) ServerError {
 
 	return serverError
 }
+
+// The error as problem with the status of the response, instance is the path of the request.
+// The type is a relative uri named after the status, e.g. /problems/not-found
+func (serverError ServerError) Problem(status int, instance string) Problem {
+	title := http.StatusText(status)
+
+	return Problem{
+		Type:     "/problems/" + strings.ReplaceAll(strings.ToLower(title), " ", "-"),
+		Title:    title,
+		Status:   status,
+		Detail:   serverError.Message,
+		Instance: instance,
+		Ticket:   serverError.Ticket,
+		Invalid:  serverError.Invalid,
+	}
+}
@@ -0,0 +1,1322 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Repositories of the sqlite database of db, the database must have the schema of the sqlite migrations.
+// Full text search uses the words of the term as they are, sqlite has no languages like postgres.
+func SqliteRepositories(db *sql.DB) Repositories {
+	return sqliteRepositories(db)
+}
+
+func sqliteRepositories(db sqliteDb) Repositories {
+	return Repositories{
+		Accounts:        sqliteAccounts{db: db},
+		Targets:         sqliteTargets{db: db},
+		Transactions:    sqliteTransactions{db: db},
+		Tags:            sqliteTags{db: db},
+		Attachments:     sqliteAttachments{db: db},
+		Reconciliations: sqliteReconciliations{db: db},
+		StatementLines:  sqliteStatementLines{db: db},
+		CsvProfiles:     sqliteCsvProfiles{db: db},
+		Audits:          sqliteAudits{db: db},
+		atomic: func(ctx context.Context, work func(storage Repositories) error) error {
+			tx, err := sqliteBegin(ctx, db)
+			if err != nil {
+				return sqliteErr(err)
+			}
+			defer tx.Rollback()
+
+			if err := work(sqliteRepositories(tx)); err != nil {
+				return err
+			}
+			return sqliteErr(tx.Commit())
+		},
+	}
+}
+
+// The sqlite database or a transaction of it
+type sqliteDb interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type sqliteTx interface {
+	sqliteDb
+	Commit() error
+	Rollback() error
+}
+
+// Begin a transaction of db, within a transaction a savepoint
+func sqliteBegin(ctx context.Context, db sqliteDb) (sqliteTx, error) {
+	var tx *sql.Tx
+
+	switch db := db.(type) {
+	case *sql.DB:
+		return db.BeginTx(ctx, nil)
+	case *sql.Tx:
+		tx = db
+	case *sqliteSavepoint:
+		tx = db.Tx
+	default:
+		return nil, fmt.Errorf("no transaction of %T", db)
+	}
+
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT nested"); err != nil {
+		return nil, err
+	}
+	return &sqliteSavepoint{Tx: tx}, nil
+}
+
+// A savepoint in a transaction, savepoints of the same name nest as the last one is released or rolled back
+type sqliteSavepoint struct {
+	*sql.Tx
+	done bool
+}
+
+func (savepoint *sqliteSavepoint) Commit() error {
+	if savepoint.done {
+		return sql.ErrTxDone
+	}
+	savepoint.done = true
+	_, err := savepoint.Tx.Exec("RELEASE nested")
+	return err
+}
+
+func (savepoint *sqliteSavepoint) Rollback() error {
+	if savepoint.done {
+		return sql.ErrTxDone
+	}
+	savepoint.done = true
+	_, err := savepoint.Tx.Exec("ROLLBACK TO nested; RELEASE nested")
+	return err
+}
+
+// text of a moment as sqlite stores it, in UTC so the text sorts like the moments
+func sqliteTime(moment time.Time) string {
+	return moment.UTC().Format("2006-01-02 15:04:05.999999999")
+}
+
+// values to bind, times are bound as the text sqlite stores
+func sqliteArgs(args []any) []any {
+	converted := make([]any, len(args))
+	for i, arg := range args {
+		if moment, ok := arg.(time.Time); ok {
+			arg = sqliteTime(moment)
+		}
+		converted[i] = arg
+	}
+	return converted
+}
+
+func (q *query) sqliteRows(ctx context.Context, db sqliteDb) (*sql.Rows, error) {
+	sql, args := q.sql()
+	log.WithFields(log.Fields{"query": sql}).Trace("Query")
+	return db.QueryContext(ctx, sql, sqliteArgs(args)...)
+}
+
+// number of rows matching the conditions, order and limit are ignored
+func (q *query) sqliteCount(ctx context.Context, db sqliteDb) (int64, error) {
+	var count int64
+
+	counter := *q
+	counter.columns = "count(*)"
+	counter.columnArgs = nil
+	counter.orderBy = ""
+	counter.limit = 0
+	sql, args := counter.sql()
+	err := db.QueryRowContext(ctx, sql, sqliteArgs(args)...).Scan(&count)
+	return count, err
+}
+
+// count the rows of the query, only when requested
+func (page *Page) sqliteCount(ctx context.Context, db sqliteDb, q *query) error {
+	var err error
+
+	if !page.Count {
+		return nil
+	}
+
+	page.Total, err = q.sqliteCount(ctx, db)
+	if err != nil {
+		log.WithFields(log.Fields{"table": q.table, "error": err}).Error("Count page - reading result error")
+	}
+	return err
+}
+
+// a row of sql.Row or sql.Rows
+type sqliteRow interface {
+	Scan(dest ...any) error
+}
+
+// set the deleted time of the row with id that is not deleted yet
+func sqliteSoftDelete(ctx context.Context, db sqliteDb, table string, id string) error {
+	result, err := db.ExecContext(ctx, "UPDATE "+table+" set deleted = ? where id = ? and deleted is null", sqliteTime(time.Now()), id)
+	return sqliteAffected(result, err)
+}
+
+// clear the deleted time of the row with id that is deleted
+func sqliteRestore(ctx context.Context, db sqliteDb, table string, id string) error {
+	result, err := db.ExecContext(ctx, "UPDATE "+table+" set deleted = null where id = ? and deleted is not null", id)
+	return sqliteAffected(result, err)
+}
+
+// not found when the statement did not change a row
+func sqliteAffected(result sql.Result, err error) error {
+	var n int64
+
+	if err == nil {
+		n, err = result.RowsAffected()
+	}
+	if err == nil && n == 0 {
+		err = sql.ErrNoRows
+	}
+	return sqliteErr(err)
+}
+
+// take the write lock of the database for the transaction of db with an update that changes nothing,
+// sqlite has no row locks and a concurrent writer waits for the transaction
+func sqliteLockRow(ctx context.Context, db sqliteDb, table string, id string) error {
+	return sqliteAffected(db.ExecContext(ctx, "UPDATE "+table+" set id = id where id = ?", id))
+}
+
+// the values of ids as values to bind
+func sqliteIds(ids []int64) []any {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
+
+// select the rows of a search that contain all words of term, rank and snippet are made by memoryMatch
+func sqliteSearch(q *query, document string, term string) *query {
+	for _, word := range strings.Fields(term) {
+		q.whereContains(document, word)
+	}
+	return q
+}
+
+type sqliteAccounts struct {
+	db sqliteDb
+}
+
+func scanSqliteAccount(row sqliteRow) (Account, error) {
+	acc := Account{}
+	err := row.Scan(&acc.Id, &acc.Number, &acc.Description, &acc.Deleted)
+	return acc, err
+}
+
+func (repository sqliteAccounts) Balances(ctx context.Context, ids []int64) (map[int64]int64, error) {
+	balances := map[int64]int64{}
+	for _, id := range ids {
+		balances[id] = 0
+	}
+	if len(ids) == 0 {
+		return balances, nil
+	}
+
+	in := placeholders(len(ids))
+	rows, err := repository.db.QueryContext(ctx,
+		"SELECT account, coalesce(sum(amount), 0) from ("+
+			`SELECT to_account as account, amount from "transaction" where to_account in (`+in+") union all "+
+			`SELECT from_account as account, -amount from "transaction" where from_account in (`+in+")"+
+			") as mutation group by account", append(sqliteIds(ids), sqliteIds(ids)...)...)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Balance of accounts - reading result error")
+		return balances, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, balance int64
+
+		if err = rows.Scan(&id, &balance); err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Balance of accounts - reading result error")
+			return balances, err
+		}
+		balances[id] = balance
+	}
+	return balances, rows.Err()
+}
+
+func (repository sqliteAccounts) DeleteById(ctx context.Context, id string) error {
+	return sqliteSoftDelete(ctx, repository.db, "account", id)
+}
+
+func (repository sqliteAccounts) Purge(ctx context.Context, before time.Time) ([]Account, error) {
+	accounts := []Account{}
+
+	tx, err := sqliteBegin(ctx, repository.db)
+	if err != nil {
+		return accounts, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT * from account where deleted < ?
+		and not exists (SELECT 1 from "transaction" t where t.from_account = account.id or t.to_account = account.id)`, sqliteTime(before))
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Purge account - delete error")
+		return accounts, err
+	}
+	ids := []int64{}
+	for rows.Next() {
+		acc, err := scanSqliteAccount(rows)
+		if err != nil {
+			rows.Close()
+			log.WithFields(log.Fields{"error": err}).Error("Purge account - reading result error")
+			return []Account{}, err
+		}
+		accounts = append(accounts, acc)
+		ids = append(ids, acc.Id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil || len(ids) == 0 {
+		return accounts, err
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE from account where id in ("+placeholders(len(ids))+")", sqliteIds(ids)...); err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Purge account - delete error")
+		return []Account{}, sqliteErr(err)
+	}
+	return accounts, tx.Commit()
+}
+
+func (repository sqliteAccounts) Read(ctx context.Context, number string, page *Page, includeDeleted bool) ([]Account, error) {
+	accounts := []Account{}
+	query := sqliteSelectFrom("account")
+
+	if len(number) > 0 {
+		query.where("number = ?", number)
+	}
+	if !includeDeleted {
+		query.where("deleted is null")
+	}
+
+	if err := page.sqliteCount(ctx, repository.db, query); err != nil {
+		return accounts, err
+	}
+
+	query, err := page.apply(query, nil)
+	if err != nil {
+		return accounts, err
+	}
+	rows, err := query.sqliteRows(ctx, repository.db)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Read account - reading result error")
+		return accounts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		account, err := scanSqliteAccount(rows)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Read account - reading result error")
+			return accounts, err
+		}
+		accounts = append(accounts, account)
+	}
+	return pageRows(page, accounts, func(account Account) int64 { return account.Id }), rows.Err()
+}
+
+func (repository sqliteAccounts) ReadById(ctx context.Context, id string, includeDeleted bool) (Account, error) {
+	acc, err := scanSqliteAccount(repository.db.QueryRowContext(ctx, "SELECT * from account where id = ?"+undeleted(includeDeleted), id))
+	if err != nil && err != sql.ErrNoRows {
+		log.WithFields(log.Fields{"id": id, "error": err}).Error("Read account - reading result error")
+	}
+	return acc, sqliteErr(err)
+}
+
+func (repository sqliteAccounts) ReadForUpdate(ctx context.Context, id string) (Account, error) {
+	if err := sqliteLockRow(ctx, repository.db, "account", id); err != nil {
+		return Account{}, err
+	}
+	return repository.ReadById(ctx, id, false)
+}
+
+func (repository sqliteAccounts) ReadByIds(ctx context.Context, ids []int64) (map[int64]Account, error) {
+	accounts := map[int64]Account{}
+
+	rows, err := sqliteSelectFrom("account").whereIn("id", ids).sqliteRows(ctx, repository.db)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Read accounts by id - reading result error")
+		return accounts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		acc, err := scanSqliteAccount(rows)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Read accounts by id - reading result error")
+			return accounts, err
+		}
+		accounts[acc.Id] = acc
+	}
+	return accounts, rows.Err()
+}
+
+func (repository sqliteAccounts) ReadByNumber(ctx context.Context, number string, includeDeleted bool) (Account, error) {
+	acc, err := scanSqliteAccount(repository.db.QueryRowContext(ctx, "SELECT * from account where number = ?"+undeleted(includeDeleted), number))
+	if err != nil && err != sql.ErrNoRows {
+		log.WithFields(log.Fields{"number": number, "error": err}).Error("Read account by number - reading result error")
+	}
+	return acc, sqliteErr(err)
+}
+
+func (repository sqliteAccounts) Restore(ctx context.Context, id string) error {
+	return sqliteRestore(ctx, repository.db, "account", id)
+}
+
+func (repository sqliteAccounts) Search(ctx context.Context, term string, config string, page *Page, includeDeleted bool) ([]AccountMatch, error) {
+	matches := []AccountMatch{}
+
+	if _, err := newTextSearch(config, accountDocument, term); err != nil {
+		return matches, err
+	}
+
+	query := sqliteSearch(sqliteSelectFrom("account"), accountDocument, term)
+	if !includeDeleted {
+		query.where("deleted is null")
+	}
+
+	rows, err := query.sqliteRows(ctx, repository.db)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Search account - reading result error")
+		return matches, err
+	}
+	defer rows.Close()
+
+	found := map[int64]AccountMatch{}
+	for rows.Next() {
+		account, err := scanSqliteAccount(rows)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Search account - reading result error")
+			return matches, err
+		}
+		if rank, snippet, ok := memoryMatch(account.Number+" "+account.Description, term); ok {
+			found[account.Id] = AccountMatch{Account: account, Rank: rank, Snippet: snippet}
+			matches = append(matches, found[account.Id])
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return matches, err
+	}
+
+	page.Ascending = false
+	return memoryPage(page, matches, func(match AccountMatch) int64 { return match.Id },
+		func(a AccountMatch, b AccountMatch) int { return compareInt(int64(a.Rank*1000), int64(b.Rank*1000)) },
+		func(id int64) (AccountMatch, bool) { match, ok := found[id]; return match, ok }), nil
+}
+
+func (repository sqliteAccounts) Update(ctx context.Context, account *Account) (int64, error) {
+	if account.Id == 0 {
+		return 0, invalid("identification for account is missing")
+	}
+
+	_, err := repository.db.ExecContext(ctx, "UPDATE account set number = ?, description = ? where id = ?", account.Number, account.Description, account.Id)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "account": account}).Error("update account: Error during update account")
+		return 0, fmt.Errorf("update Account insert: %w", sqliteErr(err))
+	}
+	return account.Id, nil
+}
+
+func (repository sqliteAccounts) Write(ctx context.Context, account *Account) (int64, error) {
+	var result sql.Result
+	var err error
+
+	if account.Id != 0 {
+		result, err = repository.db.ExecContext(ctx, "INSERT INTO account (id, number, description) VALUES (?, ?, ?)", account.Id, account.Number, account.Description)
+	} else {
+		result, err = repository.db.ExecContext(ctx, "INSERT INTO account (number, description) VALUES (?, ?)", account.Number, account.Description)
+	}
+	if err == nil {
+		account.Id, err = result.LastInsertId()
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "account": account}).Error("addAccount: Error during insert account")
+		return 0, fmt.Errorf("addAccount insert: %w", sqliteErr(err))
+	}
+	return account.Id, nil
+}
+
+type sqliteTargets struct {
+	db sqliteDb
+}
+
+func scanSqliteTarget(row sqliteRow) (Target, error) {
+	tar := Target{}
+	err := row.Scan(&tar.Id, &tar.Name, &tar.Description, &tar.Deleted)
+	return tar, err
+}
+
+func (repository sqliteTargets) DeleteById(ctx context.Context, id string) error {
+	return sqliteSoftDelete(ctx, repository.db, "target", id)
+}
+
+func (repository sqliteTargets) Purge(ctx context.Context, before time.Time) ([]Target, error) {
+	targets := []Target{}
+
+	tx, err := sqliteBegin(ctx, repository.db)
+	if err != nil {
+		return targets, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT * from target where deleted < ?
+		and not exists (SELECT 1 from "transaction" t where t.target = target.id)`, sqliteTime(before))
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Purge target - delete error")
+		return targets, err
+	}
+	ids := []int64{}
+	for rows.Next() {
+		tar, err := scanSqliteTarget(rows)
+		if err != nil {
+			rows.Close()
+			log.WithFields(log.Fields{"error": err}).Error("Purge target - reading result error")
+			return []Target{}, err
+		}
+		targets = append(targets, tar)
+		ids = append(ids, tar.Id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil || len(ids) == 0 {
+		return targets, err
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE from target where id in ("+placeholders(len(ids))+")", sqliteIds(ids)...); err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Purge target - delete error")
+		return []Target{}, sqliteErr(err)
+	}
+	return targets, tx.Commit()
+}
+
+func (repository sqliteTargets) Read(ctx context.Context, name string, page *Page, includeDeleted bool) ([]Target, error) {
+	targets := []Target{}
+	query := sqliteSelectFrom("target")
+
+	if len(name) > 0 {
+		query.where("name = ?", name)
+	}
+	if !includeDeleted {
+		query.where("deleted is null")
+	}
+
+	if err := page.sqliteCount(ctx, repository.db, query); err != nil {
+		return targets, err
+	}
+
+	query, err := page.apply(query, nil)
+	if err != nil {
+		return targets, err
+	}
+	rows, err := query.sqliteRows(ctx, repository.db)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Read target - reading result error")
+		return targets, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		target, err := scanSqliteTarget(rows)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Read target - reading result error")
+			return targets, err
+		}
+		targets = append(targets, target)
+	}
+	return pageRows(page, targets, func(target Target) int64 { return target.Id }), rows.Err()
+}
+
+func (repository sqliteTargets) ReadById(ctx context.Context, id string, includeDeleted bool) (Target, error) {
+	tar, err := scanSqliteTarget(repository.db.QueryRowContext(ctx, "SELECT * from target where id = ?"+undeleted(includeDeleted), id))
+	if err != nil && err != sql.ErrNoRows {
+		log.WithFields(log.Fields{"id": id, "error": err}).Error("Read target - reading result error")
+	}
+	return tar, sqliteErr(err)
+}
+
+func (repository sqliteTargets) ReadForUpdate(ctx context.Context, id string) (Target, error) {
+	if err := sqliteLockRow(ctx, repository.db, "target", id); err != nil {
+		return Target{}, err
+	}
+	return repository.ReadById(ctx, id, false)
+}
+
+func (repository sqliteTargets) ReadByIds(ctx context.Context, ids []int64) (map[int64]Target, error) {
+	targets := map[int64]Target{}
+
+	rows, err := sqliteSelectFrom("target").whereIn("id", ids).sqliteRows(ctx, repository.db)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Read targets by id - reading result error")
+		return targets, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		tar, err := scanSqliteTarget(rows)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Read targets by id - reading result error")
+			return targets, err
+		}
+		targets[tar.Id] = tar
+	}
+	return targets, rows.Err()
+}
+
+func (repository sqliteTargets) ReadByName(ctx context.Context, name string, includeDeleted bool) (Target, error) {
+	tar, err := scanSqliteTarget(repository.db.QueryRowContext(ctx, "SELECT * from target where name = ?"+undeleted(includeDeleted), name))
+	if err != nil && err != sql.ErrNoRows {
+		log.WithFields(log.Fields{"name": name, "error": err}).Error("Read target by name - reading result error")
+	}
+	return tar, sqliteErr(err)
+}
+
+func (repository sqliteTargets) Restore(ctx context.Context, id string) error {
+	return sqliteRestore(ctx, repository.db, "target", id)
+}
+
+func (repository sqliteTargets) Search(ctx context.Context, term string, config string, page *Page, includeDeleted bool) ([]TargetMatch, error) {
+	matches := []TargetMatch{}
+
+	if _, err := newTextSearch(config, targetDocument, term); err != nil {
+		return matches, err
+	}
+
+	query := sqliteSearch(sqliteSelectFrom("target"), targetDocument, term)
+	if !includeDeleted {
+		query.where("deleted is null")
+	}
+
+	rows, err := query.sqliteRows(ctx, repository.db)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Search target - reading result error")
+		return matches, err
+	}
+	defer rows.Close()
+
+	found := map[int64]TargetMatch{}
+	for rows.Next() {
+		target, err := scanSqliteTarget(rows)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Search target - reading result error")
+			return matches, err
+		}
+		if rank, snippet, ok := memoryMatch(target.Name+" "+target.Description, term); ok {
+			found[target.Id] = TargetMatch{Target: target, Rank: rank, Snippet: snippet}
+			matches = append(matches, found[target.Id])
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return matches, err
+	}
+
+	page.Ascending = false
+	return memoryPage(page, matches, func(match TargetMatch) int64 { return match.Id },
+		func(a TargetMatch, b TargetMatch) int { return compareInt(int64(a.Rank*1000), int64(b.Rank*1000)) },
+		func(id int64) (TargetMatch, bool) { match, ok := found[id]; return match, ok }), nil
+}
+
+func (repository sqliteTargets) Update(ctx context.Context, target *Target) (int64, error) {
+	if target.Id == 0 {
+		return 0, invalid("identification for target is missing")
+	}
+
+	_, err := repository.db.ExecContext(ctx, "UPDATE target set name = ?, description = ? where id = ?", target.Name, target.Description, target.Id)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "target": target}).Error("update target: Error during update target")
+		return 0, fmt.Errorf("update Target insert: %w", sqliteErr(err))
+	}
+	return target.Id, nil
+}
+
+func (repository sqliteTargets) Write(ctx context.Context, target *Target) (int64, error) {
+	var result sql.Result
+	var err error
+
+	if target.Id != 0 {
+		result, err = repository.db.ExecContext(ctx, "INSERT INTO target (id, name, description) VALUES (?, ?, ?)", target.Id, target.Name, target.Description)
+	} else {
+		result, err = repository.db.ExecContext(ctx, "INSERT INTO target (name, description) VALUES (?, ?)", target.Name, target.Description)
+	}
+	if err == nil {
+		target.Id, err = result.LastInsertId()
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "target": target}).Error("addTarget: Error during insert target")
+		return 0, fmt.Errorf("addTarget insert: %w", sqliteErr(err))
+	}
+	return target.Id, nil
+}
+
+type sqliteTransactions struct {
+	db sqliteDb
+}
+
+func scanSqliteTransaction(row sqliteRow) (Transaction, error) {
+	trans := Transaction{}
+	err := row.Scan(&trans.Id, &trans.From_account, &trans.To_account, &trans.Target, &trans.Amount, &trans.Description, &trans.Date, &trans.Reconciled)
+	return trans, err
+}
+
+// Fill the tags of transactions with one query
+func (repository sqliteTransactions) readTags(ctx context.Context, transactions []Transaction) error {
+	ids := make([]int64, len(transactions))
+	index := map[int64][]int{}
+
+	for i := range transactions {
+		transactions[i].Tags = []string{}
+		ids[i] = transactions[i].Id
+		index[transactions[i].Id] = append(index[transactions[i].Id], i)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := repository.db.QueryContext(ctx,
+		`SELECT tt."transaction", g.name from transaction_tag tt join tag g on g.id = tt.tag where tt."transaction" in (`+placeholders(len(ids))+") order by g.name", sqliteIds(ids)...)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Read tags of transactions - reading result error")
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var name string
+
+		if err = rows.Scan(&id, &name); err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Read tags of transactions - reading result error")
+			return err
+		}
+		for _, i := range index[id] {
+			transactions[i].Tags = append(transactions[i].Tags, name)
+		}
+	}
+	return rows.Err()
+}
+
+// the transactions of the rows of a query
+func (repository sqliteTransactions) scan(ctx context.Context, q *query) ([]Transaction, error) {
+	transactions := []Transaction{}
+
+	rows, err := q.sqliteRows(ctx, repository.db)
+	if err != nil {
+		return transactions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		trans, err := scanSqliteTransaction(rows)
+		if err != nil {
+			return transactions, err
+		}
+		transactions = append(transactions, trans)
+	}
+	return transactions, rows.Err()
+}
+
+func (repository sqliteTransactions) AddTag(ctx context.Context, transaction *Transaction, tag string) error {
+	tag, err := NormalizeTag(tag)
+	if err != nil {
+		return err
+	}
+
+	_, err = repository.db.ExecContext(ctx, "INSERT OR IGNORE INTO tag (name) VALUES (?)", tag)
+	if err == nil {
+		_, err = repository.db.ExecContext(ctx,
+			`INSERT OR IGNORE INTO transaction_tag ("transaction", tag) SELECT ?, id from tag where name = ?`, transaction.Id, tag)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "transaction": transaction.Id, "tag": tag}).Error("add tag: Error during insert tag")
+		return fmt.Errorf("add tag: %w", sqliteErr(err))
+	}
+
+	if !transaction.HasTag(tag) {
+		transaction.Tags = append(transaction.Tags, tag)
+	}
+	return nil
+}
+
+func (repository sqliteTransactions) DeleteById(ctx context.Context, id string) error {
+	result, err := repository.db.ExecContext(ctx, `DELETE from "transaction" where id = ?`, id)
+	return sqliteAffected(result, err)
+}
+
+func (repository sqliteTransactions) Read(ctx context.Context, filter TransactionFilter, page *Page) ([]Transaction, error) {
+	query := filter.apply(sqliteSelectFrom(transactionTable))
+
+	if err := page.sqliteCount(ctx, repository.db, query); err != nil {
+		return []Transaction{}, err
+	}
+
+	query, err := page.apply(query, transactionOrder)
+	if err != nil {
+		return []Transaction{}, err
+	}
+	transactions, err := repository.scan(ctx, query)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Read transactions - reading result error")
+		return transactions, err
+	}
+	transactions = pageRows(page, transactions, func(transaction Transaction) int64 { return transaction.Id })
+	return transactions, repository.readTags(ctx, transactions)
+}
+
+func (repository sqliteTransactions) ReadByAccount(ctx context.Context, account int64, from time.Time, to time.Time, tag string) ([]Transaction, error) {
+	filter := TransactionFilter{Account: account, FromDate: from, ToDate: to, Tag: tag}
+
+	transactions, err := repository.scan(ctx, filter.apply(sqliteSelectFrom(transactionTable)).order("date, id"))
+	if err != nil {
+		log.WithFields(log.Fields{"account": account, "error": err}).Error("Read transactions of account - reading result error")
+		return transactions, err
+	}
+	return transactions, repository.readTags(ctx, transactions)
+}
+
+func (repository sqliteTransactions) ReadById(ctx context.Context, id string) (Transaction, error) {
+	trans, err := scanSqliteTransaction(repository.db.QueryRowContext(ctx, `SELECT * from "transaction" where id = ?`, id))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.WithFields(log.Fields{"id": id, "error": err}).Error("Read transaction - reading result error")
+		}
+		return trans, sqliteErr(err)
+	}
+
+	transactions := []Transaction{trans}
+	err = repository.readTags(ctx, transactions)
+	return transactions[0], sqliteErr(err)
+}
+
+func (repository sqliteTransactions) ReadForUpdate(ctx context.Context, id string) (Transaction, error) {
+	if err := sqliteLockRow(ctx, repository.db, transactionTable, id); err != nil {
+		return Transaction{}, err
+	}
+	return repository.ReadById(ctx, id)
+}
+
+func (repository sqliteTransactions) RemoveTag(ctx context.Context, transaction *Transaction, tag string) error {
+	tag, err := NormalizeTag(tag)
+	if err != nil {
+		return err
+	}
+
+	_, err = repository.db.ExecContext(ctx,
+		`DELETE from transaction_tag where "transaction" = ? and tag in (SELECT id from tag where name = ?)`, transaction.Id, tag)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "transaction": transaction.Id, "tag": tag}).Error("remove tag: Error during delete tag")
+		return fmt.Errorf("remove tag: %w", sqliteErr(err))
+	}
+
+	tags := []string{}
+	for _, name := range transaction.Tags {
+		if name != tag {
+			tags = append(tags, name)
+		}
+	}
+	transaction.Tags = tags
+	return nil
+}
+
+func (repository sqliteTransactions) Search(ctx context.Context, term string, config string, page *Page) ([]TransactionMatch, error) {
+	matches := []TransactionMatch{}
+
+	if _, err := newTextSearch(config, transactionDocument, term); err != nil {
+		return matches, err
+	}
+
+	transactions, err := repository.scan(ctx, sqliteSearch(sqliteSelectFrom(transactionTable), transactionDocument, term))
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Search transaction - reading result error")
+		return matches, err
+	}
+
+	found := map[int64]TransactionMatch{}
+	for _, transaction := range transactions {
+		if rank, snippet, ok := memoryMatch(transaction.Description, term); ok {
+			found[transaction.Id] = TransactionMatch{Transaction: transaction, Rank: rank, Snippet: snippet}
+			matches = append(matches, found[transaction.Id])
+		}
+	}
+
+	page.Ascending = false
+	matches = memoryPage(page, matches, func(match TransactionMatch) int64 { return match.Id },
+		func(a TransactionMatch, b TransactionMatch) int {
+			return compareInt(int64(a.Rank*1000), int64(b.Rank*1000))
+		},
+		func(id int64) (TransactionMatch, bool) { match, ok := found[id]; return match, ok })
+
+	transactions = make([]Transaction, len(matches))
+	for i := range matches {
+		transactions[i] = matches[i].Transaction
+	}
+	err = repository.readTags(ctx, transactions)
+	for i := range matches {
+		matches[i].Tags = transactions[i].Tags
+	}
+	return matches, err
+}
+
+func (repository sqliteTransactions) Update(ctx context.Context, transaction *Transaction) (int64, error) {
+	if transaction.Id == 0 {
+		return 0, invalid("identification for transaction is missing")
+	}
+
+	_, err := repository.db.ExecContext(ctx,
+		`UPDATE "transaction" set from_account = ?, to_account = ?, target = ?, amount = ?, description = ?, date = ? where id = ?`,
+		transaction.From_account, transaction.To_account, transaction.Target, transaction.Amount, transaction.Description, sqliteTime(memoryDate(transaction.Date)), transaction.Id)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "transaction": transaction}).Error("update transaction: Error during update transaction")
+		return 0, fmt.Errorf("update Transaction insert: %w", sqliteErr(err))
+	}
+	return transaction.Id, nil
+}
+
+func (repository sqliteTransactions) Write(ctx context.Context, transaction *Transaction) (int64, error) {
+	var result sql.Result
+	var err error
+
+	if transaction.Date.IsZero() {
+		transaction.Date = time.Now()
+	}
+	date := sqliteTime(memoryDate(transaction.Date))
+
+	if transaction.Id != 0 {
+		result, err = repository.db.ExecContext(ctx,
+			`INSERT INTO "transaction" (id, from_account, to_account, target, amount, description, date) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			transaction.Id, transaction.From_account, transaction.To_account, transaction.Target, transaction.Amount, transaction.Description, date)
+	} else {
+		result, err = repository.db.ExecContext(ctx,
+			`INSERT INTO "transaction" (from_account, to_account, target, amount, description, date) VALUES (?, ?, ?, ?, ?, ?)`,
+			transaction.From_account, transaction.To_account, transaction.Target, transaction.Amount, transaction.Description, date)
+	}
+	if err == nil {
+		transaction.Id, err = result.LastInsertId()
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "transaction": transaction}).Error("addTransaction: Error during insert transaction")
+		return 0, fmt.Errorf("addTransaction insert: %w", sqliteErr(err))
+	}
+
+	tags := transaction.Tags
+	transaction.Tags = []string{}
+	for _, tag := range tags {
+		if err = repository.AddTag(ctx, transaction, tag); err != nil {
+			return transaction.Id, err
+		}
+	}
+	return transaction.Id, nil
+}
+
+type sqliteTags struct {
+	db sqliteDb
+}
+
+func (repository sqliteTags) Read(ctx context.Context) ([]Tag, error) {
+	tags := []Tag{}
+
+	rows, err := repository.db.QueryContext(ctx,
+		"SELECT g.id, g.name, count(tt.\"transaction\") from tag g left join transaction_tag tt on tt.tag = g.id group by g.id, g.name order by g.name")
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Read tag - reading result error")
+		return tags, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t := Tag{}
+		if err = rows.Scan(&t.Id, &t.Name, &t.Transactions); err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Read tag - reading result error")
+			return tags, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+type sqliteAttachments struct {
+	db sqliteDb
+}
+
+func scanSqliteAttachment(row sqliteRow) (Attachment, error) {
+	att := Attachment{}
+	err := row.Scan(&att.Id, &att.Transaction, &att.Filename, &att.ContentType, &att.Size, &att.Hash, &att.Created)
+	return att, err
+}
+
+func (repository sqliteAttachments) CountByHash(ctx context.Context, hash string) (int64, error) {
+	var count int64
+
+	err := repository.db.QueryRowContext(ctx, "SELECT count(*) from attachment where hash = ?", hash).Scan(&count)
+	if err != nil {
+		log.WithFields(log.Fields{"hash": hash, "error": err}).Error("Count attachment - reading result error")
+	}
+	return count, err
+}
+
+func (repository sqliteAttachments) DeleteById(ctx context.Context, transaction string, id string) error {
+	result, err := repository.db.ExecContext(ctx, `DELETE from attachment where "transaction" = ? and id = ?`, transaction, id)
+	return sqliteAffected(result, err)
+}
+
+func (repository sqliteAttachments) Read(ctx context.Context, transaction string) ([]Attachment, error) {
+	attachments := []Attachment{}
+
+	rows, err := repository.db.QueryContext(ctx, `SELECT * from attachment where "transaction" = ? order by id`, transaction)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Read attachment - reading result error")
+		return attachments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		att, err := scanSqliteAttachment(rows)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Read attachment - reading result error")
+			return attachments, err
+		}
+		attachments = append(attachments, att)
+	}
+	return attachments, rows.Err()
+}
+
+func (repository sqliteAttachments) ReadById(ctx context.Context, transaction string, id string) (Attachment, error) {
+	att, err := scanSqliteAttachment(repository.db.QueryRowContext(ctx, `SELECT * from attachment where "transaction" = ? and id = ?`, transaction, id))
+	if err != nil && err != sql.ErrNoRows {
+		log.WithFields(log.Fields{"id": id, "error": err}).Error("Read attachment - reading result error")
+	}
+	return att, sqliteErr(err)
+}
+
+func (repository sqliteAttachments) Write(ctx context.Context, attachment *Attachment) (int64, error) {
+	created := time.Now()
+
+	result, err := repository.db.ExecContext(ctx,
+		`INSERT INTO attachment ("transaction", filename, contenttype, size, hash, created) VALUES (?, ?, ?, ?, ?, ?)`,
+		attachment.Transaction, attachment.Filename, attachment.ContentType, attachment.Size, attachment.Hash, sqliteTime(created))
+	if err == nil {
+		attachment.Id, err = result.LastInsertId()
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "attachment": attachment}).Error("addAttachment: Error during insert attachment")
+		return 0, fmt.Errorf("addAttachment insert: %w", sqliteErr(err))
+	}
+
+	attachment.Created = created
+	return attachment.Id, nil
+}
+
+type sqliteReconciliations struct {
+	db sqliteDb
+}
+
+func (repository sqliteReconciliations) ReadById(ctx context.Context, id string) (Reconciliation, error) {
+	rec := Reconciliation{}
+
+	err := repository.db.QueryRowContext(ctx, "SELECT * from reconciliation where id = ?", id).Scan(&rec.Id, &rec.Account, &rec.From, &rec.To, &rec.Created)
+	if err != nil && err != sql.ErrNoRows {
+		log.WithFields(log.Fields{"id": id, "error": err}).Error("Read reconciliation - reading result error")
+	}
+	return rec, sqliteErr(err)
+}
+
+func (repository sqliteReconciliations) Write(ctx context.Context, reconciliation *Reconciliation) (int64, error) {
+	created := time.Now()
+
+	result, err := repository.db.ExecContext(ctx,
+		"INSERT INTO reconciliation (account, period_from, period_to, created) VALUES (?, ?, ?, ?)",
+		reconciliation.Account, sqliteTime(memoryDate(reconciliation.From)), sqliteTime(memoryDate(reconciliation.To)), sqliteTime(created))
+	if err == nil {
+		reconciliation.Id, err = result.LastInsertId()
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "reconciliation": reconciliation}).Error("addReconciliation: Error during insert reconciliation")
+		return 0, fmt.Errorf("addReconciliation insert: %w", sqliteErr(err))
+	}
+
+	reconciliation.Created = created
+	return reconciliation.Id, nil
+}
+
+type sqliteStatementLines struct {
+	db sqliteDb
+}
+
+func scanSqliteStatementLine(row sqliteRow) (StatementLine, error) {
+	line := StatementLine{}
+	err := row.Scan(&line.Id, &line.Reconciliation, &line.Line, &line.Date, &line.Amount,
+		&line.Counterparty, &line.Description, &line.Status, &line.Transaction)
+	return line, err
+}
+
+func (repository sqliteStatementLines) Ignore(ctx context.Context, line *StatementLine) error {
+	result, err := repository.db.ExecContext(ctx, "UPDATE statementline set status = ? where id = ? and status = ?", StatementLineIgnored, line.Id, StatementLineOpen)
+	if err = sqliteAffected(result, err); errors.Is(err, ErrNotFound) {
+		err = conflict("statement line %d is not open", line.Id)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "statementline": line}).Error("ignore statementline: Error during update")
+		return fmt.Errorf("ignore statementline: %w", sqliteErr(err))
+	}
+
+	line.Status = StatementLineIgnored
+	return nil
+}
+
+func (repository sqliteStatementLines) Link(ctx context.Context, line *StatementLine, transaction int64) error {
+	tx, err := sqliteBegin(ctx, repository.db)
+	if err != nil {
+		return sqliteErr(err)
+	}
+	defer tx.Rollback()
+
+	// a line is linked once, also when two links are made at the same time
+	result, err := tx.ExecContext(ctx, `UPDATE statementline set status = ?, "transaction" = ? where id = ? and status = ?`, StatementLineLinked, transaction, line.Id, StatementLineOpen)
+	if err = sqliteAffected(result, err); errors.Is(err, ErrNotFound) {
+		err = conflict("statement line %d is not open", line.Id)
+	}
+	if err == nil {
+		result, err = tx.ExecContext(ctx, `UPDATE "transaction" set reconciled = true where id = ? and reconciled = false`, transaction)
+		if err = sqliteAffected(result, err); errors.Is(err, ErrNotFound) {
+			err = conflict("transaction %d is already reconciled", transaction)
+		}
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "statementline": line, "transaction": transaction}).Error("link statementline: Error during update")
+		return fmt.Errorf("link statementline: %w", sqliteErr(err))
+	}
+
+	line.Status = StatementLineLinked
+	line.Transaction = &transaction
+	return tx.Commit()
+}
+
+func (repository sqliteStatementLines) Read(ctx context.Context, reconciliation int64) ([]StatementLine, error) {
+	lines := []StatementLine{}
+
+	rows, err := repository.db.QueryContext(ctx, "SELECT * from statementline where reconciliation = ? order by line", reconciliation)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Read statementline - reading result error")
+		return lines, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		line, err := scanSqliteStatementLine(rows)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Read statementline - reading result error")
+			return lines, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, rows.Err()
+}
+
+func (repository sqliteStatementLines) ReadById(ctx context.Context, reconciliation int64, id int64) (StatementLine, error) {
+	line, err := scanSqliteStatementLine(repository.db.QueryRowContext(ctx, "SELECT * from statementline where reconciliation = ? and id = ?", reconciliation, id))
+	if err != nil && err != sql.ErrNoRows {
+		log.WithFields(log.Fields{"id": id, "error": err}).Error("Read statementline - reading result error")
+	}
+	return line, sqliteErr(err)
+}
+
+func (repository sqliteStatementLines) UnlinkTransaction(ctx context.Context, transaction int64) error {
+	tx, err := sqliteBegin(ctx, repository.db)
+	if err != nil {
+		return sqliteErr(err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE statementline set status = ?, "transaction" = null where "transaction" = ?`, StatementLineOpen, transaction)
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `UPDATE "transaction" set reconciled = false where id = ?`, transaction)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "transaction": transaction}).Error("unlink transaction: Error during update")
+		return fmt.Errorf("unlink transaction: %w", sqliteErr(err))
+	}
+
+	return tx.Commit()
+}
+
+func (repository sqliteStatementLines) Write(ctx context.Context, line *StatementLine) (int64, error) {
+	if len(line.Status) == 0 {
+		line.Status = StatementLineOpen
+	}
+
+	result, err := repository.db.ExecContext(ctx,
+		`INSERT INTO statementline (reconciliation, line, date, amount, counterparty, description, status, "transaction")
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		line.Reconciliation, line.Line, sqliteTime(memoryDate(line.Date)), line.Amount, line.Counterparty, line.Description, line.Status, line.Transaction)
+	if err == nil {
+		line.Id, err = result.LastInsertId()
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "statementline": line}).Error("addStatementLine: Error during insert statementline")
+		return 0, fmt.Errorf("addStatementLine insert: %w", sqliteErr(err))
+	}
+	return line.Id, nil
+}
+
+type sqliteCsvProfiles struct {
+	db sqliteDb
+}
+
+func scanSqliteCsvProfile(row sqliteRow) (CsvProfile, error) {
+	prof := CsvProfile{}
+	err := row.Scan(&prof.Id, &prof.Name, &prof.Delimiter, &prof.Header,
+		&prof.DateColumn, &prof.DateFormat, &prof.AmountColumn, &prof.SignConvention,
+		&prof.IndicatorColumn, &prof.DebitIndicator, &prof.CounterpartyColumn,
+		&prof.DescriptionColumn, &prof.DecimalSeparator)
+	return prof, err
+}
+
+func (repository sqliteCsvProfiles) DeleteByName(ctx context.Context, name string) error {
+	result, err := repository.db.ExecContext(ctx, "DELETE from csvprofile where name = ?", name)
+	return sqliteAffected(result, err)
+}
+
+func (repository sqliteCsvProfiles) Read(ctx context.Context, limit int64) ([]CsvProfile, error) {
+	profiles := []CsvProfile{}
+
+	rows, err := sqliteSelectFrom("csvprofile").order("name").limitTo(limit).sqliteRows(ctx, repository.db)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Read csvprofile - reading result error")
+		return profiles, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		prof, err := scanSqliteCsvProfile(rows)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Read csvprofile - reading result error")
+			return profiles, err
+		}
+		profiles = append(profiles, prof)
+	}
+	return profiles, rows.Err()
+}
+
+func (repository sqliteCsvProfiles) ReadByName(ctx context.Context, name string) (CsvProfile, error) {
+	prof, err := scanSqliteCsvProfile(repository.db.QueryRowContext(ctx, "SELECT * from csvprofile where name = ?", name))
+	if err != nil && err != sql.ErrNoRows {
+		log.WithFields(log.Fields{"name": name, "error": err}).Error("Read csvprofile - reading result error")
+	}
+	return prof, sqliteErr(err)
+}
+
+func (repository sqliteCsvProfiles) Update(ctx context.Context, profile *CsvProfile) (int64, error) {
+	if profile.Id == 0 {
+		return 0, invalid("identification for csvprofile is missing")
+	}
+
+	_, err := repository.db.ExecContext(ctx,
+		`UPDATE csvprofile set name = ?, delimiter = ?, header = ?, date_column = ?, date_format = ?, amount_column = ?,
+		sign_convention = ?, indicator_column = ?, debit_indicator = ?, counterparty_column = ?, description_column = ?,
+		decimal_separator = ? where id = ?`,
+		profile.Name, profile.Delimiter, profile.Header, profile.DateColumn, profile.DateFormat, profile.AmountColumn,
+		profile.SignConvention, profile.IndicatorColumn, profile.DebitIndicator, profile.CounterpartyColumn, profile.DescriptionColumn,
+		profile.DecimalSeparator, profile.Id)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "csvprofile": profile}).Error("update csvprofile: Error during update csvprofile")
+		return 0, fmt.Errorf("update csvprofile: %w", sqliteErr(err))
+	}
+	return profile.Id, nil
+}
+
+func (repository sqliteCsvProfiles) Write(ctx context.Context, profile *CsvProfile) (int64, error) {
+	result, err := repository.db.ExecContext(ctx,
+		`INSERT INTO csvprofile (name, delimiter, header, date_column, date_format, amount_column, sign_convention,
+		indicator_column, debit_indicator, counterparty_column, description_column, decimal_separator)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		profile.Name, profile.Delimiter, profile.Header, profile.DateColumn, profile.DateFormat, profile.AmountColumn, profile.SignConvention,
+		profile.IndicatorColumn, profile.DebitIndicator, profile.CounterpartyColumn, profile.DescriptionColumn, profile.DecimalSeparator)
+	if err == nil {
+		profile.Id, err = result.LastInsertId()
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "csvprofile": profile}).Error("addCsvProfile: Error during insert csvprofile")
+		return 0, fmt.Errorf("addCsvProfile insert: %w", sqliteErr(err))
+	}
+	return profile.Id, nil
+}
+
+type sqliteAudits struct {
+	db sqliteDb
+}
+
+func (repository sqliteAudits) Read(ctx context.Context, entity string, id int64, from time.Time, to time.Time, limit int64) ([]Audit, error) {
+	audits := []Audit{}
+	query := sqliteSelectFrom("audit")
+
+	if len(entity) > 0 {
+		query.where("entity = ?", entity)
+	}
+	if id != 0 {
+		query.where("entity_id = ?", id)
+	}
+	if !from.IsZero() {
+		query.where("created >= ?", from)
+	}
+	if !to.IsZero() {
+		query.where("created < ?", to)
+	}
+
+	rows, err := query.selecting("id, entity, entity_id, action, old, new, actor, request_id, ticket, created").order("id desc").limitTo(limit).sqliteRows(ctx, repository.db)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Read audit - reading result error")
+		return audits, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var old, new *string
+		a := Audit{}
+
+		err = rows.Scan(&a.Id, &a.Entity, &a.EntityId, &a.Action, &old, &new, &a.Actor, &a.RequestId, &a.Ticket, &a.Created)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Read audit - reading result error")
+			return audits, err
+		}
+		if old != nil {
+			a.Old = json.RawMessage(*old)
+		}
+		if new != nil {
+			a.New = json.RawMessage(*new)
+		}
+		audits = append(audits, a)
+	}
+	return audits, rows.Err()
+}
+
+func (repository sqliteAudits) Write(ctx context.Context, audit *Audit) (int64, error) {
+	created := time.Now()
+
+	result, err := repository.db.ExecContext(ctx,
+		`INSERT INTO audit (entity, entity_id, action, old, new, actor, request_id, ticket, created)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		audit.Entity, audit.EntityId, audit.Action, jsonText(audit.Old), jsonText(audit.New), audit.Actor, audit.RequestId, audit.Ticket, sqliteTime(created))
+	if err == nil {
+		audit.Id, err = result.LastInsertId()
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "audit": audit}).Error("addAudit: Error during insert audit")
+		return 0, fmt.Errorf("addAudit insert: %w", sqliteErr(err))
+	}
+
+	audit.Created = created
+	return audit.Id, nil
+}
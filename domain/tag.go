@@ -0,0 +1,90 @@
+package domain
+
+import (
+	"context"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A free-form label on transactions, a transaction can have many tags
+type Tag struct {
+	Id           int64  `json:"id"`
+	Name         string `json:"name"`
+	Transactions int64  `json:"transactions"`
+}
+
+type ITag interface {
+	Read(ctx context.Context, dbpool Db) ([]Tag, error)
+}
+
+// Read all tags with the number of transactions using them
+func (tag *Tag) Read(ctx context.Context, dbpool Db) ([]Tag, error) {
+	tags := []Tag{}
+
+	rows, err := dbpool.Query(ctx,
+		"SELECT g.id, g.name, count(tt.transaction) from tag g left join transaction_tag tt on tt.tag = g.id group by g.id, g.name order by g.name")
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Read tag - reading result error")
+		return tags, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t := Tag{}
+		err = rows.Scan(&t.Id, &t.Name, &t.Transactions)
+
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Read tag - reading result error")
+			return tags, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// Tags are compared without surrounding white space
+func NormalizeTag(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		return name, invalid("tag is empty")
+	}
+	return name, nil
+}
+
+// Fill the tags of transactions with one query
+func readTags(ctx context.Context, dbpool Db, transactions []Transaction) error {
+	ids := make([]int64, len(transactions))
+	index := map[int64][]int{}
+
+	for i := range transactions {
+		transactions[i].Tags = []string{}
+		ids[i] = transactions[i].Id
+		index[transactions[i].Id] = append(index[transactions[i].Id], i)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := dbpool.Query(ctx,
+		"SELECT tt.transaction, g.name from transaction_tag tt join tag g on g.id = tt.tag where tt.transaction = any($1) order by g.name", ids)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Read tags of transactions - reading result error")
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var name string
+
+		if err = rows.Scan(&id, &name); err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Read tags of transactions - reading result error")
+			return err
+		}
+		for _, i := range index[id] {
+			transactions[i].Tags = append(transactions[i].Tags, name)
+		}
+	}
+	return rows.Err()
+}
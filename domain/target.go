@@ -2,24 +2,42 @@ package domain
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v4"
-	"github.com/jackc/pgx/v4/pgxpool"
 	log "github.com/sirupsen/logrus"
 )
 
 type Target struct {
-	Id          int64  `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	Id          int64      `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Deleted     *time.Time `json:"deleted,omitempty"`
 }
 
+// A target found by search, with its rank and the name and description with the matching words marked
+type TargetMatch struct {
+	Target
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// Searched text of a target, equal to the expression of the search indexes
+const targetDocument = "name || ' ' || coalesce(description, '')"
+
 type ITarget interface {
-	DeleteById(dbpool *pgxpool.Pool, id string) error
-	Read(dbpool *pgxpool.Pool, name string, limit int64) ([]Target, error)
-	ReadById(dbpool *pgxpool.Pool, id string) (Target, error)
-	Write(dbpool *pgxpool.Pool) (int64, error)
+	DeleteById(ctx context.Context, dbpool Db, id string) error
+	Purge(ctx context.Context, dbpool Db, before time.Time) ([]Target, error)
+	Read(ctx context.Context, dbpool Db, name string, page *Page, includeDeleted bool) ([]Target, error)
+	ReadById(ctx context.Context, dbpool Db, id string, includeDeleted bool) (Target, error)
+	ReadByIds(ctx context.Context, dbpool Db, ids []int64) (map[int64]Target, error)
+	ReadByName(ctx context.Context, dbpool Db, name string, includeDeleted bool) (Target, error)
+	ReadForUpdate(ctx context.Context, dbpool Db, id string) (Target, error)
+	Restore(ctx context.Context, dbpool Db, id string) error
+	Search(ctx context.Context, dbpool Db, term string, config string, page *Page, includeDeleted bool) ([]TargetMatch, error)
+	Write(ctx context.Context, dbpool Db) (int64, error)
 
 	GetDescription() string
 	GetId() int64
@@ -30,50 +48,80 @@ type ITarget interface {
 	SetName(number string)
 }
 
-func (target *Target) DeleteById(dbpool *pgxpool.Pool, id string) error {
+// Mark the target deleted, it is kept until it is purged and can be restored until then
+func (target *Target) DeleteById(ctx context.Context, dbpool Db, id string) error {
 	var tar Target
 	var err error
 
-	// check if target exists
-	rows := dbpool.QueryRow(context.Background(), "SELECT * from target where id = $1", id)
+	// check if target exists and is not deleted already
+	rows := dbpool.QueryRow(ctx, "SELECT * from target where id = $1 and deleted is null", id)
 
-	err = rows.Scan(&tar.Id, &tar.Name, &tar.Description)
+	err = rows.Scan(&tar.Id, &tar.Name, &tar.Description, &tar.Deleted)
 
 	if err == nil {
-		_, err = dbpool.Exec(context.Background(), "DELETE from target where id = $1", id)
+		_, err = dbpool.Exec(ctx, "UPDATE target set deleted = now() where id = $1", id)
 		log.WithFields(log.Fields{"error": err}).Debug("Delete target")
 	}
-	return err
+	return dbErr(err)
+}
+
+// Remove targets deleted before a moment, targets still used by transactions are kept
+func (target *Target) Purge(ctx context.Context, dbpool Db, before time.Time) ([]Target, error) {
+	targets := []Target{}
+
+	rows, err := dbpool.Query(ctx,
+		`DELETE from target g where g.deleted < $1
+		and not exists (SELECT 1 from transaction t where t.target = g.id)
+		RETURNING *`, before)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Purge target - delete error")
+		return targets, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		tar := Target{}
+		err = rows.Scan(&tar.Id, &tar.Name, &tar.Description, &tar.Deleted)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Purge target - reading result error")
+			return targets, err
+		}
+		targets = append(targets, tar)
+	}
+	return targets, rows.Err()
 }
 
-func (target *Target) Read(dbpool *pgxpool.Pool, name string, limit int64) ([]Target, error) {
+// Read targets, deleted targets are only included on request
+func (target *Target) Read(ctx context.Context, dbpool Db, name string, page *Page, includeDeleted bool) ([]Target, error) {
 	var rows pgx.Rows
 	var err error
-	var query string = "SELECT * from target"
-	var orderby string = " order by id desc"
-	var where string = " where name='" + name + "'"
 
 	targets := []Target{}
+	query := selectFrom("target")
 
 	if len(name) > 0 {
-		query = query + where
+		query.where("name = ?", name)
+	}
+	if !includeDeleted {
+		query.where("deleted is null")
 	}
 
-	query = query + orderby
+	if err = page.count(ctx, dbpool, query); err != nil {
+		return targets, err
+	}
 
-	if limit > 0 {
-		query = query + " limit $1"
-		rows, err = dbpool.Query(context.Background(), query, limit)
-	} else {
-		rows, err = dbpool.Query(context.Background(), query)
+	if query, err = page.apply(query, nil); err != nil {
+		return targets, err
 	}
+	rows, err = query.rows(ctx, dbpool)
 
 	if err == nil {
+		defer rows.Close()
 		var index = 0
 
 		for rows.Next() {
 			target := Target{}
-			err := rows.Scan(&target.Id, &target.Name, &target.Description)
+			err := rows.Scan(&target.Id, &target.Name, &target.Description, &target.Deleted)
 
 			if err == nil {
 				targets = append(targets, target)
@@ -83,49 +131,154 @@ func (target *Target) Read(dbpool *pgxpool.Pool, name string, limit int64) ([]Ta
 				return targets, err
 			}
 		}
-		return targets, nil
+		if err := rows.Err(); err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Read target - reading result error")
+			return targets, err
+		}
+		return pageRows(page, targets, func(target Target) int64 { return target.Id }), nil
 
 	} else {
-		if err.Error() != "no rows in result set" { // nothing found functional error
+		if !errors.Is(err, pgx.ErrNoRows) { // nothing found functional error
 			log.WithFields(log.Fields{"error": err}).Error("Read target - reading result error")
 		}
 		return targets, err
 	}
 }
 
-func (target *Target) ReadById(dbpool *pgxpool.Pool, id string) (Target, error) {
+// Read the target with the id, a deleted target is only read on request
+func (target *Target) ReadById(ctx context.Context, dbpool Db, id string, includeDeleted bool) (Target, error) {
 	var tar Target
 
-	rows := dbpool.QueryRow(context.Background(), "SELECT * from target where id = $1", id)
+	rows := dbpool.QueryRow(ctx, "SELECT * from target where id = $1"+undeleted(includeDeleted), id)
 
-	err := rows.Scan(&tar.Id, &tar.Name, &tar.Description)
+	err := rows.Scan(&tar.Id, &tar.Name, &tar.Description, &tar.Deleted)
 	log.WithFields(log.Fields{"error": err, "target": target}).Trace("Read target - reading result after scan error")
 
 	if err == nil {
 		return tar, err
 	} else {
-		if err.Error() != "no rows in result set" { // wrong id, functional error
+		if !errors.Is(err, pgx.ErrNoRows) { // wrong id, functional error
 			log.WithFields(log.Fields{"id": id, "error": err}).Error("Read target - reading result error")
 		}
-		return tar, err
+		return tar, dbErr(err)
+	}
+}
+
+// Read the target with the id and lock it until the end of the transaction of dbpool,
+// a concurrent change of the target waits for the transaction
+func (target *Target) ReadForUpdate(ctx context.Context, dbpool Db, id string) (Target, error) {
+	if err := lockRow(ctx, dbpool, "target", id); err != nil {
+		return Target{}, err
+	}
+	return target.ReadById(ctx, dbpool, id, false)
+}
+
+// Read the targets with the ids by id, deleted targets included
+func (target *Target) ReadByIds(ctx context.Context, dbpool Db, ids []int64) (map[int64]Target, error) {
+	targets := map[int64]Target{}
+
+	rows, err := selectFrom("target").whereIn("id", ids).rows(ctx, dbpool)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Read targets by id - reading result error")
+		return targets, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		tar := Target{}
+		if err = rows.Scan(&tar.Id, &tar.Name, &tar.Description, &tar.Deleted); err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Read targets by id - reading result error")
+			return targets, err
+		}
+		targets[tar.Id] = tar
+	}
+	return targets, rows.Err()
+}
+
+// Read the target with the name, a deleted target is only read on request
+func (target *Target) ReadByName(ctx context.Context, dbpool Db, name string, includeDeleted bool) (Target, error) {
+	var tar Target
+
+	rows := dbpool.QueryRow(ctx, "SELECT * from target where name = $1"+undeleted(includeDeleted), name)
+
+	err := rows.Scan(&tar.Id, &tar.Name, &tar.Description, &tar.Deleted)
+	log.WithFields(log.Fields{"error": err, "target": tar}).Trace("Read target by name - reading result after scan error")
+
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) { // unknown name, functional error
+		log.WithFields(log.Fields{"name": name, "error": err}).Error("Read target by name - reading result error")
+	}
+	return tar, dbErr(err)
+}
+
+// Undo the delete of a target
+func (target *Target) Restore(ctx context.Context, dbpool Db, id string) error {
+	var tar Target
+
+	// check if target exists and is deleted
+	rows := dbpool.QueryRow(ctx, "SELECT * from target where id = $1 and deleted is not null", id)
+
+	err := rows.Scan(&tar.Id, &tar.Name, &tar.Description, &tar.Deleted)
+
+	if err == nil {
+		_, err = dbpool.Exec(ctx, "UPDATE target set deleted = null where id = $1", id)
+		log.WithFields(log.Fields{"error": err}).Debug("Restore target")
+	}
+	return dbErr(err)
+}
+
+// Full text search of targets by name and description, deleted targets are only included on request.
+// Config is the text search configuration, see SearchConfigs.
+func (target *Target) Search(ctx context.Context, dbpool Db, term string, config string, page *Page, includeDeleted bool) ([]TargetMatch, error) {
+	matches := []TargetMatch{}
+
+	search, err := newTextSearch(config, targetDocument, term)
+	if err != nil {
+		return matches, err
+	}
+
+	query := search.where(selectFrom("target"))
+	if !includeDeleted {
+		query.where("deleted is null")
+	}
+
+	if err = page.count(ctx, dbpool, query); err != nil {
+		return matches, err
+	}
+
+	rows, err := search.page(query, page).rows(ctx, dbpool)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Search target - reading result error")
+		return matches, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		match := TargetMatch{}
+		err = rows.Scan(&match.Id, &match.Name, &match.Description, &match.Deleted, &match.Rank, &match.Snippet)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Search target - reading result error")
+			return matches, err
+		}
+		matches = append(matches, match)
 	}
+	return pageRows(page, matches, func(match TargetMatch) int64 { return match.Id }), rows.Err()
 }
 
-func (target *Target) Update(dbpool *pgxpool.Pool) (int64, error) {
+func (target *Target) Update(ctx context.Context, dbpool Db) (int64, error) {
 
 	var err error
 	var lastInsertedId int64 = 0
 
 	if target.Id != 0 {
-		_, err = dbpool.Exec(context.Background(), "UPDATE target set name = $2, description = $3 where id = $1", target.Id, target.Name, target.Description)
+		_, err = dbpool.Exec(ctx, "UPDATE target set name = $2, description = $3 where id = $1", target.Id, target.Name, target.Description)
 		lastInsertedId = target.Id
 	} else {
-		return lastInsertedId, fmt.Errorf("identification for target is missing")
+		return lastInsertedId, invalid("identification for target is missing")
 	}
 
 	if err != nil {
 		log.WithFields(log.Fields{"error": err, "target": target}).Error("update target: Error during update target")
-		return 0, fmt.Errorf("addTarget insert: %v", err)
+		return 0, fmt.Errorf("addTarget insert: %w", dbErr(err))
 	} else {
 		log.WithFields(log.Fields{"lastInsertedId": lastInsertedId}).Trace("update target: update target")
 	}
@@ -133,7 +286,7 @@ func (target *Target) Update(dbpool *pgxpool.Pool) (int64, error) {
 	return lastInsertedId, nil
 }
 
-func (target *Target) Write(dbpool *pgxpool.Pool) (int64, error) {
+func (target *Target) Write(ctx context.Context, dbpool Db) (int64, error) {
 	log.Debug("Write targets")
 
 	log.WithFields(log.Fields{"id": target.Id, "name": target.Name, "description": target.Description}).Debug("addTarget: Start addTarget")
@@ -142,15 +295,15 @@ func (target *Target) Write(dbpool *pgxpool.Pool) (int64, error) {
 	var lastInsertedId int64 = 0
 
 	if target.Id != 0 {
-		_, err = dbpool.Exec(context.Background(), "INSERT INTO target (id, name, description) VALUES ($1, $2, $3)", target.Id, target.Name, target.Description)
+		_, err = dbpool.Exec(ctx, "INSERT INTO target (id, name, description) VALUES ($1, $2, $3)", target.Id, target.Name, target.Description)
 		lastInsertedId = target.Id
 	} else {
-		err = dbpool.QueryRow(context.Background(), "INSERT INTO target (name, description) VALUES ($1, $2) RETURNING id", target.Name, target.Description).Scan(&lastInsertedId)
+		err = dbpool.QueryRow(ctx, "INSERT INTO target (name, description) VALUES ($1, $2) RETURNING id", target.Name, target.Description).Scan(&lastInsertedId)
 		target.Id = lastInsertedId
 	}
 	if err != nil {
 		log.WithFields(log.Fields{"error": err, "target": target}).Error("addTarget: Error during insert target")
-		return 0, fmt.Errorf("addTarget insert: %v", err)
+		return 0, fmt.Errorf("addTarget insert: %w", dbErr(err))
 	} else {
 		log.WithFields(log.Fields{"lastInsertedId": lastInsertedId}).Debug("addTarget: insert target")
 	}
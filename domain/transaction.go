@@ -2,97 +2,234 @@ package domain
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v4"
-	"github.com/jackc/pgx/v4/pgxpool"
 	log "github.com/sirupsen/logrus"
 )
 
 type Transaction struct {
-	Id           int64  `json:"id"`
-	From_account int64  `json:"from"`
-	To_account   int64  `json:"to"`
-	Target       int64  `json:"target"`
-	Amount       int64  `json:"amount"`
-	Description  string `json:"description"`
+	Id           int64     `json:"id"`
+	From_account int64     `json:"from"`
+	To_account   int64     `json:"to"`
+	Target       int64     `json:"target"`
+	Amount       int64     `json:"amount"`
+	Description  string    `json:"description"`
+	Date         time.Time `json:"date"`
+	Reconciled   bool      `json:"reconciled"`
+	Tags         []string  `json:"tags"`
 }
 
+// A transaction found by search, with its rank and the description with the matching words marked
+type TransactionMatch struct {
+	Transaction
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// Searched text of a transaction, equal to the expression of the search indexes
+const transactionDocument = "coalesce(description, '')"
+
 type ITransaction interface {
-	DeleteById(dbpool *pgxpool.Pool, id string) error
-	Read(dbpool *pgxpool.Pool, from string, to string, limit int64) ([]Transaction, error)
-	ReadById(dbpool *pgxpool.Pool) (Transaction, error)
-	Update(dbpool *pgxpool.Pool) (int64, error)
-	Write(dbpool *pgxpool.Pool) (int64, error)
+	DeleteById(ctx context.Context, dbpool Db, id string) error
+	Read(ctx context.Context, dbpool Db, filter TransactionFilter, page *Page) ([]Transaction, error)
+	ReadById(ctx context.Context, dbpool Db) (Transaction, error)
+	ReadByAccount(ctx context.Context, dbpool Db, account int64, from time.Time, to time.Time, tag string) ([]Transaction, error)
+	ReadForUpdate(ctx context.Context, dbpool Db, id string) (Transaction, error)
+	Search(ctx context.Context, dbpool Db, term string, config string, page *Page) ([]TransactionMatch, error)
+	Update(ctx context.Context, dbpool Db) (int64, error)
+	Write(ctx context.Context, dbpool Db) (int64, error)
 	GetId() int64
 	GetFromAccount() int64
 	GetToAccount() int64
 	GetTarget() int64
 	GetAmount() int64
+	GetDate() time.Time
+	IsReconciled() bool
 	SetId(id int64)
 	SetFromAccount(from_account int64)
 	SetToAccount(to_account int64)
 	SetTarget(target int64)
 	SetAmount(amount int64)
 	SetDescription(description string)
-	AddTransaction(dbpool *pgxpool.Pool) (int64, error)
+	SetDate(date time.Time)
+	AddTag(ctx context.Context, dbpool Db, tag string) error
+	RemoveTag(ctx context.Context, dbpool Db, tag string) error
+	AddTransaction(ctx context.Context, dbpool Db) (int64, error)
 }
 
-func (transaction *Transaction) DeleteById(dbpool *pgxpool.Pool, id string) error {
+func (transaction *Transaction) DeleteById(ctx context.Context, dbpool Db, id string) error {
 	var trans Transaction
+	var date *time.Time
 	var err error
 
 	// check if transaction exists
-	rows := dbpool.QueryRow(context.Background(), "SELECT * from transaction where id = $1", id)
+	rows := dbpool.QueryRow(ctx, "SELECT * from transaction where id = $1", id)
 
-	err = rows.Scan(&trans.Id, &trans.From_account, &trans.To_account, &trans.Target, &trans.Amount, &trans.Description)
+	err = rows.Scan(&trans.Id, &trans.From_account, &trans.To_account, &trans.Target, &trans.Amount, &trans.Description, &date, &trans.Reconciled)
 
 	if err == nil {
-		_, err = dbpool.Exec(context.Background(), "DELETE from transaction where id = $1", id)
+		_, err = dbpool.Exec(ctx, "DELETE from transaction where id = $1", id)
 		log.WithFields(log.Fields{"error": err}).Trace("Delete transaction")
 	}
-	return err
+	return dbErr(err)
+}
+
+// The date of a transaction as scanned. The transactions of a database from before the date column have none,
+// they get the zero time
+func scannedDate(date *time.Time) time.Time {
+	if date == nil {
+		return time.Time{}
+	}
+	return *date
+}
+
+// The date of a transaction to write, the zero time remains without date
+func dateValue(date time.Time) any {
+	if date.IsZero() {
+		return nil
+	}
+	return date
+}
+
+// Table of the transactions in the sql shared with sqlite, transaction is a keyword of sqlite
+const transactionTable = `"transaction"`
+
+// Selection of transactions having tag
+const tagCriterium = `id in (SELECT tt."transaction" from transaction_tag tt join tag g on g.id = tt.tag where g.name = ?)`
+
+// Criteria to select transactions, zero values select everything
+type TransactionFilter struct {
+	From        int64     // account the amount leaves
+	To          int64     // account the amount arrives at
+	Account     int64     // from or to account
+	Targets     []int64   // any of the targets
+	MinAmount   *int64    // inclusive, in cents
+	MaxAmount   *int64    // inclusive, in cents
+	FromDate    time.Time // inclusive
+	ToDate      time.Time // inclusive
+	Description string    // part of the description, case insensitive
+	Tag         string
+}
+
+// Columns transactions can be sorted by
+var TransactionSort = map[string]bool{"id": true, "date": true, "amount": true, "description": true, "target": true}
+
+// the expressions ordering the columns of TransactionSort in the database, a missing amount or description
+// orders as 0 or empty like in memory, a missing date as the zero time
+var transactionOrder = map[string]string{
+	"id":          "id",
+	"date":        "coalesce(date, '0001-01-01')",
+	"amount":      "coalesce(amount, 0)",
+	"description": "coalesce(description, '')",
+	"target":      "target",
+}
+
+// add the conditions of the filter to the query
+func (filter TransactionFilter) apply(q *query) *query {
+	if filter.From != 0 {
+		q.where("from_account = ?", filter.From)
+	}
+	if filter.To != 0 {
+		q.where("to_account = ?", filter.To)
+	}
+	if filter.Account != 0 {
+		q.where("? in (from_account, to_account)", filter.Account)
+	}
+	if len(filter.Targets) > 0 {
+		q.whereIn("target", filter.Targets)
+	}
+	if filter.MinAmount != nil {
+		q.where("amount >= ?", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		q.where("amount <= ?", *filter.MaxAmount)
+	}
+	if !filter.FromDate.IsZero() {
+		q.where("date >= ?", filter.FromDate)
+	}
+	if !filter.ToDate.IsZero() {
+		q.where("date <= ?", filter.ToDate)
+	}
+	if len(filter.Description) > 0 {
+		q.whereContains("description", filter.Description)
+	}
+	if len(filter.Tag) > 0 {
+		q.where(tagCriterium, filter.Tag)
+	}
+	return q
+}
+
+// true when the transaction is selected by the filter, the same way apply selects it in the database
+func (filter TransactionFilter) matches(transaction Transaction) bool {
+	switch {
+	case filter.From != 0 && transaction.From_account != filter.From,
+		filter.To != 0 && transaction.To_account != filter.To,
+		filter.Account != 0 && transaction.From_account != filter.Account && transaction.To_account != filter.Account,
+		filter.MinAmount != nil && transaction.Amount < *filter.MinAmount,
+		filter.MaxAmount != nil && transaction.Amount > *filter.MaxAmount,
+		!filter.FromDate.IsZero() && transaction.Date.Before(filter.FromDate),
+		!filter.ToDate.IsZero() && transaction.Date.After(filter.ToDate),
+		len(filter.Description) > 0 && !strings.Contains(strings.ToLower(transaction.Description), strings.ToLower(filter.Description)),
+		len(filter.Tag) > 0 && !transaction.HasTag(filter.Tag):
+		return false
+	}
+	if len(filter.Targets) == 0 {
+		return true
+	}
+	for _, target := range filter.Targets {
+		if transaction.Target == target {
+			return true
+		}
+	}
+	return false
 }
 
-func (transaction *Transaction) Read(dbpool *pgxpool.Pool, from_account string, to_account string, limit int64) ([]Transaction, error) {
+// order of the transaction and other by a column of TransactionSort, -1, 0 or 1
+func (transaction *Transaction) compare(other Transaction, column string) int {
+	switch column {
+	case "date":
+		return compareInt(transaction.Date.UnixNano(), other.Date.UnixNano())
+	case "amount":
+		return compareInt(transaction.Amount, other.Amount)
+	case "description":
+		return strings.Compare(transaction.Description, other.Description)
+	case "target":
+		return compareInt(transaction.Target, other.Target)
+	}
+	return compareInt(transaction.Id, other.Id)
+}
+
+// Read a page of the transactions selected by filter
+func (transaction *Transaction) Read(ctx context.Context, dbpool Db, filter TransactionFilter, page *Page) ([]Transaction, error) {
 	var rows pgx.Rows
 	var err error
-	var query string = "SELECT * from transaction"
-	var orderby string = " order by id desc"
-	var where string = " where"
-	var fromcrit string = " from_account='" + from_account + "'"
-	var tocrit string = " to_account='" + to_account + "'"
 
 	transactions := []Transaction{}
 
-	if len(from_account) > 0 {
-		query = query + where + fromcrit
-		if len(to_account) > 0 {
-			query = query + " and" + tocrit
-		}
+	query := filter.apply(selectFrom(transactionTable))
 
-	} else {
-		if len(to_account) > 0 {
-			query = query + where + tocrit
-		}
+	if err = page.count(ctx, dbpool, query); err != nil {
+		return transactions, err
 	}
 
-	query = query + orderby
-
-	if limit > 0 {
-		query = query + " limit $1"
-		rows, err = dbpool.Query(context.Background(), query, limit)
-	} else {
-		rows, err = dbpool.Query(context.Background(), query)
+	if query, err = page.apply(query, transactionOrder); err != nil {
+		return transactions, err
 	}
-	log.WithFields(log.Fields{"query": query}).Trace("Query to get all transactions")
+	rows, err = query.rows(ctx, dbpool)
 
 	if err == nil {
+		defer rows.Close()
 		var index = 0
 
 		for rows.Next() {
 			transaction := Transaction{}
-			err := rows.Scan(&transaction.Id, &transaction.From_account, &transaction.To_account, &transaction.Target, &transaction.Amount, &transaction.Description)
+			var date *time.Time
+			err := rows.Scan(&transaction.Id, &transaction.From_account, &transaction.To_account, &transaction.Target, &transaction.Amount, &transaction.Description, &date, &transaction.Reconciled)
+			transaction.Date = scannedDate(date)
 
 			if err == nil {
 				transactions = append(transactions, transaction)
@@ -102,47 +239,217 @@ func (transaction *Transaction) Read(dbpool *pgxpool.Pool, from_account string,
 				return transactions, err
 			}
 		}
-		return transactions, nil
+		if err := rows.Err(); err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Read transactions - reading result error")
+			return transactions, err
+		}
+		transactions = pageRows(page, transactions, func(transaction Transaction) int64 { return transaction.Id })
+		return transactions, readTags(ctx, dbpool, transactions)
 	} else {
-		if err.Error() != "no rows in result set" { // nothing found functional error
+		if !errors.Is(err, pgx.ErrNoRows) { // nothing found functional error
 			log.WithFields(log.Fields{"error": err}).Error("Read transaction - reading result error")
 		}
 		return transactions, err
 	}
 }
 
-func (transaction *Transaction) ReadById(dbpool *pgxpool.Pool, id string) (Transaction, error) {
+func (transaction *Transaction) ReadById(ctx context.Context, dbpool Db, id string) (Transaction, error) {
 	var trans Transaction
+	var date *time.Time
 
-	rows := dbpool.QueryRow(context.Background(), "SELECT * from transaction where id = $1", id)
+	rows := dbpool.QueryRow(ctx, "SELECT * from transaction where id = $1", id)
 
-	err := rows.Scan(&trans.Id, &trans.From_account, &trans.To_account, &trans.Target, &trans.Amount, &trans.Description)
+	err := rows.Scan(&trans.Id, &trans.From_account, &trans.To_account, &trans.Target, &trans.Amount, &trans.Description, &date, &trans.Reconciled)
+	trans.Date = scannedDate(date)
 	log.WithFields(log.Fields{"error": err, "transaction": trans}).Trace("Read transaction - reading result after scan error")
 
 	if err == nil {
-		return trans, err
+		transactions := []Transaction{trans}
+		err = readTags(ctx, dbpool, transactions)
+		return transactions[0], dbErr(err)
 	} else {
-		if err.Error() != "no rows in result set" { // wrong id, functional error
+		if !errors.Is(err, pgx.ErrNoRows) { // wrong id, functional error
 			log.WithFields(log.Fields{"id": id, "error": err}).Error("Read transaction - reading result error")
 		}
-		return trans, err
+		return trans, dbErr(err)
+	}
+}
+
+// Read the transaction with the id and lock it until the end of the transaction of dbpool,
+// a concurrent change of the transaction waits for the transaction
+func (transaction *Transaction) ReadForUpdate(ctx context.Context, dbpool Db, id string) (Transaction, error) {
+	if err := lockRow(ctx, dbpool, "transaction", id); err != nil {
+		return Transaction{}, err
+	}
+	return transaction.ReadById(ctx, dbpool, id)
+}
+
+// Read all transactions from or to account ordered by date, a zero from or to date means no limit
+// and an empty tag means all transactions
+func (transaction *Transaction) ReadByAccount(ctx context.Context, dbpool Db, account int64, from time.Time, to time.Time, tag string) ([]Transaction, error) {
+	transactions := []Transaction{}
+
+	filter := TransactionFilter{Account: account, FromDate: from, ToDate: to, Tag: tag}
+	rows, err := filter.apply(selectFrom(transactionTable)).order(transactionOrder["date"]+", id").rows(ctx, dbpool)
+
+	if err != nil {
+		log.WithFields(log.Fields{"account": account, "error": err}).Error("Read transactions of account - reading result error")
+		return transactions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		trans := Transaction{}
+		var date *time.Time
+		err = rows.Scan(&trans.Id, &trans.From_account, &trans.To_account, &trans.Target, &trans.Amount, &trans.Description, &date, &trans.Reconciled)
+		trans.Date = scannedDate(date)
+
+		if err != nil {
+			log.WithFields(log.Fields{"account": account, "error": err}).Error("Read transactions of account - reading result error")
+			return transactions, err
+		}
+		transactions = append(transactions, trans)
 	}
+	if err = rows.Err(); err != nil {
+		return transactions, err
+	}
+	return transactions, readTags(ctx, dbpool, transactions)
 }
 
-func (transaction *Transaction) Update(dbpool *pgxpool.Pool) (int64, error) {
+// Add tag to the transaction, the tag is created when it is new
+func (transaction *Transaction) AddTag(ctx context.Context, dbpool Db, tag string) error {
+	tag, err := NormalizeTag(tag)
+	if err != nil {
+		return dbErr(err)
+	}
+
+	_, err = dbpool.Exec(ctx,
+		`WITH t AS (INSERT INTO tag (name) VALUES ($2) ON CONFLICT (name) DO UPDATE SET name = excluded.name RETURNING id)
+		INSERT INTO transaction_tag (transaction, tag) SELECT $1, id from t ON CONFLICT DO NOTHING`, transaction.Id, tag)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "transaction": transaction.Id, "tag": tag}).Error("add tag: Error during insert tag")
+		return fmt.Errorf("add tag: %w", dbErr(err))
+	}
+
+	for _, name := range transaction.Tags {
+		if name == tag {
+			return nil
+		}
+	}
+	transaction.Tags = append(transaction.Tags, tag)
+	return nil
+}
+
+// Remove tag from the transaction, the tag itself is kept
+func (transaction *Transaction) RemoveTag(ctx context.Context, dbpool Db, tag string) error {
+	tag, err := NormalizeTag(tag)
+	if err != nil {
+		return dbErr(err)
+	}
+
+	_, err = dbpool.Exec(ctx,
+		"DELETE from transaction_tag where transaction = $1 and tag in (SELECT id from tag where name = $2)", transaction.Id, tag)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err, "transaction": transaction.Id, "tag": tag}).Error("remove tag: Error during delete tag")
+		return fmt.Errorf("remove tag: %w", dbErr(err))
+	}
+
+	tags := []string{}
+	for _, name := range transaction.Tags {
+		if name != tag {
+			tags = append(tags, name)
+		}
+	}
+	transaction.Tags = tags
+	return nil
+}
+
+// Amount of the transaction seen from account, negative when the amount leaves the account
+func (transaction *Transaction) SignedAmount(account int64) int64 {
+	var amount int64 = 0
+
+	if transaction.To_account == account {
+		amount = amount + transaction.Amount
+	}
+	if transaction.From_account == account {
+		amount = amount - transaction.Amount
+	}
+	return amount
+}
+
+// The other account of the transaction seen from account
+func (transaction *Transaction) Counterparty(account int64) int64 {
+	if transaction.From_account == account {
+		return transaction.To_account
+	}
+	return transaction.From_account
+}
+
+// Full text search of transactions by description.
+// Config is the text search configuration, see SearchConfigs.
+func (transaction *Transaction) Search(ctx context.Context, dbpool Db, term string, config string, page *Page) ([]TransactionMatch, error) {
+	matches := []TransactionMatch{}
+
+	search, err := newTextSearch(config, transactionDocument, term)
+	if err != nil {
+		return matches, err
+	}
+
+	query := search.where(selectFrom(transactionTable))
+
+	if err = page.count(ctx, dbpool, query); err != nil {
+		return matches, err
+	}
+
+	rows, err := search.page(query, page).rows(ctx, dbpool)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Search transaction - reading result error")
+		return matches, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		match := TransactionMatch{}
+		var date *time.Time
+		err = rows.Scan(&match.Id, &match.From_account, &match.To_account, &match.Target, &match.Amount, &match.Description, &date, &match.Reconciled,
+			&match.Rank, &match.Snippet)
+		match.Date = scannedDate(date)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Search transaction - reading result error")
+			return matches, err
+		}
+		matches = append(matches, match)
+	}
+	if err = rows.Err(); err != nil {
+		return matches, err
+	}
+	matches = pageRows(page, matches, func(match TransactionMatch) int64 { return match.Id })
+
+	transactions := make([]Transaction, len(matches))
+	for i := range matches {
+		transactions[i] = matches[i].Transaction
+	}
+	err = readTags(ctx, dbpool, transactions)
+	for i := range matches {
+		matches[i].Tags = transactions[i].Tags
+	}
+	return matches, err
+}
+
+func (transaction *Transaction) Update(ctx context.Context, dbpool Db) (int64, error) {
 	var err error
 	var lastInsertedId int64 = 0
 
 	if transaction.Id != 0 {
-		_, err = dbpool.Exec(context.Background(), "UPDATE transaction set from_account = '$2', to_account = '$3', target = $4, amount = $5, description = '$3' where id = $1", transaction.Id, transaction.From_account, transaction.To_account, transaction.Target, transaction.Amount, transaction.Description)
+		_, err = dbpool.Exec(ctx, "UPDATE transaction set from_account = $2, to_account = $3, target = $4, amount = $5, description = $6, date = $7 where id = $1", transaction.Id, transaction.From_account, transaction.To_account, transaction.Target, transaction.Amount, transaction.Description, dateValue(transaction.Date))
 		lastInsertedId = transaction.Id
 	} else {
-		return lastInsertedId, fmt.Errorf("identification for transaction is missing")
+		return lastInsertedId, invalid("identification for transaction is missing")
 	}
 
 	if err != nil {
 		log.WithFields(log.Fields{"error": err, "transaction": transaction}).Error("update transaction: Error during update transaction")
-		return 0, fmt.Errorf("update Transaction insert: %v", err)
+		return 0, fmt.Errorf("update Transaction insert: %w", dbErr(err))
 	} else {
 		log.WithFields(log.Fields{"lastInsertedId": lastInsertedId}).Trace("update transaction: update transaction")
 	}
@@ -150,7 +457,7 @@ func (transaction *Transaction) Update(dbpool *pgxpool.Pool) (int64, error) {
 	return lastInsertedId, nil
 }
 
-func (transaction *Transaction) Write(dbpool *pgxpool.Pool) (int64, error) {
+func (transaction *Transaction) Write(ctx context.Context, dbpool Db) (int64, error) {
 	log.Debug("Write transaction")
 
 	log.WithFields(log.Fields{"id": transaction.Id,
@@ -159,37 +466,50 @@ func (transaction *Transaction) Write(dbpool *pgxpool.Pool) (int64, error) {
 		"target id":    transaction.Target,
 		"amount":       transaction.Amount,
 		"description":  transaction.Description,
+		"date":         transaction.Date,
 	}).Debug("addTransaction: Start addTransaction")
 
 	var err error
 	var lastInsertedId int64 = 0
 
+	if transaction.Date.IsZero() {
+		transaction.Date = time.Now()
+	}
+
 	if transaction.Id != 0 {
-		_, err = dbpool.Exec(context.Background(),
-			"INSERT INTO transaction (id, from_account, to_account, target, amount, description) VALUES ($1, $2, $3, $4, $5, $6)",
-			transaction.Id, transaction.From_account, transaction.To_account, transaction.Target, transaction.Amount, transaction.Description)
+		_, err = dbpool.Exec(ctx,
+			"INSERT INTO transaction (id, from_account, to_account, target, amount, description, date) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+			transaction.Id, transaction.From_account, transaction.To_account, transaction.Target, transaction.Amount, transaction.Description, transaction.Date)
 		lastInsertedId = transaction.Id
 	} else {
-		err = dbpool.QueryRow(context.Background(),
-			"INSERT INTO transaction (from_account, to_account, target, amount, description) VALUES ($1, $2, $3, $4, $5) RETURNING id",
-			transaction.From_account, transaction.To_account, transaction.Target, transaction.Amount, transaction.Description).Scan(&lastInsertedId)
+		err = dbpool.QueryRow(ctx,
+			"INSERT INTO transaction (from_account, to_account, target, amount, description, date) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+			transaction.From_account, transaction.To_account, transaction.Target, transaction.Amount, transaction.Description, transaction.Date).Scan(&lastInsertedId)
 		transaction.Id = lastInsertedId
 	}
 
 	if err != nil {
 		log.WithFields(log.Fields{"error": err, "transaction": transaction}).Error("addTransaction: Error during insert target")
-		return 0, fmt.Errorf("addTaaddTransactionrget insert: %v", err)
+		return 0, fmt.Errorf("addTaaddTransactionrget insert: %w", dbErr(err))
 	} else {
 		log.WithFields(log.Fields{"lastInsertedId": lastInsertedId}).Debug("addTransaction: insert target")
 	}
 
-	return lastInsertedId, err
+	tags := transaction.Tags
+	transaction.Tags = []string{}
+	for _, tag := range tags {
+		if err = transaction.AddTag(ctx, dbpool, tag); err != nil {
+			return lastInsertedId, dbErr(err)
+		}
+	}
+
+	return lastInsertedId, dbErr(err)
 }
 
-func (transaction *Transaction) AddTransaction(dbpool *pgxpool.Pool) (int64, error) {
+func (transaction *Transaction) AddTransaction(ctx context.Context, dbpool Db) (int64, error) {
 	log.Debug("Add transaction")
 
-	id, err := transaction.Write(dbpool)
+	id, err := transaction.Write(ctx, dbpool)
 
 	if err != nil {
 		return 0, err
@@ -222,6 +542,27 @@ func (transaction *Transaction) GetDescription() string {
 	return transaction.Description
 }
 
+func (transaction *Transaction) GetDate() time.Time {
+	return transaction.Date
+}
+
+func (transaction *Transaction) IsReconciled() bool {
+	return transaction.Reconciled
+}
+
+// Check the transaction has tag, every transaction has the empty tag
+func (transaction *Transaction) HasTag(tag string) bool {
+	if len(tag) == 0 {
+		return true
+	}
+	for _, name := range transaction.Tags {
+		if name == tag {
+			return true
+		}
+	}
+	return false
+}
+
 func (transaction *Transaction) SetId(id int64) {
 	transaction.Id = id
 }
@@ -245,3 +586,7 @@ func (transaction *Transaction) SetAmount(amount int64) {
 func (transaction *Transaction) SetDescription(description string) {
 	transaction.Description = description
 }
+
+func (transaction *Transaction) SetDate(date time.Time) {
+	transaction.Date = date
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/bank/config"
+	"github.com/bank/migrations"
+	"github.com/bank/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// Apply, undo or show the schema migrations of the database.
+// Usage: bank migrate up | down [-steps 1] [-all] | status
+func migrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: bank migrate up | down [-steps 1] [-all] | status")
+	}
+
+	db := migrationDatabase()
+	switch args[0] {
+	case "up":
+		done, err := migrations.Up(context.Background(), db)
+		if err != nil {
+			return fmt.Errorf("migrate up: %w", err)
+		}
+		log.WithFields(log.Fields{"migrations": len(done)}).Info("Migrated up")
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := flags.Int("steps", 1, "number of migrations to undo")
+		all := flags.Bool("all", false, "undo all migrations, dropping all tables")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *all {
+			*steps = 0
+		} else if *steps < 1 {
+			return errors.New("migrate down -steps must be at least 1, use -all to undo all migrations")
+		}
+
+		done, err := migrations.Down(context.Background(), db, *steps)
+		if err != nil {
+			return fmt.Errorf("migrate down: %w", err)
+		}
+		log.WithFields(log.Fields{"migrations": len(done)}).Info("Migrated down")
+	case "status":
+		statuses, err := migrations.Statuses(context.Background(), db)
+		if err != nil {
+			return fmt.Errorf("migrate status: %w", err)
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.Applied != nil {
+				applied = status.Applied.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d %-30s %s\n", status.Version, status.Name, applied)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %s, use up, down or status", args[0])
+	}
+	return nil
+}
+
+// Apply the migrations at startup, always for sqlite as its file is created on first use, and for postgres when
+// auto migrate is configured. Instances starting at the same time wait on each other by the advisory lock of postgres.
+func migrateAtStartup() error {
+	if util.Sqlite == nil {
+		if util.Dbpool == nil || !config.Current.AutoMigrate {
+			return nil
+		}
+	}
+
+	if _, err := migrations.Up(context.Background(), migrationDatabase()); err != nil {
+		return fmt.Errorf("migrate at startup: %w", err)
+	}
+	return nil
+}
+
+func migrationDatabase() migrations.Database {
+	if util.Sqlite != nil {
+		return migrations.Sqlite(util.Sqlite)
+	}
+	return migrations.Postgres(util.Dbpool)
+}
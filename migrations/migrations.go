@@ -0,0 +1,187 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The migrations of each database, a directory per dialect with the files <version>_<name>.up.sql and
+// <version>_<name>.down.sql. A new migration gets the next version, applied migrations are never changed.
+//
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// A change of the schema, up applies it and down undoes it
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+}
+
+// A migration and when it was applied, Applied is nil when it is not applied
+type Status struct {
+	Migration
+	Applied *time.Time
+}
+
+// A database the migrations of its dialect are applied to, its applied versions are kept in the table schema_migrations
+type Database interface {
+	// the directory of the migrations of the database
+	dialect() string
+	// prevent others from migrating the database at the same time, and create schema_migrations when it does not exist
+	lock(ctx context.Context) (unlock func(), err error)
+	// the time each applied version was applied
+	applied(ctx context.Context) (map[int64]time.Time, error)
+	// run the up or down sql of the migration and record it in schema_migrations in one transaction
+	apply(ctx context.Context, migration Migration, up bool) error
+}
+
+// The migrations of the dialect ordered by version
+func load(dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration %s/%s is not named <version>_<name>.up.sql or .down.sql", dialect, entry.Name())
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		content, err := fs.ReadFile(files, dialect+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %s version %d has the names %s and %s", dialect, version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.up = string(content)
+		} else {
+			migration.down = string(content)
+		}
+	}
+
+	migrations := []Migration{}
+	for _, migration := range byVersion {
+		if migration.up == "" || migration.down == "" {
+			return nil, fmt.Errorf("migration %s %d_%s misses its up or down sql", dialect, migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Apply the migrations that are not applied yet in order of version, returns the applied migrations
+func Up(ctx context.Context, db Database) ([]Migration, error) {
+	migrations, err := load(db.dialect())
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := db.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	applied, err := db.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		log.WithFields(log.Fields{"version": migration.Version, "name": migration.Name}).Info("Migrate up")
+		if err := db.apply(ctx, migration, true); err != nil {
+			return done, fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Undo the last steps applied migrations in reverse order of version, all of them when steps is 0,
+// returns the undone migrations
+func Down(ctx context.Context, db Database, steps int) ([]Migration, error) {
+	migrations, err := load(db.dialect())
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := db.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	applied, err := db.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for i := len(migrations) - 1; i >= 0 && (steps == 0 || len(done) < steps); i-- {
+		migration := migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		log.WithFields(log.Fields{"version": migration.Version, "name": migration.Name}).Info("Migrate down")
+		if err := db.apply(ctx, migration, false); err != nil {
+			return done, fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// The migrations with when they were applied, ordered by version
+func Statuses(ctx context.Context, db Database) ([]Status, error) {
+	migrations, err := load(db.dialect())
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := db.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	applied, err := db.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []Status{}
+	for _, migration := range migrations {
+		status := Status{Migration: migration}
+		if at, ok := applied[migration.Version]; ok {
+			status.Applied = &at
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
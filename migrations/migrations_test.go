@@ -0,0 +1,269 @@
+package migrations
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bank/domain"
+	"github.com/bank/util"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// The tables of the former sql/initialize.sql, before the columns added by 0002_added_columns
+const legacySchema = `
+create table target (id bigserial, name text not null, description text, primary key (id), unique (name));
+create table account (id bigserial, number text not null, description text, primary key (id), unique (number));
+create table transaction (
+    id bigserial,
+    from_account bigint not null,
+    to_account bigint not null,
+    target bigint not null,
+    amount bigint,
+    description text,
+    primary key (id),
+    foreign key (from_account) references account (id),
+    foreign key (to_account) references account (id),
+    foreign key (target) references target (id)
+);
+insert into target (name) values ('groceries');
+insert into account (number) values ('NL01BANK0001'), ('NL02SHOP0002');
+insert into transaction (from_account, to_account, target, amount, description) values (1, 2, 1, 1250, 'weekly shopping');
+`
+
+// A new sqlite database in a temporary directory
+func sqliteDatabase(t *testing.T) Database {
+	db, err := util.SqliteOpen(filepath.Join(t.TempDir(), "bank.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return Sqlite(db)
+}
+
+// A pool of TEST_DATABASE_URL on a schema of its own, dropped after the test
+func postgresPool(t *testing.T) *pgxpool.Pool {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if len(url) == 0 {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	schema := "migrate_" + strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	admin, err := pgxpool.Connect(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admin.Exec(ctx, "create schema "+schema); err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+
+	config, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ConnConfig.RuntimeParams["search_path"] = schema
+	pool, err := pgxpool.ConnectConfig(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		pool.Close()
+		admin.Exec(ctx, "drop schema "+schema+" cascade")
+		admin.Close()
+	})
+	return pool
+}
+
+// The versions of the statuses that are applied
+func appliedVersions(t *testing.T, db Database) []int64 {
+	t.Helper()
+	statuses, err := Statuses(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := []int64{}
+	for _, status := range statuses {
+		if status.Applied != nil {
+			versions = append(versions, status.Version)
+		}
+	}
+	return versions
+}
+
+func TestLoad(t *testing.T) {
+	for _, dialect := range []string{"postgres", "sqlite"} {
+		migrations, err := load(dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(migrations) == 0 {
+			t.Fatalf("%s has no migrations", dialect)
+		}
+		for i, migration := range migrations {
+			if migration.Version != int64(i+1) {
+				t.Errorf("%s migration %d_%s, want version %d", dialect, migration.Version, migration.Name, i+1)
+			}
+		}
+	}
+}
+
+// Up, down and status on database db of dialect
+func testUpDownStatus(t *testing.T, db Database) {
+	ctx := context.Background()
+	migrations, err := load(db.dialect())
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := migrations[len(migrations)-1].Version
+
+	if applied := appliedVersions(t, db); len(applied) != 0 {
+		t.Fatalf("applied %v on a new database, want none", applied)
+	}
+
+	done, err := Up(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(migrations) || len(appliedVersions(t, db)) != len(migrations) {
+		t.Fatalf("up applied %d, want all %d", len(done), len(migrations))
+	}
+	if done, err := Up(ctx, db); err != nil || len(done) != 0 {
+		t.Fatalf("second up applied %d: %v, want none", len(done), err)
+	}
+
+	// down undoes the last migration, up applies it again
+	done, err = Down(ctx, db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied := appliedVersions(t, db); len(done) != 1 || done[0].Version != last || len(applied) != len(migrations)-1 {
+		t.Fatalf("down undid %v, applied %v, want the last version %d undone", done, applied, last)
+	}
+	if done, err := Up(ctx, db); err != nil || len(done) != 1 || done[0].Version != last {
+		t.Fatalf("up applied %v: %v, want version %d", done, err, last)
+	}
+
+	// down all drops every table, after which up creates them again
+	done, err = Down(ctx, db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied := appliedVersions(t, db); len(done) != len(migrations) || len(applied) != 0 || done[0].Version != last {
+		t.Fatalf("down all undid %v, applied %v, want all undone from the last", done, applied)
+	}
+	if done, err := Up(ctx, db); err != nil || len(done) != len(migrations) {
+		t.Fatalf("up after down all applied %d: %v, want all", len(done), err)
+	}
+}
+
+func TestSqliteUpDownStatus(t *testing.T) {
+	testUpDownStatus(t, sqliteDatabase(t))
+}
+
+func TestPostgresUpDownStatus(t *testing.T) {
+	testUpDownStatus(t, Postgres(postgresPool(t)))
+}
+
+// Instances starting at the same time migrate one after the other by the advisory lock
+func TestPostgresLock(t *testing.T) {
+	ctx := context.Background()
+	pool := postgresPool(t)
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", postgresLock); err != nil {
+		t.Fatal(err)
+	}
+	migrated := make(chan error, 1)
+	go func() {
+		_, err := Up(ctx, Postgres(pool))
+		migrated <- err
+	}()
+	select {
+	case err := <-migrated:
+		t.Fatalf("migrated while another holds the lock: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", postgresLock)
+	conn.Release()
+	if err := <-migrated; err != nil {
+		t.Fatal(err)
+	}
+
+	// every migration is applied once by one of the instances
+	if _, err := Down(ctx, Postgres(pool), 0); err != nil {
+		t.Fatal(err)
+	}
+	var wait sync.WaitGroup
+	var mutex sync.Mutex
+	applied := 0
+	for i := 0; i < 4; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			done, err := Up(ctx, Postgres(pool))
+			if err != nil {
+				t.Error(err)
+			}
+			mutex.Lock()
+			applied += len(done)
+			mutex.Unlock()
+		}()
+	}
+	wait.Wait()
+	if migrations, _ := load("postgres"); applied != len(migrations) {
+		t.Errorf("applied %d migrations, want each of the %d once", applied, len(migrations))
+	}
+}
+
+// A database of the former sql/initialize.sql is taken over, its transactions keep an unknown date
+func TestPostgresAddedColumns(t *testing.T) {
+	ctx := context.Background()
+	pool := postgresPool(t)
+	if _, err := pool.Exec(ctx, legacySchema); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Up(ctx, Postgres(pool)); err != nil {
+		t.Fatal(err)
+	}
+
+	var date *time.Time
+	var reconciled bool
+	if err := pool.QueryRow(ctx, "SELECT date, reconciled FROM transaction WHERE id = 1").Scan(&date, &reconciled); err != nil {
+		t.Fatal(err)
+	}
+	if date != nil || reconciled {
+		t.Errorf("date %v and reconciled %v, want no date and not reconciled", date, reconciled)
+	}
+	if _, err := pool.Exec(ctx, "INSERT INTO transaction (from_account, to_account, target, amount) VALUES (2, 1, 1, 100)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.QueryRow(ctx, "SELECT date FROM transaction WHERE id = 2").Scan(&date); err != nil || date == nil {
+		t.Errorf("date %v: %v, want today for a new transaction", date, err)
+	}
+
+	// the transaction without date is read with the zero time and orders first by date
+	storage := domain.PgRepositories(pool)
+	transaction, err := storage.Transactions.ReadById(ctx, "1")
+	if err != nil || !transaction.Date.IsZero() || transaction.Amount != 1250 {
+		t.Errorf("got %+v: %v, want the transaction without date", transaction, err)
+	}
+	transactions, err := storage.Transactions.Read(ctx, domain.TransactionFilter{}, &domain.Page{Sort: "date", Ascending: true, Limit: 1})
+	if err != nil || len(transactions) != 1 || transactions[0].Id != 1 {
+		t.Fatalf("got %+v: %v, want the transaction without date first", transactions, err)
+	}
+	if _, err := storage.Transactions.Update(ctx, &transaction); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.QueryRow(ctx, "SELECT date FROM transaction WHERE id = 1").Scan(&date); err != nil || date != nil {
+		t.Errorf("date %v: %v after an update, want still no date", date, err)
+	}
+}
@@ -0,0 +1,100 @@
+package migrations
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// The key of the advisory lock held while migrating, the same for every instance of bank
+const postgresLock int64 = 0x62616e6b // "bank"
+
+type postgres struct {
+	pool *pgxpool.Pool
+	conn *pgxpool.Conn
+}
+
+// The postgres database of pool, the migrations run on one connection holding an advisory lock,
+// so instances starting at the same time migrate one after the other
+func Postgres(pool *pgxpool.Pool) Database {
+	return &postgres{pool: pool}
+}
+
+func (db *postgres) dialect() string {
+	return "postgres"
+}
+
+func (db *postgres) lock(ctx context.Context) (func(), error) {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", postgresLock); err != nil {
+		conn.Release()
+		return nil, err
+	}
+	unlock := func() {
+		// also unlock when ctx is done, the lock belongs to the connection going back to the pool
+		conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", postgresLock)
+		conn.Release()
+		db.conn = nil
+	}
+
+	_, err = conn.Exec(ctx, `create table if not exists schema_migrations (
+		version bigint not null,
+		name text not null,
+		applied timestamptz not null default now(),
+		primary key (version)
+	)`)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+
+	db.conn = conn
+	return unlock, nil
+}
+
+func (db *postgres) applied(ctx context.Context) (map[int64]time.Time, error) {
+	rows, err := db.conn.Query(ctx, "SELECT version, applied FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+func (db *postgres) apply(ctx context.Context, migration Migration, up bool) error {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if up {
+		_, err = tx.Exec(ctx, migration.up)
+		if err == nil {
+			_, err = tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+		}
+	} else {
+		_, err = tx.Exec(ctx, migration.down)
+		if err == nil {
+			_, err = tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
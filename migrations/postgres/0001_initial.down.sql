@@ -0,0 +1,10 @@
+drop table if exists audit;
+drop table if exists attachment;
+drop table if exists transaction_tag;
+drop table if exists tag;
+drop table if exists statementline;
+drop table if exists reconciliation;
+drop table if exists transaction;
+drop table if exists account;
+drop table if exists target;
+drop table if exists csvprofile;
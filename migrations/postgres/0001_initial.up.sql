@@ -0,0 +1,132 @@
+-- The schema of sql/initialize.sql, databases created with it are taken over as they are
+create table if not exists target (
+    id bigserial,
+    name text not null,
+    description text,
+    deleted timestamptz, -- soft deleted, removed by bank purge
+    primary key (id),
+    unique (name)
+);
+
+create table if not exists account (
+    id bigserial,
+    number text not null,
+    description text,
+    deleted timestamptz, -- soft deleted, removed by bank purge
+    primary key (id),
+    unique (number)
+);
+
+create table if not exists transaction (
+    id bigserial,
+    from_account bigint not null,
+    to_account bigint not null,
+    target bigint not null,
+    amount bigint, -- referenced to from_account
+    description text,
+    date date not null default current_date,
+    reconciled boolean not null default false,
+    primary key (id),
+    foreign key (from_account) references account (id),
+    foreign key (to_account) references account (id),
+    foreign key (target) references target (id)
+);
+
+-- full text search, the expressions are the search documents of domain and must match them exactly
+create index if not exists account_search_simple on account using gin (to_tsvector('simple', number || ' ' || coalesce(description, '')));
+create index if not exists account_search_dutch on account using gin (to_tsvector('dutch', number || ' ' || coalesce(description, '')));
+create index if not exists target_search_simple on target using gin (to_tsvector('simple', name || ' ' || coalesce(description, '')));
+create index if not exists target_search_dutch on target using gin (to_tsvector('dutch', name || ' ' || coalesce(description, '')));
+create index if not exists transaction_search_simple on transaction using gin (to_tsvector('simple', coalesce(description, '')));
+create index if not exists transaction_search_dutch on transaction using gin (to_tsvector('dutch', coalesce(description, '')));
+create table if not exists csvprofile (
+    id bigserial,
+    name text not null,
+    delimiter text not null default ',',
+    header boolean not null default true,
+    date_column int not null,
+    date_format text not null default '2006-01-02',
+    amount_column int not null,
+    sign_convention text not null default 'minus',
+    indicator_column int not null default -1,
+    debit_indicator text not null default '',
+    counterparty_column int not null,
+    description_column int not null,
+    decimal_separator text not null default '.',
+    primary key (id),
+    unique (name)
+);
+
+create table if not exists reconciliation (
+    id bigserial,
+    account bigint not null,
+    period_from date not null,
+    period_to date not null,
+    created timestamptz not null default now(),
+    primary key (id),
+    foreign key (account) references account (id)
+);
+
+create table if not exists statementline (
+    id bigserial,
+    reconciliation bigint not null,
+    line int not null,
+    date date not null,
+    amount bigint not null, -- negative leaves the account of the reconciliation
+    counterparty text not null,
+    description text not null,
+    status text not null default 'open',
+    transaction bigint,
+    primary key (id),
+    foreign key (reconciliation) references reconciliation (id) on delete cascade,
+    foreign key (transaction) references transaction (id) on delete set null
+);
+
+create table if not exists tag (
+    id bigserial,
+    name text not null,
+    primary key (id),
+    unique (name)
+);
+
+create table if not exists transaction_tag (
+    transaction bigint not null,
+    tag bigint not null,
+    primary key (transaction, tag),
+    foreign key (transaction) references transaction (id) on delete cascade,
+    foreign key (tag) references tag (id) on delete cascade
+);
+
+-- content is stored in ATTACHMENT_DIR by sha256 hash
+create table if not exists attachment (
+    id bigserial,
+    transaction bigint not null,
+    filename text not null,
+    contenttype text not null,
+    size bigint not null,
+    hash text not null,
+    created timestamptz not null default now(),
+    primary key (id),
+    foreign key (transaction) references transaction (id) on delete cascade
+);
+
+create index if not exists attachment_hash on attachment (hash);
+
+-- append-only log of mutations on account, target and transaction
+create table if not exists audit (
+    id bigserial,
+    entity text not null,
+    entity_id bigint not null,
+    action text not null,
+    old jsonb,
+    new jsonb,
+    actor text not null,
+    request_id text not null,
+    ticket text not null default '',
+    created timestamptz not null default now(),
+    primary key (id)
+);
+
+create index if not exists audit_entity on audit (entity, entity_id);
+create or replace rule audit_no_update as on update to audit do instead nothing;
+create or replace rule audit_no_delete as on delete to audit do instead nothing;
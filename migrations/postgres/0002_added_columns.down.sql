@@ -0,0 +1,2 @@
+-- The columns are also created by 0001 on new databases, so they are kept
+select 1;
@@ -0,0 +1,9 @@
+-- The columns added to the tables of sql/initialize.sql after their creation, databases created before them
+-- are taken over by 0001 without them
+alter table target add column if not exists deleted timestamptz;
+alter table account add column if not exists deleted timestamptz;
+-- nothing tells the date of the transactions from before the column, their date stays null. New transactions
+-- get today when they have none, as on new databases
+alter table transaction add column if not exists date date;
+alter table transaction alter column date set default current_date;
+alter table transaction add column if not exists reconciled boolean not null default false;
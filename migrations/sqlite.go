@@ -0,0 +1,89 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type sqlite struct {
+	db   *sql.DB
+	conn *sql.Conn
+}
+
+// The sqlite database of db, the migrations run on one connection, sqlite itself allows one writer at a time
+func Sqlite(db *sql.DB) Database {
+	return &sqlite{db: db}
+}
+
+func (db *sqlite) dialect() string {
+	return "sqlite"
+}
+
+func (db *sqlite) lock(ctx context.Context) (func(), error) {
+	conn, err := db.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	unlock := func() {
+		conn.Close()
+		db.conn = nil
+	}
+
+	_, err = conn.ExecContext(ctx, `create table if not exists schema_migrations (
+		version integer not null,
+		name text not null,
+		applied timestamp not null default current_timestamp,
+		primary key (version)
+	)`)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+
+	db.conn = conn
+	return unlock, nil
+}
+
+func (db *sqlite) applied(ctx context.Context) (map[int64]time.Time, error) {
+	rows, err := db.conn.QueryContext(ctx, "SELECT version, applied FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+func (db *sqlite) apply(ctx context.Context, migration Migration, up bool) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if up {
+		_, err = tx.ExecContext(ctx, migration.up)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", migration.Version, migration.Name)
+		}
+	} else {
+		_, err = tx.ExecContext(ctx, migration.down)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,5 @@
+drop table if exists transaction_tag;
+drop table if exists tag;
+drop table if exists "transaction";
+drop table if exists account;
+drop table if exists target;
@@ -0,0 +1,45 @@
+-- The tables of accounts, targets and transactions in sqlite, equal to those of postgres.
+-- Ids are never reused like the sequences of postgres, times are stored as text in UTC.
+create table if not exists target (
+    id integer primary key autoincrement,
+    name text not null,
+    description text,
+    deleted timestamp, -- soft deleted, removed by bank purge
+    unique (name)
+);
+
+create table if not exists account (
+    id integer primary key autoincrement,
+    number text not null,
+    description text,
+    deleted timestamp, -- soft deleted, removed by bank purge
+    unique (number)
+);
+
+create table if not exists "transaction" (
+    id integer primary key autoincrement,
+    from_account integer not null,
+    to_account integer not null,
+    target integer not null,
+    amount integer, -- referenced to from_account
+    description text,
+    date date not null default current_date,
+    reconciled boolean not null default false,
+    foreign key (from_account) references account (id),
+    foreign key (to_account) references account (id),
+    foreign key (target) references target (id)
+);
+
+create table if not exists tag (
+    id integer primary key autoincrement,
+    name text not null,
+    unique (name)
+);
+
+create table if not exists transaction_tag (
+    "transaction" integer not null,
+    tag integer not null,
+    primary key ("transaction", tag),
+    foreign key ("transaction") references "transaction" (id) on delete cascade,
+    foreign key (tag) references tag (id) on delete cascade
+);
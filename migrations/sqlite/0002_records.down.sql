@@ -0,0 +1,5 @@
+drop table if exists audit;
+drop table if exists attachment;
+drop table if exists statementline;
+drop table if exists reconciliation;
+drop table if exists csvprofile;
@@ -0,0 +1,72 @@
+-- The tables around the transactions in sqlite, equal to those of postgres
+create table if not exists csvprofile (
+    id integer primary key autoincrement,
+    name text not null,
+    delimiter text not null default ',',
+    header boolean not null default true,
+    date_column integer not null,
+    date_format text not null default '2006-01-02',
+    amount_column integer not null,
+    sign_convention text not null default 'minus',
+    indicator_column integer not null default -1,
+    debit_indicator text not null default '',
+    counterparty_column integer not null,
+    description_column integer not null,
+    decimal_separator text not null default '.',
+    unique (name)
+);
+
+create table if not exists reconciliation (
+    id integer primary key autoincrement,
+    account integer not null,
+    period_from date not null,
+    period_to date not null,
+    created timestamp not null default current_timestamp,
+    foreign key (account) references account (id)
+);
+
+create table if not exists statementline (
+    id integer primary key autoincrement,
+    reconciliation integer not null,
+    line integer not null,
+    date date not null,
+    amount integer not null, -- negative leaves the account of the reconciliation
+    counterparty text not null,
+    description text not null,
+    status text not null default 'open',
+    "transaction" integer,
+    foreign key (reconciliation) references reconciliation (id) on delete cascade,
+    foreign key ("transaction") references "transaction" (id) on delete set null
+);
+
+-- content is stored in ATTACHMENT_DIR by sha256 hash
+create table if not exists attachment (
+    id integer primary key autoincrement,
+    "transaction" integer not null,
+    filename text not null,
+    contenttype text not null,
+    size integer not null,
+    hash text not null,
+    created timestamp not null default current_timestamp,
+    foreign key ("transaction") references "transaction" (id) on delete cascade
+);
+
+create index if not exists attachment_hash on attachment (hash);
+
+-- append-only log of mutations on account, target and transaction, old and new are json
+create table if not exists audit (
+    id integer primary key autoincrement,
+    entity text not null,
+    entity_id integer not null,
+    action text not null,
+    old text,
+    new text,
+    actor text not null,
+    request_id text not null,
+    ticket text not null default '',
+    created timestamp not null default current_timestamp
+);
+
+create index if not exists audit_entity on audit (entity, entity_id);
+create trigger if not exists audit_no_update before update on audit begin select raise(ignore); end;
+create trigger if not exists audit_no_delete before delete on audit begin select raise(ignore); end;
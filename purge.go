@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/bank/domain"
+	log "github.com/sirupsen/logrus"
+)
+
+// Remove accounts and targets that are deleted longer than the retention period ago.
+// Usage: bank purge [-days 90]
+func purge(args []string, storage domain.Repositories) error {
+	flags := flag.NewFlagSet("purge", flag.ContinueOnError)
+	days := flags.Int("days", 90, "retention period in days of deleted accounts and targets")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	before := time.Now().AddDate(0, 0, -*days)
+	log.WithFields(log.Fields{"before": before}).Info("Purge deleted accounts and targets")
+
+	var accounts []domain.Account
+	var targets []domain.Target
+
+	// the entities are only purged with their audit
+	err := storage.Atomic(context.Background(), func(storage domain.Repositories) error {
+		var err error
+
+		accounts, err = storage.Accounts.Purge(context.Background(), before)
+		if err != nil {
+			return fmt.Errorf("accounts not purged: %w", err)
+		}
+		for _, acc := range accounts {
+			if err := purgeAudit(storage, domain.AuditAccount, acc.Id, acc); err != nil {
+				return err
+			}
+		}
+
+		targets, err = storage.Targets.Purge(context.Background(), before)
+		if err != nil {
+			return fmt.Errorf("targets not purged: %w", err)
+		}
+		for _, tar := range targets {
+			if err := purgeAudit(storage, domain.AuditTarget, tar.Id, tar); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{"accounts": len(accounts), "targets": len(targets)}).Info("Purged")
+	return nil
+}
+
+// record the purge of an entity
+func purgeAudit(storage domain.Repositories, entity string, id int64, old any) error {
+	record := domain.Audit{
+		Entity:   entity,
+		EntityId: id,
+		Action:   domain.AuditPurge,
+		Old:      domain.AuditJson(old),
+		Actor:    "bank purge",
+	}
+
+	if _, err := storage.Audits.Write(context.Background(), &record); err != nil {
+		return fmt.Errorf("audit of %s %d not saved: %w", entity, id, err)
+	}
+	return nil
+}
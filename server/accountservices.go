@@ -1,9 +1,16 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/bank/config"
+	"github.com/bank/convert"
 	"github.com/bank/domain"
 	"github.com/bank/util"
 	"github.com/gin-gonic/gin"
@@ -11,20 +18,36 @@ import (
 )
 
 // Delete Accounts by Id
-func DeleteAccountById(c *gin.Context) {
+func (server *Server) DeleteAccountById(c *gin.Context) {
 	var err error
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 	id := c.Param("id")
 
 	account := domain.Account{}
 
-	err = account.DeleteById(util.Dbpool, id)
+	// read and locked in the transaction of the delete, a concurrent change waits and then fails If-Match
+	err = server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+		var err error
+		if account, err = storage.Accounts.ReadForUpdate(c.Request.Context(), id); err != nil {
+			return err
+		}
+		if !checkIfMatch(c, account) {
+			return errAnswered
+		}
+		if err := storage.Accounts.DeleteById(c.Request.Context(), id); err != nil {
+			return err
+		}
+		return writeAudit(c, storage, domain.AuditAccount, account.Id, domain.AuditDelete, account, nil)
+	})
+	if errors.Is(err, errAnswered) {
+		return
+	}
 	if err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Account not found, not deleted.")
-		if err.Error() != "no rows in result set" {
+		if !errors.Is(err, domain.ErrNotFound) {
 			log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+			server.auditFailure(c, domain.AuditAccount, account.Id, domain.AuditDelete, account, nil, serverError.Ticket)
 		}
-		c.IndentedJSON(http.StatusNotFound, serverError)
+		respondDomainError(c, err, http.StatusNotFound, serverError)
 		return
 	}
 
@@ -32,44 +55,67 @@ func DeleteAccountById(c *gin.Context) {
 }
 
 // Get all accounts
-func GetAccounts(c *gin.Context) {
+func (server *Server) GetAccounts(c *gin.Context) {
 
 	var accounts []domain.Account
 	var err error
-	var ilimit int64
 
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 	number := c.DefaultQuery("number", "")
-	limit := c.DefaultQuery("limit", "0")
 
-	account := domain.Account{}
+	page, err := parsePage(c)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter after, limit or count.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
 
-	ilimit, err = strconv.ParseInt(limit, 10, 64)
+	includeDeleted, err := parseIncludeDeleted(c)
 	if err != nil {
-		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter limit.")
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter includeDeleted.")
 
-		log.WithFields(log.Fields{"limit": limit, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusBadRequest, serverError)
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
+	shape, err := parseRepresentation(c, "balance")
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter expand.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
 		return
 	}
 
 	// retrieve known accounts
-	accounts, err = account.Read(util.Dbpool, number, ilimit)
+	accounts, err = server.storage.Accounts.Read(c.Request.Context(), number, &page, includeDeleted)
 	if err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Accounts not found.")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusNotFound, serverError)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	// expand references and select fields
+	shaped, err := shape.list(accounts, server.accountExpander(c.Request.Context(), accounts))
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error expanding accounts.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
 		return
 	}
 
 	// convert accounts to json
-	accountstring, err := util.StrucToJsonString(accounts)
+	accountstring, err := util.StrucToJsonString(shaped)
 	if err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Error converting accounts to json")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusInternalServerError, serverError)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
 		return
 	}
 
@@ -78,6 +124,8 @@ func GetAccounts(c *gin.Context) {
 	ifnonematch := c.Request.Header.Get("If-None-Match")
 	log.WithFields(log.Fields{"If-None-Match": ifnonematch}).Trace("Before etag value")
 
+	setPageHeaders(c, page)
+
 	// return that value already present in client cache
 	if ifnonematch == key {
 		c.IndentedJSON(http.StatusNotModified, nil)
@@ -87,24 +135,153 @@ func GetAccounts(c *gin.Context) {
 	// return new value
 	c.Header("Cache-Control", "max-age=30,  must-revalidate") // max-age in seconds
 	c.Header("ETag", key)
-	c.IndentedJSON(http.StatusOK, accounts)
+	c.IndentedJSON(http.StatusOK, shaped)
+}
+
+// Expansion of accounts, adds the balance in cents
+func (server *Server) accountExpander(ctx context.Context, accounts []domain.Account) expander {
+	return func(objects []map[string]json.RawMessage, expand map[string]bool) error {
+		var ids []int64
+
+		if !expand["balance"] {
+			return nil
+		}
+
+		for _, account := range accounts {
+			ids = append(ids, account.Id)
+		}
+		balances, err := server.storage.Accounts.Balances(ctx, ids)
+		if err != nil {
+			return err
+		}
+
+		for i, account := range accounts {
+			if objects[i]["balance"], err = json.Marshal(balances[account.Id]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Export the transactions of an account for personal finance tools
+// Parameters: format (ofx or qif), from and to (dates as yyyy-mm-dd, both optional) and tag (optional)
+func (server *Server) ExportAccount(c *gin.Context) {
+	var err error
+	var buffer bytes.Buffer
+	var contenttype string
+
+	id := c.Param("id")
+	format := c.DefaultQuery("format", "ofx")
+	tag := c.DefaultQuery("tag", "")
+
+	from, err := parseDate(c.DefaultQuery("from", ""))
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter from.")
+
+		log.WithFields(log.Fields{"from": c.Query("from"), "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
+	to, err := parseDate(c.DefaultQuery("to", ""))
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter to.")
+
+		log.WithFields(log.Fields{"to": c.Query("to"), "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
+	if format != "ofx" && format != "qif" {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter format, use ofx or qif.")
+
+		log.WithFields(log.Fields{"format": format, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
+	account := domain.Account{}
+	account, err = server.storage.Accounts.ReadById(c.Request.Context(), id, false)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Account not found.")
+		if !errors.Is(err, domain.ErrNotFound) { // Wrong id, does not exist
+			log.WithFields(log.Fields{"id": id, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		}
+		respondDomainError(c, err, http.StatusNotFound, serverError)
+		return
+	}
+
+	// all transactions up to the end of the period are needed for the balance
+	history, err := server.storage.Transactions.ReadByAccount(c.Request.Context(), account.Id, time.Time{}, to, "")
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Transactions of account not found.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	var balance int64 = 0
+	transactions := []domain.Transaction{}
+	for _, transaction := range history {
+		balance = balance + transaction.SignedAmount(account.Id)
+		if !transaction.Date.Before(from) && transaction.HasTag(tag) {
+			transactions = append(transactions, transaction)
+		}
+	}
+
+	accounts, targets, err := server.transactionReferences(c.Request.Context(), transactions)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error reading accounts and targets of transactions")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	if format == "ofx" {
+		contenttype = "application/x-ofx"
+		err = convert.WriteOfx(&buffer, convert.OfxBank{Id: config.Current.Export.BankId, Currency: config.Current.Export.Currency}, account, transactions, accounts, targets, from, to, balance)
+	} else {
+		contenttype = "application/qif"
+		err = convert.WriteQif(&buffer, account, transactions, accounts, targets)
+	}
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error converting transactions to " + format)
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="account-`+id+`.`+format+`"`)
+	respondData(c, contenttype+"; charset=utf-8", buffer.Bytes())
 }
 
 // Get Account by Id
-func GetAccountById(c *gin.Context) {
+func (server *Server) GetAccountById(c *gin.Context) {
 	id := c.Param("id")
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 
 	account := domain.Account{}
 
-	// retrieve known account
-	account, err := account.ReadById(util.Dbpool, id)
+	shape, err := parseRepresentation(c, "balance")
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter expand.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
+	// retrieve known account, also when it is deleted
+	account, err = server.storage.Accounts.ReadById(c.Request.Context(), id, true)
 	if err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Account not found.")
-		if err.Error() != "no rows in result set" { // Wrong id, does not exist
+		if !errors.Is(err, domain.ErrNotFound) { // Wrong id, does not exist
 			log.WithFields(log.Fields{"id": id, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
 		}
-		c.IndentedJSON(http.StatusNotFound, serverError)
+		respondDomainError(c, err, http.StatusNotFound, serverError)
 		return
 	}
 
@@ -114,7 +291,17 @@ func GetAccountById(c *gin.Context) {
 		var serverError domain.ServerError = domain.GenerateServerError("Error converting account to json")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusInternalServerError, serverError)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	// expand references and select fields, the ETag remains the one of the account itself
+	shaped, err := shape.single(account, server.accountExpander(c.Request.Context(), []domain.Account{account}))
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error expanding account.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
 		return
 	}
 
@@ -124,12 +311,7 @@ func GetAccountById(c *gin.Context) {
 	log.WithFields(log.Fields{"If-None-Match": ifnonematch}).Trace("Before etag value")
 
 	// return that value already present in client cache
-	if ifnonematch == key {
-		c.IndentedJSON(http.StatusNotModified, nil)
-		return
-	}
-
-	if ifnonematch == key {
+	if ifnonematch == key && len(shape.expand) == 0 { // expanded references may have changed
 		c.IndentedJSON(http.StatusNotModified, nil)
 		return
 	}
@@ -137,20 +319,19 @@ func GetAccountById(c *gin.Context) {
 	// return new value
 	c.Header("Cache-Control", "max-age=30,  must-revalidate") // max-age in seconds
 	c.Header("ETag", key)
-	c.IndentedJSON(http.StatusOK, account)
+	c.IndentedJSON(http.StatusOK, shaped)
 }
 
 // Create new account
-func PostAccount(c *gin.Context) {
+func (server *Server) PostAccount(c *gin.Context) {
 	var newAccount domain.Account
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 
 	// Call BindJSON to bind the received JSON to newAccount.
 	if err := c.BindJSON(&newAccount); err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Error in json.")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusUnprocessableEntity, serverError)
+		respondError(c, http.StatusUnprocessableEntity, serverError)
 		return
 	}
 
@@ -159,15 +340,110 @@ func PostAccount(c *gin.Context) {
 	}
 
 	// Add the account to the database.
-	_, err := newAccount.Write(util.Dbpool)
+	err := server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+		if _, err := storage.Accounts.Write(c.Request.Context(), &newAccount); err != nil {
+			return err
+		}
+		return writeAudit(c, storage, domain.AuditAccount, newAccount.Id, domain.AuditCreate, nil, newAccount)
+	})
 	if err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Newaccount not saved.")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusInternalServerError, serverError)
+		server.auditFailure(c, domain.AuditAccount, 0, domain.AuditCreate, nil, newAccount, serverError.Ticket)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, newAccount)
+}
+
+// Restore a deleted account
+func (server *Server) PostAccountRestore(c *gin.Context) {
+	id := c.Param("id")
+
+	account := domain.Account{}
+	account, err := server.storage.Accounts.ReadById(c.Request.Context(), id, true)
+	deleted := account
+	account.Deleted = nil
+	if err == nil {
+		err = server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+			if err := storage.Accounts.Restore(c.Request.Context(), id); err != nil {
+				return err
+			}
+			return writeAudit(c, storage, domain.AuditAccount, account.Id, domain.AuditRestore, deleted, account)
+		})
+	}
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Deleted account not found, not restored.")
+		if !errors.Is(err, domain.ErrNotFound) {
+			log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+			server.auditFailure(c, domain.AuditAccount, account.Id, domain.AuditRestore, deleted, nil, serverError.Ticket)
+		}
+		respondDomainError(c, err, http.StatusNotFound, serverError)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, account)
+}
+
+// Update part of an existing account
+// The body is a JSON merge patch or a JSON patch of the account as returned by get
+func (server *Server) PatchAccountById(c *gin.Context) {
+	id := c.Param("id")
+
+	var existing, newAccount domain.Account
+	// read and locked in the transaction of the change, a concurrent change waits and then fails If-Match
+	err := server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+		var err error
+		existing, err = storage.Accounts.ReadForUpdate(c.Request.Context(), id)
+		if err != nil {
+			var serverError domain.ServerError = domain.GenerateServerError("Account not found, no modification.")
+			if !errors.Is(err, domain.ErrNotFound) {
+				log.WithFields(log.Fields{"id": id, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+			}
+			respondDomainError(c, err, http.StatusNotFound, serverError)
+			return errAnswered
+		}
+
+		if !checkIfMatch(c, existing) {
+			return errAnswered
+		}
+
+		if !applyPatch(c, existing, &newAccount) {
+			return errAnswered
+		}
+
+		if newAccount.Id != existing.Id {
+			var serverError domain.ServerError = domain.GenerateServerError("Identification of account can not be modified.")
+			log.WithFields(log.Fields{"clientcode": serverError.Ticket}).Error(serverError.Message)
+			respondError(c, http.StatusUnprocessableEntity, serverError)
+			return errAnswered
+		}
+		newAccount.Deleted = existing.Deleted
+
+		if _, err := storage.Accounts.Update(c.Request.Context(), &newAccount); err != nil {
+			return err
+		}
+		// respond with the account as stored and its new ETag
+		if updated, err := storage.Accounts.ReadById(c.Request.Context(), id, false); err == nil {
+			newAccount = updated
+		}
+		return writeAudit(c, storage, domain.AuditAccount, existing.Id, domain.AuditUpdate, existing, newAccount)
+	})
+	if errors.Is(err, errAnswered) {
+		return
+	}
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Account not updated.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		server.auditFailure(c, domain.AuditAccount, existing.Id, domain.AuditUpdate, existing, newAccount, serverError.Ticket)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
 		return
 	}
 
+	setEtag(c, newAccount)
 	c.IndentedJSON(http.StatusOK, newAccount)
 }
 
@@ -175,17 +451,16 @@ func PostAccount(c *gin.Context) {
 // See https://restfulapi.net/http-methods/
 // Put only updates an existing account
 //
-func PutAccountById(c *gin.Context) {
+func (server *Server) PutAccountById(c *gin.Context) {
 	id := c.Param("id")
 	var newAccount domain.Account
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 
 	// Call BindJSON to bind the received JSON to newAccount.
 	if err := c.BindJSON(&newAccount); err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Error in json.")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusUnprocessableEntity, serverError)
+		respondError(c, http.StatusUnprocessableEntity, serverError)
 		return
 	}
 
@@ -193,71 +468,117 @@ func PutAccountById(c *gin.Context) {
 	if strconv.FormatInt(newAccount.Id, 10) != id {
 		var serverError domain.ServerError = domain.GenerateServerError("Invalid identification of account, no modification.")
 		log.WithFields(log.Fields{"clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusNotFound, serverError)
+		respondError(c, http.StatusUnprocessableEntity, serverError)
 		return
 	}
 
-	// Update account in the database.
-	_, err := newAccount.Update(util.Dbpool)
+	var existing domain.Account
+	// read and locked in the transaction of the change, a concurrent change waits and then fails If-Match
+	err := server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+		var err error
+		existing, err = storage.Accounts.ReadForUpdate(c.Request.Context(), id)
+		if err != nil {
+			var serverError domain.ServerError = domain.GenerateServerError("Account not found, no modification.")
+			if !errors.Is(err, domain.ErrNotFound) {
+				log.WithFields(log.Fields{"id": id, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+			}
+			respondDomainError(c, err, http.StatusNotFound, serverError)
+			return errAnswered
+		}
+
+		if !checkIfMatch(c, existing) {
+			return errAnswered
+		}
+
+		// Update account in the database.
+		if _, err := storage.Accounts.Update(c.Request.Context(), &newAccount); err != nil {
+			return err
+		}
+		// respond with the account as stored and its new ETag
+		if updated, err := storage.Accounts.ReadById(c.Request.Context(), id, false); err == nil {
+			newAccount = updated
+		}
+		return writeAudit(c, storage, domain.AuditAccount, existing.Id, domain.AuditUpdate, existing, newAccount)
+	})
+	if errors.Is(err, errAnswered) {
+		return
+	}
 	if err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Account not updated.")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusUnprocessableEntity, serverError)
+		server.auditFailure(c, domain.AuditAccount, existing.Id, domain.AuditUpdate, existing, newAccount, serverError.Ticket)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
 		return
 	}
 
-	c.Header("ETag", "")
+	setEtag(c, newAccount)
 	c.IndentedJSON(http.StatusOK, newAccount)
 }
 
-// Search all accounts
-func SearchAccounts(c *gin.Context) {
+// Full text search of accounts by number and description, best match first
+// Parameters: config (text search configuration simple or dutch), after, limit and count and includeDeleted
+func (server *Server) SearchAccounts(c *gin.Context) {
 
-	var accounts []domain.Account
+	var matches []domain.AccountMatch
 	var err error
-	var ilimit int64
 
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 	search := c.Param("term")
-	limit := c.DefaultQuery("limit", "0")
+	config := c.DefaultQuery("config", "simple")
 
-	account := domain.Account{}
+	if !domain.SearchConfigs[config] {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter config.")
+
+		log.WithFields(log.Fields{"config": config, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
+	page, err := parsePage(c)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter after, limit or count.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
 
-	ilimit, err = strconv.ParseInt(limit, 10, 64)
+	includeDeleted, err := parseIncludeDeleted(c)
 	if err != nil {
-		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter limit.")
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter includeDeleted.")
 
-		log.WithFields(log.Fields{"limit": limit, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusBadRequest, serverError)
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
 		return
 	}
 
 	// search known accounts
-	accounts, err = account.Search(util.Dbpool, search, ilimit)
+	matches, err = server.storage.Accounts.Search(c.Request.Context(), search, config, &page, includeDeleted)
 	if err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Accounts not found.")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusNotFound, serverError)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
 		return
 	}
 
 	// convert accounts to json
-	accountstring, err := util.StrucToJsonString(accounts)
+	matchstring, err := util.StrucToJsonString(matches)
 	if err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Error converting accounts to json")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusInternalServerError, serverError)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
 		return
 	}
 
 	// calculate hash and check if key already known in cache
-	key := util.EtagHash(accountstring)
+	key := util.EtagHash(matchstring)
 	ifnonematch := c.Request.Header.Get("If-None-Match")
 	log.WithFields(log.Fields{"If-None-Match": ifnonematch}).Trace("Before etag value")
 
+	setPageHeaders(c, page)
+
 	// return that value already present in client cache
 	if ifnonematch == key {
 		c.IndentedJSON(http.StatusNotModified, nil)
@@ -267,5 +588,5 @@ func SearchAccounts(c *gin.Context) {
 	// return new value
 	c.Header("Cache-Control", "max-age=30,  must-revalidate") // max-age in seconds
 	c.Header("ETag", key)
-	c.IndentedJSON(http.StatusOK, accounts)
+	c.IndentedJSON(http.StatusOK, matches)
 }
@@ -0,0 +1,321 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/bank/api"
+	"github.com/bank/config"
+	"github.com/bank/domain"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// OpenAPI document as returned by /openapi.json
+var openApiJson []byte
+
+// gin path parameters :name and *name
+var pathParameter = regexp.MustCompile(`[:*]([^/]+)`)
+
+// key of the schema a patched entity must match, the body of a put of the path
+const patchSchemaKey = "patchschema"
+
+func init() {
+	// errors name the invalid value, without the schema and the value itself
+	openapi3.SchemaErrorDetailsDisabled = true
+
+	// merge patches are json, the patched entity is validated by the handler
+	openapi3filter.RegisterBodyDecoder("application/merge-patch+json", func(body io.Reader, header http.Header, schema *openapi3.SchemaRef, encoding openapi3filter.EncodingFn) (any, error) {
+		var value any
+		err := json.NewDecoder(body).Decode(&value)
+		return value, err
+	})
+}
+
+// Get the OpenAPI document of the api
+func GetOpenApi(c *gin.Context) {
+
+	if openApiJson == nil {
+		var serverError domain.ServerError = domain.GenerateServerError("OpenAPI document not available.")
+
+		log.WithFields(log.Fields{"clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusInternalServerError, serverError)
+		return
+	}
+	respondData(c, "application/json; charset=utf-8", openApiJson)
+}
+
+// Get the page showing the OpenAPI document with Swagger UI
+func GetDocs(c *gin.Context) {
+	respondDocs(c, "index.html")
+}
+
+// Get a script, style or icon of the page showing the OpenAPI document
+func GetDocsAsset(c *gin.Context) {
+	respondDocs(c, c.Param("asset"))
+}
+
+// respond with a file of the embedded docs, the page may only load what the server itself serves
+func respondDocs(c *gin.Context, name string) {
+	data, err := fs.ReadFile(api.Docs, path.Join("docs", name))
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Documentation " + name + " not found.")
+
+		respondError(c, http.StatusNotFound, serverError)
+		return
+	}
+
+	// Swagger UI sets styles in the page and shows its icons as data urls
+	c.Header("Content-Security-Policy", "default-src 'self'; style-src 'self' 'unsafe-inline'; img-src 'self' data:")
+	c.Header("X-Content-Type-Options", "nosniff")
+	respondData(c, mime.TypeByExtension(path.Ext(name)), data)
+}
+
+// Load the OpenAPI document and convert it to json for /openapi.json
+func loadOpenApi() (*openapi3.T, error) {
+	doc, err := api.Load()
+	if err != nil {
+		return doc, err
+	}
+
+	data, err := json.Marshal(doc)
+	if err == nil {
+		openApiJson = data
+	}
+	return doc, err
+}
+
+// Compare the routes of a version with the paths of its OpenAPI document, documented operations without route are logged.
+// Returns an error naming the routes that are not documented.
+func checkOpenApi(doc *openapi3.T, routes gin.RoutesInfo, version string) error {
+	documented := map[string]bool{}
+	missing := []string{}
+
+	for _, route := range routes {
+		if !strings.HasPrefix(route.Path, version+"/") {
+			continue
+		}
+
+		path := pathParameter.ReplaceAllString(strings.TrimPrefix(route.Path, version), "{$1}")
+		documented[route.Method+" "+path] = true
+
+		item := doc.Paths.Find(path)
+		if item == nil || item.GetOperation(route.Method) == nil {
+			missing = append(missing, route.Method+" "+route.Path)
+		}
+	}
+
+	for path, item := range doc.Paths {
+		for method := range item.Operations() {
+			if !documented[method+" "+path] {
+				log.WithFields(log.Fields{"method": method, "path": version + path}).Warn("OpenAPI document has no route")
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("routes missing in OpenAPI document: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// json content types, of which the body is validated
+func jsonContent(contentType string) bool {
+	return contentType == "application/json" || strings.HasSuffix(contentType, "+json")
+}
+
+// Validate requests against the OpenAPI document of a version, the responses too when configured.
+// An invalid parameter is answered with 400, an invalid json body with 422 and an undocumented content type with 415.
+// Uploaded files are not read, only their content type is checked.
+func openApiValidation(doc *openapi3.T, version string) gin.HandlerFunc {
+	responses := config.Current.ValidateResponses
+
+	return func(c *gin.Context) {
+		path := pathParameter.ReplaceAllString(strings.TrimPrefix(c.FullPath(), version), "{$1}")
+		item := doc.Paths.Find(path)
+		if item == nil || item.GetOperation(c.Request.Method) == nil {
+			c.Next() // refused by checkOpenApi at startup
+			return
+		}
+		operation := item.GetOperation(c.Request.Method)
+
+		parameters := map[string]string{}
+		for _, parameter := range c.Params {
+			parameters[parameter.Key] = parameter.Value
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: parameters,
+			Route:      &routers.Route{Spec: doc, Path: path, PathItem: item, Method: c.Request.Method, Operation: operation},
+			Options: &openapi3filter.Options{
+				MultiError:          true,
+				SkipSettingDefaults: true, // the handlers know the defaults
+				AuthenticationFunc:  openapi3filter.NoopAuthenticationFunc,
+			},
+		}
+
+		// the result of a patch is validated by applyPatch, as the body of a put
+		if c.Request.Method == http.MethodPatch && item.Put != nil && item.Put.RequestBody != nil {
+			if content := item.Put.RequestBody.Value.Content.Get("application/json"); content != nil && content.Schema != nil {
+				c.Set(patchSchemaKey, content.Schema.Value)
+			}
+		}
+
+		if operation.RequestBody != nil && c.Request.ContentLength != 0 && operation.RequestBody.Value.Content.Get(c.ContentType()) == nil {
+			var serverError domain.ServerError = domain.GenerateServerError("Content type " + c.ContentType() + " not supported.")
+
+			log.WithFields(log.Fields{"clientcode": serverError.Ticket}).Error(serverError.Message)
+			respondError(c, http.StatusUnsupportedMediaType, serverError)
+			c.Abort()
+			return
+		}
+		if operation.RequestBody != nil && !jsonContent(c.ContentType()) {
+			input.Options.ExcludeRequestBody = true
+		}
+
+		if err := openapi3filter.ValidateRequest(c.Request.Context(), input); err != nil {
+			respondInvalid(c, err)
+			return
+		}
+
+		if !responses {
+			c.Next()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+		validateResponse(c, input, recorder.body.Bytes())
+	}
+}
+
+// Validate a patched entity against the schema of a put of the path, when known
+func validatePatched(c *gin.Context, patched []byte) error {
+	schema, ok := c.Get(patchSchemaKey)
+	if !ok {
+		return nil
+	}
+	var value any
+	if err := json.Unmarshal(patched, &value); err != nil {
+		return err
+	}
+	return schema.(*openapi3.Schema).VisitJSON(value, openapi3.MultiErrors())
+}
+
+// Answer a request that does not match the OpenAPI document with the invalid values.
+// The status is 400 when a parameter is invalid and 422 when only the body is.
+func respondInvalid(c *gin.Context, err error) {
+	var serverError domain.ServerError = domain.GenerateServerError("Request does not match the api.")
+	status := http.StatusUnprocessableEntity
+
+	serverError.Invalid = invalidValues(err)
+	for _, value := range serverError.Invalid {
+		if value.In != "body" {
+			status = http.StatusBadRequest
+		}
+	}
+	if len(serverError.Invalid) == 0 {
+		serverError.Message = err.Error()
+		status = http.StatusBadRequest
+	}
+
+	log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+	respondError(c, status, serverError)
+	c.Abort()
+}
+
+// values of the request named in the errors of the validation
+func invalidValues(err error) []domain.InvalidValue {
+	var invalid []domain.InvalidValue
+
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		for _, inner := range e {
+			invalid = append(invalid, invalidValues(inner)...)
+		}
+	case *openapi3filter.RequestError:
+		if e.Parameter != nil {
+			invalid = append(invalid, domain.InvalidValue{In: e.Parameter.In, Name: e.Parameter.Name, Reason: schemaReason(e)})
+		} else if body := invalidValues(e.Err); len(body) > 0 {
+			invalid = append(invalid, body...)
+		} else if e.RequestBody != nil {
+			invalid = append(invalid, domain.InvalidValue{In: "body", Reason: e.Error()})
+		}
+	case *openapi3.SchemaError:
+		invalid = append(invalid, domain.InvalidValue{In: "body", Name: "/" + strings.Join(e.JSONPointer(), "/"), Reason: e.Reason})
+	}
+	return invalid
+}
+
+// reason of the schema errors of a parameter, without the value
+func schemaReason(e *openapi3filter.RequestError) string {
+	var reasons []string
+
+	switch inner := e.Err.(type) {
+	case *openapi3.SchemaError:
+		reasons = append(reasons, inner.Reason)
+	case openapi3.MultiError:
+		for _, err := range inner {
+			if schemaError, ok := err.(*openapi3.SchemaError); ok {
+				reasons = append(reasons, schemaError.Reason)
+			}
+		}
+	}
+	if len(reasons) == 0 {
+		if e.Err != nil {
+			return e.Err.Error()
+		}
+		return e.Reason
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// Copy of the body written by a handler
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (recorder *responseRecorder) Write(data []byte) (int, error) {
+	recorder.body.Write(data)
+	return recorder.ResponseWriter.Write(data)
+}
+
+func (recorder *responseRecorder) WriteString(data string) (int, error) {
+	recorder.body.WriteString(data)
+	return recorder.ResponseWriter.WriteString(data)
+}
+
+// Log a response that does not match the OpenAPI document, it has already been sent
+func validateResponse(c *gin.Context, input *openapi3filter.RequestValidationInput, body []byte) {
+	contentType := strings.TrimSpace(strings.Split(c.Writer.Header().Get("Content-Type"), ";")[0])
+
+	output := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 c.Writer.Status(),
+		Header:                 c.Writer.Header(),
+		Body:                   io.NopCloser(bytes.NewReader(body)),
+		Options: &openapi3filter.Options{
+			MultiError:            true,
+			IncludeResponseStatus: true,
+			ExcludeResponseBody:   !jsonContent(contentType),
+		},
+	}
+
+	if err := openapi3filter.ValidateResponse(c.Request.Context(), output); err != nil {
+		log.WithFields(log.Fields{"method": c.Request.Method, "path": c.FullPath(), "status": c.Writer.Status(), "error": err}).Error("Response does not match OpenAPI document")
+	}
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/bank/config"
+	"github.com/bank/domain"
+	"github.com/bank/util"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Upload a document for a transaction as multipart form field "file"
+func (server *Server) PostAttachment(c *gin.Context) {
+	id := c.Param("id")
+
+	transaction := domain.Transaction{}
+	transaction, err := server.storage.Transactions.ReadById(c.Request.Context(), id)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Transaction not found.")
+		if !errors.Is(err, domain.ErrNotFound) {
+			log.WithFields(log.Fields{"id": id, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		}
+		respondDomainError(c, err, http.StatusNotFound, serverError)
+		return
+	}
+
+	max := config.Current.AttachmentMaxSize
+	if c.Request.ContentLength > max {
+		var serverError domain.ServerError = domain.GenerateServerError("Attachment larger than " + strconv.FormatInt(max, 10) + " bytes.")
+
+		log.WithFields(log.Fields{"size": c.Request.ContentLength, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusRequestEntityTooLarge, serverError)
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Attachment file missing or too large.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Attachment file not readable.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+	defer file.Close()
+
+	attachment := domain.Attachment{
+		Transaction: transaction.Id,
+		Filename:    filepath.Base(header.Filename),
+		ContentType: header.Header.Get("Content-Type"),
+	}
+	if len(attachment.ContentType) == 0 {
+		attachment.ContentType = "application/octet-stream"
+	}
+
+	// a delete of the same content waits until the attachment refers to it
+	server.content.Lock()
+	attachment.Hash, attachment.Size, err = util.NewContentStore().Save(file)
+	if err == nil {
+		_, err = server.storage.Attachments.Write(c.Request.Context(), &attachment)
+	}
+	server.content.Unlock()
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Attachment not saved.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, attachment)
+}
+
+// Get the documents of a transaction
+func (server *Server) GetAttachments(c *gin.Context) {
+	id := c.Param("id")
+
+	_, err := server.storage.Transactions.ReadById(c.Request.Context(), id)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Transaction not found.")
+		if !errors.Is(err, domain.ErrNotFound) {
+			log.WithFields(log.Fields{"id": id, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		}
+		respondDomainError(c, err, http.StatusNotFound, serverError)
+		return
+	}
+
+	attachments, err := server.storage.Attachments.Read(c.Request.Context(), id)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Attachments not found.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, attachments)
+}
+
+// Download a document of a transaction
+func (server *Server) GetAttachmentById(c *gin.Context) {
+	id := c.Param("id")
+	attachmentId := c.Param("attachment")
+
+	attachment := domain.Attachment{}
+	attachment, err := server.storage.Attachments.ReadById(c.Request.Context(), id, attachmentId)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Attachment not found.")
+		if !errors.Is(err, domain.ErrNotFound) {
+			log.WithFields(log.Fields{"id": attachmentId, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		}
+		respondDomainError(c, err, http.StatusNotFound, serverError)
+		return
+	}
+
+	// content never changes for a hash
+	if c.Request.Header.Get("If-None-Match") == attachment.Hash {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	file, err := util.NewContentStore().Open(attachment.Hash)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Attachment content not found.")
+
+		log.WithFields(log.Fields{"hash": attachment.Hash, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+	defer file.Close()
+
+	c.Header("ETag", attachment.Hash)
+	c.Header("Content-Type", attachment.ContentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, file, map[string]string{
+		"Content-Disposition": "attachment; filename=" + strconv.Quote(attachment.Filename),
+	})
+}
+
+// Delete a document of a transaction, the content is removed when no other attachment uses it
+func (server *Server) DeleteAttachmentById(c *gin.Context) {
+	id := c.Param("id")
+	attachmentId := c.Param("attachment")
+
+	attachment := domain.Attachment{}
+	attachment, err := server.storage.Attachments.ReadById(c.Request.Context(), id, attachmentId)
+	if err == nil {
+		err = server.storage.Attachments.DeleteById(c.Request.Context(), id, attachmentId)
+	}
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Attachment not found, not deleted.")
+		if !errors.Is(err, domain.ErrNotFound) {
+			log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		}
+		respondDomainError(c, err, http.StatusNotFound, serverError)
+		return
+	}
+
+	server.removeContent(c.Request.Context(), attachment)
+
+	c.IndentedJSON(http.StatusNoContent, nil)
+}
+
+// Remove the content of the deleted attachments that no other attachment uses
+func (server *Server) removeContent(ctx context.Context, attachments ...domain.Attachment) {
+	server.content.Lock()
+	defer server.content.Unlock()
+
+	store := util.NewContentStore()
+	for _, attachment := range attachments {
+		count, err := server.storage.Attachments.CountByHash(ctx, attachment.Hash)
+		if err == nil && count == 0 {
+			err = store.Remove(attachment.Hash)
+		}
+		if err != nil {
+			// the attachment is deleted, only the content is left behind
+			log.WithFields(log.Fields{"hash": attachment.Hash, "error": err}).Warn("Attachment content not removed")
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/bank/domain"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const requestIdKey = "requestid"
+
+// give every request an id, taken from header X-Request-Id or generated, and return it in the response
+func requestIdMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-Id")
+		if len(id) == 0 {
+			id = uuid.NewString()
+		}
+		c.Set(requestIdKey, id)
+		c.Writer.Header().Set("X-Request-Id", id)
+		c.Next()
+	}
+}
+
+// the user doing the request as passed by a trusted authenticating proxy, otherwise the client address.
+// Others could pass any user in the header.
+func auditActor(c *gin.Context) string {
+	if _, trusted := c.RemoteIP(); trusted {
+		if user := c.GetHeader("X-Forwarded-User"); len(user) > 0 {
+			return user
+		}
+	}
+	return c.ClientIP()
+}
+
+// the audit of a mutation of an entity, old and new are nil when there is no entity before or after the mutation
+func auditRecord(c *gin.Context, entity string, id int64, action string, old any, new any, ticket string) domain.Audit {
+	return domain.Audit{
+		Entity:    entity,
+		EntityId:  id,
+		Action:    action,
+		Old:       domain.AuditJson(old),
+		New:       domain.AuditJson(new),
+		Actor:     auditActor(c),
+		RequestId: c.GetString(requestIdKey),
+		Ticket:    ticket,
+	}
+}
+
+// Record a mutation in the storage of the mutation, given by Atomic, the mutation is only kept with its audit
+func writeAudit(c *gin.Context, storage domain.Repositories, entity string, id int64, action string, old any, new any) error {
+	record := auditRecord(c, entity, id, action, old, new, "")
+	if _, err := storage.Audits.Write(c.Request.Context(), &record); err != nil {
+		log.WithFields(log.Fields{"entity": entity, "id": id, "action": action, "error": err}).Error("Audit not saved")
+		return err
+	}
+	return nil
+}
+
+// Record a failed mutation with the ticket returned to the client.
+// A failure to record is logged, it does not change the response.
+func (server *Server) auditFailure(c *gin.Context, entity string, id int64, action string, old any, new any, ticket string) {
+	record := auditRecord(c, entity, id, action, old, new, ticket)
+
+	// the audit of the failure is written also when the client is gone
+	if _, err := server.storage.Audits.Write(context.Background(), &record); err != nil {
+		log.WithFields(log.Fields{"entity": entity, "id": id, "action": action, "error": err}).Error("Audit not saved")
+	}
+}
+
+// Get the audit records, newest first
+// Parameters: entity (account, target, transaction or statementline), id (of the entity), from and to (yyyy-mm-dd, inclusive) and limit
+func (server *Server) GetAudit(c *gin.Context) {
+	var err error
+	var id, limit int64
+
+	entity := c.DefaultQuery("entity", "")
+	switch entity {
+	case "", domain.AuditAccount, domain.AuditTarget, domain.AuditTransaction, domain.AuditStatementLine:
+	default:
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter entity.")
+
+		log.WithFields(log.Fields{"entity": entity, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
+	id, err = strconv.ParseInt(c.DefaultQuery("id", "0"), 10, 64)
+	if err == nil {
+		limit, err = strconv.ParseInt(c.DefaultQuery("limit", "0"), 10, 64)
+	}
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter id or limit.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
+	from, err := parseDate(c.Query("from"))
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter from.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
+	to, err := parseDate(c.Query("to"))
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter to.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+	// the records of the last day are included, the storage reads before the bound
+	if !to.IsZero() {
+		to = to.AddDate(0, 0, 1)
+	}
+
+	records, err := server.storage.Audits.Read(c.Request.Context(), entity, id, from, to, limit)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Audit not found.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, records)
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bank/config"
+	"github.com/bank/convert"
+	"github.com/bank/domain"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Result of a book import
+type bookImportResult struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"`
+}
+
+// Export the whole book as plain text accounting journal
+// Parameters: format (ledger or beancount) and own (comma separated ids of own accounts)
+func (server *Server) ExportBook(c *gin.Context) {
+	var err error
+	var buffer bytes.Buffer
+
+	format := c.DefaultQuery("format", "beancount")
+	own := c.DefaultQuery("own", "")
+
+	if format != "ledger" && format != "beancount" {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter format, use ledger or beancount.")
+
+		log.WithFields(log.Fields{"format": format, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
+	book := convert.Book{Own: map[int64]bool{}, Currency: config.Current.Export.Currency}
+
+	if len(own) > 0 {
+		for _, value := range strings.Split(own, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter own.")
+
+				log.WithFields(log.Fields{"own": own, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+				respondError(c, http.StatusBadRequest, serverError)
+				return
+			}
+			book.Own[id] = true
+		}
+	}
+
+	// deleted accounts and targets are still used by their transactions
+	book.Accounts, err = server.storage.Accounts.Read(c.Request.Context(), "", &domain.Page{}, true)
+	if err == nil {
+		book.Targets, err = server.storage.Targets.Read(c.Request.Context(), "", &domain.Page{}, true)
+	}
+	if err == nil {
+		book.Transactions, err = server.storage.Transactions.Read(c.Request.Context(), domain.TransactionFilter{}, &domain.Page{})
+	}
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error reading book.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	if format == "ledger" {
+		err = convert.WriteLedger(&buffer, book)
+	} else {
+		err = convert.WriteBeancount(&buffer, book)
+	}
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error converting book to " + format)
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="bank.`+format+`"`)
+	respondData(c, "text/plain; charset=utf-8", buffer.Bytes())
+}
+
+// Import a beancount journal, the file is either the request body or the multipart form field "file".
+// Unknown accounts and targets are created. Transactions carrying the id of an
+// existing transaction update that transaction, unless it is reconciled. All others are created,
+// except those imported before. The journal is imported in one transaction.
+func (server *Server) ImportBook(c *gin.Context) {
+	var result bookImportResult
+
+	body, err := requestFile(c)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Beancount file missing.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+	defer body.Close()
+
+	// parse the complete file before anything is saved
+	book, err := convert.ReadBeancount(body)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error in beancount: " + err.Error())
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusUnprocessableEntity, serverError)
+		return
+	}
+
+	// all entries are imported or none
+	var message string
+	var failed *convert.BookEntry
+	err = server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+		accounts := map[string]domain.Account{}
+		targets := map[string]domain.Target{}
+
+		for _, account := range book.Accounts {
+			if _, err := findOrCreateAccount(c, storage, accounts, account.Number, account.Description); err != nil {
+				message = "Accounts and targets of book not saved."
+				return err
+			}
+		}
+		for _, target := range book.Targets {
+			if _, err := findOrCreateTarget(c, storage, targets, target.Name, target.Description); err != nil {
+				message = "Accounts and targets of book not saved."
+				return err
+			}
+		}
+
+		imported := map[bookKey]int{}
+		for i, entry := range book.Entries {
+			if err := importBookEntry(c, storage, entry, accounts, targets, imported, &result); err != nil {
+				message, failed = "Transaction of book not saved.", &book.Entries[i]
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError(message)
+
+		fields := log.Fields{"error": err, "clientcode": serverError.Ticket}
+		if failed != nil {
+			fields["entry"] = *failed
+		}
+		log.WithFields(fields).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	log.WithFields(log.Fields{"created": result.Created, "updated": result.Updated, "skipped": result.Skipped}).Info("Imported book")
+	c.IndentedJSON(http.StatusOK, result)
+}
+
+// an entry of a book import, entries with equal keys are the same transaction
+type bookKey struct {
+	date        string
+	from        int64
+	to          int64
+	amount      int64
+	description string
+}
+
+// Import entry, an entry without known id is skipped when imported holds an earlier import of it
+func importBookEntry(c *gin.Context, storage domain.Repositories, entry convert.BookEntry, accounts map[string]domain.Account, targets map[string]domain.Target, imported map[bookKey]int, result *bookImportResult) error {
+	from, err := findOrCreateAccount(c, storage, accounts, entry.From, "imported counterparty")
+	if err != nil {
+		return err
+	}
+	to, err := findOrCreateAccount(c, storage, accounts, entry.To, "imported counterparty")
+	if err != nil {
+		return err
+	}
+	target, err := findOrCreateTarget(c, storage, targets, entry.Target, "imported target")
+	if err != nil {
+		return err
+	}
+
+	transaction := entry.Transaction
+	transaction.SetFromAccount(from.Id)
+	transaction.SetToAccount(to.Id)
+	transaction.SetTarget(target.Id)
+
+	if transaction.Id != 0 {
+		existing := domain.Transaction{}
+		existing, err = storage.Transactions.ReadById(c.Request.Context(), strconv.FormatInt(transaction.Id, 10))
+		if err == nil && existing.Reconciled {
+			log.WithFields(log.Fields{"id": existing.Id}).Info("Reconciled transaction not updated by import")
+			result.Skipped++
+			return nil
+		}
+		if err == nil {
+			if _, err = storage.Transactions.Update(c.Request.Context(), &transaction); err != nil {
+				return err
+			}
+			if err = writeAudit(c, storage, domain.AuditTransaction, transaction.Id, domain.AuditUpdate, existing, transaction); err != nil {
+				return err
+			}
+			result.Updated++
+			return nil
+		}
+		if !errors.Is(err, domain.ErrNotFound) {
+			return err
+		}
+		transaction.SetId(0)
+	}
+
+	// the same entries imported before are skipped, equal entries of the book are all created
+	key := bookKey{date: transaction.Date.Format("2006-01-02"), from: from.Id, to: to.Id, amount: transaction.Amount, description: transaction.Description}
+	count, ok := imported[key]
+	if !ok {
+		if count, err = bookImported(c, storage, transaction); err != nil {
+			return err
+		}
+	}
+	if count > 0 {
+		imported[key] = count - 1
+		result.Skipped++
+		return nil
+	}
+	imported[key] = 0
+
+	if _, err = storage.Transactions.Write(c.Request.Context(), &transaction); err != nil {
+		return err
+	}
+	if err = writeAudit(c, storage, domain.AuditTransaction, transaction.Id, domain.AuditCreate, nil, transaction); err != nil {
+		return err
+	}
+	result.Created++
+	return nil
+}
+
+// the number of transactions with the date, accounts, amount and description of transaction
+func bookImported(c *gin.Context, storage domain.Repositories, transaction domain.Transaction) (int, error) {
+	amount := transaction.Amount
+	filter := domain.TransactionFilter{From: transaction.From_account, To: transaction.To_account,
+		FromDate: transaction.Date, ToDate: transaction.Date, MinAmount: &amount, MaxAmount: &amount}
+
+	existing, err := storage.Transactions.Read(c.Request.Context(), filter, &domain.Page{})
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, other := range existing {
+		if other.Description == transaction.Description {
+			count++
+		}
+	}
+	return count, nil
+}
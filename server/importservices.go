@@ -0,0 +1,418 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bank/convert"
+	"github.com/bank/domain"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Delete csv profile by name
+func (server *Server) DeleteCsvProfileByName(c *gin.Context) {
+	var err error
+	name := c.Param("name")
+
+	err = server.storage.CsvProfiles.DeleteByName(c.Request.Context(), name)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Csv profile not found, not deleted.")
+		if !errors.Is(err, domain.ErrNotFound) {
+			log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		}
+		respondDomainError(c, err, http.StatusNotFound, serverError)
+		return
+	}
+
+	c.IndentedJSON(http.StatusNoContent, nil)
+}
+
+// Get all csv profiles
+func (server *Server) GetCsvProfiles(c *gin.Context) {
+
+	profiles, err := server.storage.CsvProfiles.Read(c.Request.Context(), 0)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Csv profiles not found.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, profiles)
+}
+
+// Get csv profile by name
+func (server *Server) GetCsvProfileByName(c *gin.Context) {
+	name := c.Param("name")
+
+	profile := domain.CsvProfile{}
+
+	profile, err := server.storage.CsvProfiles.ReadByName(c.Request.Context(), name)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Csv profile not found.")
+		if !errors.Is(err, domain.ErrNotFound) {
+			log.WithFields(log.Fields{"name": name, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		}
+		respondDomainError(c, err, http.StatusNotFound, serverError)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, profile)
+}
+
+// Create new csv profile
+func (server *Server) PostCsvProfile(c *gin.Context) {
+	var newProfile domain.CsvProfile
+
+	if err := c.BindJSON(&newProfile); err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error in json.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusUnprocessableEntity, serverError)
+		return
+	}
+
+	if err := newProfile.Validate(); err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid csv profile: " + err.Error())
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusUnprocessableEntity, serverError)
+		return
+	}
+
+	_, err := server.storage.CsvProfiles.Write(c.Request.Context(), &newProfile)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("New csv profile not saved.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, newProfile)
+}
+
+// Update existing csv profile
+func (server *Server) PutCsvProfileByName(c *gin.Context) {
+	name := c.Param("name")
+	var newProfile domain.CsvProfile
+
+	if err := c.BindJSON(&newProfile); err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error in json.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusUnprocessableEntity, serverError)
+		return
+	}
+
+	profile := domain.CsvProfile{}
+	profile, err := server.storage.CsvProfiles.ReadByName(c.Request.Context(), name)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Csv profile not found, no modification.")
+		if !errors.Is(err, domain.ErrNotFound) {
+			log.WithFields(log.Fields{"name": name, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		}
+		respondDomainError(c, err, http.StatusNotFound, serverError)
+		return
+	}
+
+	newProfile.Id = profile.Id
+	if err := newProfile.Validate(); err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid csv profile: " + err.Error())
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusUnprocessableEntity, serverError)
+		return
+	}
+
+	_, err = server.storage.CsvProfiles.Update(c.Request.Context(), &newProfile)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Csv profile not updated.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, newProfile)
+}
+
+// Import a bank csv file for an account
+// The file is either the request body or the multipart form field "file".
+// Parameters: profile (name of csv profile), account (id of the account the file belongs to)
+// and target (id of the target used for the new transactions)
+func (server *Server) PostCsvImport(c *gin.Context) {
+	var err error
+
+	profileName := c.Query("profile")
+	accountId := c.Query("account")
+	targetId := c.Query("target")
+
+	profile := domain.CsvProfile{}
+	profile, err = server.storage.CsvProfiles.ReadByName(c.Request.Context(), profileName)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Csv profile not found.")
+
+		log.WithFields(log.Fields{"profile": profileName, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusBadRequest, serverError)
+		return
+	}
+
+	account := domain.Account{}
+	account, err = server.storage.Accounts.ReadById(c.Request.Context(), accountId, false)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Account not found.")
+
+		log.WithFields(log.Fields{"account": accountId, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusBadRequest, serverError)
+		return
+	}
+
+	target := domain.Target{}
+	target, err = server.storage.Targets.ReadById(c.Request.Context(), targetId, false)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Target not found.")
+
+		log.WithFields(log.Fields{"target": targetId, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusBadRequest, serverError)
+		return
+	}
+
+	body, err := requestFile(c)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Csv file missing.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+	defer body.Close()
+
+	// parse the complete file before anything is saved
+	lines, err := convert.ReadCsv(body, profile)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error in csv: " + err.Error())
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusUnprocessableEntity, serverError)
+		return
+	}
+
+	transactions := []domain.Transaction{}
+	skipped := 0
+
+	// all lines are imported or none
+	var message string
+	var failed *domain.Transaction
+	err = server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+		counterparties := map[string]domain.Account{}
+		imported := map[csvKey]int{}
+
+		for _, line := range lines {
+			key := csvKey{date: line.Date.Format("2006-01-02"), amount: line.Amount, description: line.Description}
+			count, ok := imported[key]
+			if !ok {
+				var err error
+				if count, err = csvImported(c, storage, account, line); err != nil {
+					message = "Imported transactions not read."
+					return err
+				}
+			}
+			if count > 0 {
+				imported[key] = count - 1
+				skipped++
+				continue
+			}
+			imported[key] = 0
+
+			counterparty, err := findOrCreateAccount(c, storage, counterparties, line.Counterparty, "imported counterparty")
+			if err != nil {
+				message = "Counterparty not saved."
+				return err
+			}
+
+			transaction := csvLineToTransaction(line, account, counterparty, target)
+			if _, err := storage.Transactions.Write(c.Request.Context(), &transaction); err != nil {
+				message, failed = "Transaction not saved.", &transaction
+				return err
+			}
+			if err := writeAudit(c, storage, domain.AuditTransaction, transaction.Id, domain.AuditCreate, nil, transaction); err != nil {
+				message, failed = "Transaction not saved.", &transaction
+				return err
+			}
+			transactions = append(transactions, transaction)
+		}
+		return nil
+	})
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError(message)
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		if failed != nil {
+			server.auditFailure(c, domain.AuditTransaction, 0, domain.AuditCreate, nil, *failed, serverError.Ticket)
+		}
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	log.WithFields(log.Fields{"account": account.Number, "count": len(transactions), "skipped": skipped}).Info("Imported csv")
+	c.IndentedJSON(http.StatusOK, transactions)
+}
+
+// a line of a csv import, lines with equal keys are the same transaction of the account
+type csvKey struct {
+	date        string
+	amount      int64
+	description string
+}
+
+// the number of transactions of account with the date, amount and description of line, imported before
+func csvImported(c *gin.Context, storage domain.Repositories, account domain.Account, line convert.CsvLine) (int, error) {
+	amount := line.Amount
+	filter := domain.TransactionFilter{To: account.Id, FromDate: line.Date, ToDate: line.Date, MinAmount: &amount, MaxAmount: &amount}
+	if line.Amount < 0 {
+		amount = -line.Amount
+		filter = domain.TransactionFilter{From: account.Id, FromDate: line.Date, ToDate: line.Date, MinAmount: &amount, MaxAmount: &amount}
+	}
+
+	existing, err := storage.Transactions.Read(c.Request.Context(), filter, &domain.Page{})
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, transaction := range existing {
+		if transaction.Description == line.Description {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Convert a csv line of account into a transaction from or to the counterparty
+func csvLineToTransaction(line convert.CsvLine, account domain.Account, counterparty domain.Account, target domain.Target) domain.Transaction {
+	transaction := domain.Transaction{}
+	transaction.SetDate(line.Date)
+	transaction.SetDescription(line.Description)
+	transaction.SetTarget(target.Id)
+
+	if line.Amount < 0 {
+		transaction.SetFromAccount(account.Id)
+		transaction.SetToAccount(counterparty.Id)
+		transaction.SetAmount(-line.Amount)
+	} else {
+		transaction.SetFromAccount(counterparty.Id)
+		transaction.SetToAccount(account.Id)
+		transaction.SetAmount(line.Amount)
+	}
+
+	return transaction
+}
+
+// Find an account by number, the account is created with description when it is unknown
+// and restored when it is deleted, as its number can not be used again. Found accounts are remembered in known.
+func findOrCreateAccount(c *gin.Context, storage domain.Repositories, known map[string]domain.Account, number string, description string) (domain.Account, error) {
+	if len(number) == 0 {
+		number = "unknown"
+	}
+
+	if account, ok := known[number]; ok {
+		return account, nil
+	}
+
+	account := domain.Account{}
+	account, err := storage.Accounts.ReadByNumber(c.Request.Context(), number, true)
+	if err == nil && account.Deleted != nil {
+		deleted := account
+		account.Deleted = nil
+		err = storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+			if err := storage.Accounts.Restore(c.Request.Context(), strconv.FormatInt(account.Id, 10)); err != nil {
+				return err
+			}
+			return writeAudit(c, storage, domain.AuditAccount, account.Id, domain.AuditRestore, deleted, account)
+		})
+		if err != nil {
+			return deleted, err
+		}
+	} else if err != nil {
+		if !errors.Is(err, domain.ErrNotFound) {
+			return account, err
+		}
+
+		account = domain.Account{}
+		account.SetNumberDescription(number, description)
+		err = storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+			if _, err := storage.Accounts.Write(c.Request.Context(), &account); err != nil {
+				return err
+			}
+			return writeAudit(c, storage, domain.AuditAccount, account.Id, domain.AuditCreate, nil, account)
+		})
+		if err != nil {
+			return account, err
+		}
+	}
+
+	known[number] = account
+	return account, nil
+}
+
+// Find a target by name, the target is created with description when it is unknown
+// and restored when it is deleted, as its name can not be used again. Found targets are remembered in known.
+func findOrCreateTarget(c *gin.Context, storage domain.Repositories, known map[string]domain.Target, name string, description string) (domain.Target, error) {
+	if target, ok := known[name]; ok {
+		return target, nil
+	}
+
+	target := domain.Target{}
+	target, err := storage.Targets.ReadByName(c.Request.Context(), name, true)
+	if err == nil && target.Deleted != nil {
+		deleted := target
+		target.Deleted = nil
+		err = storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+			if err := storage.Targets.Restore(c.Request.Context(), strconv.FormatInt(target.Id, 10)); err != nil {
+				return err
+			}
+			return writeAudit(c, storage, domain.AuditTarget, target.Id, domain.AuditRestore, deleted, target)
+		})
+		if err != nil {
+			return deleted, err
+		}
+	} else if err != nil {
+		if !errors.Is(err, domain.ErrNotFound) {
+			return target, err
+		}
+
+		target = domain.Target{}
+		target.SetNameDescription(name, description)
+		err = storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+			if _, err := storage.Targets.Write(c.Request.Context(), &target); err != nil {
+				return err
+			}
+			return writeAudit(c, storage, domain.AuditTarget, target.Id, domain.AuditCreate, nil, target)
+		})
+		if err != nil {
+			return target, err
+		}
+	}
+
+	known[name] = target
+	return target, nil
+}
+
+// Get the uploaded file, either as multipart form field "file" or as plain request body
+func requestFile(c *gin.Context) (io.ReadCloser, error) {
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		return header.Open()
+	}
+
+	return c.Request.Body, nil
+}
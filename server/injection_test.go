@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/bank/domain"
+	"github.com/bank/migrations"
+	"github.com/bank/util"
+	"github.com/gin-gonic/gin"
+	_ "modernc.org/sqlite"
+)
+
+// Values a client could send to break out of a quoted or numeric sql value
+var hostileValues = []string{
+	"' or '1'='1",
+	"'; DROP TABLE account; --",
+	`" or ""="`,
+	"1 or 1=1",
+	"%' union select * from account --",
+	"x' and 1=(select count(*) from account) and 'x'='x",
+	"\\'",
+}
+
+// The router of a server with the storage in a new sqlite database, its queries are built like those of postgres
+func newSqliteRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	return newStorageRouter(t, newSqliteStorage(t))
+}
+
+// The storage in a new sqlite database
+func newSqliteStorage(t *testing.T) domain.Repositories {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "bank.db")
+	db, err := util.SqliteOpen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := migrations.Up(context.Background(), migrations.Sqlite(db)); err != nil {
+		t.Fatal(err)
+	}
+	return domain.SqliteRepositories(db)
+}
+
+// A hostile value as filter matches nothing, it is compared as a value and never part of the sql
+func TestHostileFilters(t *testing.T) {
+	router := newSqliteRouter(t)
+	createTransaction(t, router)
+
+	for _, value := range hostileValues {
+		for _, path := range []string{
+			"/v1/accounts?number=",
+			"/v1/targets?name=",
+			"/v1/transactions?description=",
+			"/v1/transactions?tag=",
+		} {
+			var list []json.RawMessage
+			mustCall(t, router, "GET", path+url.QueryEscape(value), "", http.StatusOK, &list)
+			if len(list) != 0 {
+				t.Errorf("%s%s: got %d rows, want none", path, value, len(list))
+			}
+		}
+	}
+	intact(t, router)
+}
+
+// A hostile search term or id is answered without server error
+func TestHostileTerms(t *testing.T) {
+	router := newSqliteRouter(t)
+	createTransaction(t, router)
+
+	for _, value := range hostileValues {
+		for _, path := range []string{
+			"/v1/accounts/search/",
+			"/v1/targets/search/",
+			"/v1/transactions/search/",
+			"/v1/accounts/",
+			"/v1/targets/",
+			"/v1/transactions/",
+			"/v1/imports/csv/profiles/",
+		} {
+			recorder := call(router, "GET", path+url.PathEscape(value), "", "")
+			if recorder.Code >= http.StatusInternalServerError {
+				t.Errorf("%s%s: status %d: %s", path, value, recorder.Code, recorder.Body.String())
+			}
+		}
+		recorder := call(router, "DELETE", "/v1/accounts/"+url.PathEscape(value), "", "")
+		if recorder.Code != http.StatusBadRequest && recorder.Code != http.StatusNotFound {
+			t.Errorf("delete of account %s: status %d, want 400 or 404", value, recorder.Code)
+		}
+	}
+	intact(t, router)
+}
+
+// Parameters naming columns or taking numbers, dates and booleans accept only those
+func TestInvalidParameters(t *testing.T) {
+	router := newSqliteRouter(t)
+	createTransaction(t, router)
+
+	for _, value := range hostileValues {
+		for _, path := range []string{
+			"/v1/transactions?sort=",
+			"/v1/transactions?order=",
+			"/v1/transactions?from=",
+			"/v1/transactions?minamount=",
+			"/v1/transactions?target=",
+			"/v1/transactions?fromdate=",
+			"/v1/accounts?limit=",
+			"/v1/accounts?after=",
+			"/v1/accounts?includeDeleted=",
+			"/v1/accounts?expand=",
+			"/v1/accounts/search/bank?config=",
+			"/v1/audit?entity=",
+			"/v1/audit?id=",
+		} {
+			mustCall(t, router, "GET", path+url.QueryEscape(value), "", http.StatusBadRequest, nil)
+		}
+	}
+	mustCall(t, router, "GET", "/v1/accounts?limit=-1", "", http.StatusBadRequest, nil)
+	mustCall(t, router, "GET", "/v1/transactions?sort=amount&order=asc", "", http.StatusOK, nil)
+	intact(t, router)
+}
+
+// Bodies that are no valid entity are refused before anything is saved
+func TestInvalidBodies(t *testing.T) {
+	router := newSqliteRouter(t)
+	_, _, _, transaction := createTransaction(t, router)
+
+	for _, request := range []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"POST", "/v1/accounts", `{"number": "NL01BANK0003"`},
+		{"POST", "/v1/accounts", `["NL01BANK0003"]`},
+		{"POST", "/v1/accounts", `{"number": 3, "description": "number"}`},
+		{"POST", "/v1/transactions", `{"from": "1' or '1'='1", "to": 2, "amount": 100}`},
+		{"POST", "/v1/transactions", `{"from": ` + id(transaction.From_account) + `, "to": ` + id(transaction.To_account) +
+			`, "target": ` + id(transaction.Target) + `, "amount": 100, "date": "yesterday"}`},
+		{"PUT", "/v1/transactions/" + id(transaction.Id), `{"id": ` + id(transaction.Id) + `, "amount": "1; DROP TABLE transaction"}`},
+		{"PATCH", "/v1/transactions/" + id(transaction.Id), `{"amount": "' or '1'='1"}`},
+		{"POST", "/v1/imports/csv/profiles", `{"name": "bank'; --", "datecolumn": "0"}`},
+	} {
+		recorder := call(router, request.method, request.path, "", request.body)
+		if recorder.Code < http.StatusBadRequest || recorder.Code >= http.StatusInternalServerError {
+			t.Errorf("%s %s %s: status %d, want a client error: %s", request.method, request.path, request.body, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	var read domain.Transaction
+	mustCall(t, router, "GET", "/v1/transactions/"+id(transaction.Id), "", http.StatusOK, &read)
+	if read.Amount != transaction.Amount {
+		t.Errorf("got amount %d, want the unchanged %d", read.Amount, transaction.Amount)
+	}
+	intact(t, router)
+}
+
+// the accounts, target and transaction of createTransaction are all still there
+func intact(t *testing.T, router *gin.Engine) {
+	t.Helper()
+
+	var accounts, targets, transactions []json.RawMessage
+	mustCall(t, router, "GET", "/v1/accounts", "", http.StatusOK, &accounts)
+	mustCall(t, router, "GET", "/v1/targets", "", http.StatusOK, &targets)
+	mustCall(t, router, "GET", "/v1/transactions", "", http.StatusOK, &transactions)
+	if len(accounts) != 2 || len(targets) != 1 || len(transactions) != 1 {
+		t.Errorf("got %d accounts, %d targets and %d transactions, want 2, 1 and 1", len(accounts), len(targets), len(transactions))
+	}
+}
@@ -0,0 +1,431 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bank/convert"
+	"github.com/bank/domain"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Days a statement line and a transaction may differ to be matched
+const defaultMatchWindow = 3
+
+// Build the report of a reconciliation, window is the number of days dates may differ
+func (server *Server) reconciliationReport(ctx context.Context, reconciliation domain.Reconciliation, window int) (domain.ReconciliationReport, error) {
+	lines, err := server.storage.StatementLines.Read(ctx, reconciliation.Id)
+	if err != nil {
+		return domain.ReconciliationReport{}, err
+	}
+
+	margin := time.Duration(window) * 24 * time.Hour
+	transactions, err := server.storage.Transactions.ReadByAccount(ctx, reconciliation.Account, reconciliation.From.Add(-margin), reconciliation.To.Add(margin), "")
+	if err != nil {
+		return domain.ReconciliationReport{}, err
+	}
+
+	// linked transactions may have been moved outside the period after linking
+	known := map[int64]bool{}
+	for _, transaction := range transactions {
+		known[transaction.Id] = true
+	}
+	for _, line := range lines {
+		if line.Transaction != nil && !known[*line.Transaction] {
+			linked, err := server.storage.Transactions.ReadById(ctx, strconv.FormatInt(*line.Transaction, 10))
+			if err != nil {
+				return domain.ReconciliationReport{}, err
+			}
+			transactions = append(transactions, linked)
+			known[linked.Id] = true
+		}
+	}
+
+	return reconciliation.Match(lines, transactions, window), nil
+}
+
+// Upload a bank statement for an account and period
+// The csv file is either the request body or the multipart form field "file".
+// Parameters: account (id), profile (name of csv profile), from and to (dates as yyyy-mm-dd)
+// Statement lines outside the period are skipped.
+func (server *Server) PostReconciliation(c *gin.Context) {
+	var err error
+
+	accountId := c.Query("account")
+	profileName := c.Query("profile")
+
+	reconciliation := domain.Reconciliation{}
+
+	reconciliation.From, err = parseDate(c.Query("from"))
+	if err == nil {
+		reconciliation.To, err = parseDate(c.Query("to"))
+	}
+	if err != nil || reconciliation.From.IsZero() || reconciliation.To.IsZero() || reconciliation.To.Before(reconciliation.From) {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid period, from and to are required.")
+
+		log.WithFields(log.Fields{"from": c.Query("from"), "to": c.Query("to"), "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
+	profile := domain.CsvProfile{}
+	profile, err = server.storage.CsvProfiles.ReadByName(c.Request.Context(), profileName)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Csv profile not found.")
+
+		log.WithFields(log.Fields{"profile": profileName, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusBadRequest, serverError)
+		return
+	}
+
+	account := domain.Account{}
+	account, err = server.storage.Accounts.ReadById(c.Request.Context(), accountId, false)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Account not found.")
+
+		log.WithFields(log.Fields{"account": accountId, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusBadRequest, serverError)
+		return
+	}
+	reconciliation.Account = account.Id
+
+	body, err := requestFile(c)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Statement file missing.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+	defer body.Close()
+
+	csvLines, err := convert.ReadCsv(body, profile)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error in csv: " + err.Error())
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusUnprocessableEntity, serverError)
+		return
+	}
+
+	// the statement is saved with all its lines or not at all
+	err = server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+		if _, err := storage.Reconciliations.Write(c.Request.Context(), &reconciliation); err != nil {
+			return err
+		}
+
+		for _, csvLine := range csvLines {
+			if csvLine.Date.Before(reconciliation.From) || csvLine.Date.After(reconciliation.To) {
+				continue
+			}
+
+			line := domain.StatementLine{
+				Reconciliation: reconciliation.Id,
+				Line:           csvLine.Line,
+				Date:           csvLine.Date,
+				Amount:         csvLine.Amount,
+				Counterparty:   csvLine.Counterparty,
+				Description:    csvLine.Description,
+			}
+			if _, err := storage.StatementLines.Write(c.Request.Context(), &line); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Statement not saved.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	report, err := server.reconciliationReport(c.Request.Context(), reconciliation, defaultMatchWindow)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error matching statement.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, report)
+}
+
+// Get the matched, unmatched in bank and unmatched in ledger transactions of a reconciliation
+// Parameter: window (days dates may differ, default 3)
+func (server *Server) GetReconciliationById(c *gin.Context) {
+	id := c.Param("id")
+
+	window, err := strconv.Atoi(c.DefaultQuery("window", strconv.Itoa(defaultMatchWindow)))
+	if err != nil || window < 0 {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter window.")
+
+		log.WithFields(log.Fields{"window": c.Query("window"), "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
+	reconciliation := domain.Reconciliation{}
+	reconciliation, err = server.storage.Reconciliations.ReadById(c.Request.Context(), id)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Reconciliation not found.")
+		if !errors.Is(err, domain.ErrNotFound) {
+			log.WithFields(log.Fields{"id": id, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		}
+		respondDomainError(c, err, http.StatusNotFound, serverError)
+		return
+	}
+
+	report, err := server.reconciliationReport(c.Request.Context(), reconciliation, window)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error matching statement.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, report)
+}
+
+// Read the reconciliation and the open statement line an action is about.
+// On failure the error response is already sent.
+func (server *Server) reconciliationAction(c *gin.Context) (domain.Reconciliation, domain.StatementLine, domain.ReconciliationAction, bool) {
+	id := c.Param("id")
+	var action domain.ReconciliationAction
+	var line domain.StatementLine
+
+	if err := c.BindJSON(&action); err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error in json.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusUnprocessableEntity, serverError)
+		return domain.Reconciliation{}, line, action, false
+	}
+
+	reconciliation := domain.Reconciliation{}
+	reconciliation, err := server.storage.Reconciliations.ReadById(c.Request.Context(), id)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Reconciliation not found.")
+		if !errors.Is(err, domain.ErrNotFound) {
+			log.WithFields(log.Fields{"id": id, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		}
+		respondDomainError(c, err, http.StatusNotFound, serverError)
+		return reconciliation, line, action, false
+	}
+
+	line, err = server.storage.StatementLines.ReadById(c.Request.Context(), reconciliation.Id, action.Line)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Statement line not found.")
+		if !errors.Is(err, domain.ErrNotFound) {
+			log.WithFields(log.Fields{"line": action.Line, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		}
+		respondDomainError(c, err, http.StatusNotFound, serverError)
+		return reconciliation, line, action, false
+	}
+
+	if line.Status != domain.StatementLineOpen {
+		var serverError domain.ServerError = domain.GenerateServerError("Statement line is already " + line.Status + ".")
+
+		log.WithFields(log.Fields{"line": action.Line, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusConflict, serverError)
+		return reconciliation, line, action, false
+	}
+
+	return reconciliation, line, action, true
+}
+
+// Send the report of the reconciliation after an action
+func (server *Server) sendReconciliationReport(c *gin.Context, reconciliation domain.Reconciliation) {
+	report, err := server.reconciliationReport(c.Request.Context(), reconciliation, defaultMatchWindow)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error matching statement.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, report)
+}
+
+// Link a statement line to an existing transaction of the account
+func (server *Server) PostReconciliationLink(c *gin.Context) {
+
+	reconciliation, line, action, ok := server.reconciliationAction(c)
+	if !ok {
+		return
+	}
+
+	transaction := domain.Transaction{}
+	transaction, err := server.storage.Transactions.ReadById(c.Request.Context(), strconv.FormatInt(action.Transaction, 10))
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Transaction not found.")
+		if !errors.Is(err, domain.ErrNotFound) {
+			log.WithFields(log.Fields{"transaction": action.Transaction, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		}
+		respondDomainError(c, err, http.StatusUnprocessableEntity, serverError)
+		return
+	}
+
+	if transaction.From_account != reconciliation.Account && transaction.To_account != reconciliation.Account {
+		var serverError domain.ServerError = domain.GenerateServerError("Transaction is not from or to the account of the reconciliation.")
+
+		log.WithFields(log.Fields{"transaction": action.Transaction, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusUnprocessableEntity, serverError)
+		return
+	}
+
+	if transaction.Reconciled {
+		var serverError domain.ServerError = domain.GenerateServerError("Transaction is already reconciled.")
+
+		log.WithFields(log.Fields{"transaction": action.Transaction, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusConflict, serverError)
+		return
+	}
+
+	reconciled := transaction
+	reconciled.Reconciled = true
+	err = server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+		if err := storage.StatementLines.Link(c.Request.Context(), &line, transaction.Id); err != nil {
+			return err
+		}
+		return writeAudit(c, storage, domain.AuditTransaction, transaction.Id, domain.AuditUpdate, transaction, reconciled)
+	})
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Statement line not linked.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		server.auditFailure(c, domain.AuditTransaction, transaction.Id, domain.AuditUpdate, transaction, reconciled, serverError.Ticket)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	server.sendReconciliationReport(c, reconciliation)
+}
+
+// Create a transaction for a statement line missing in the ledger, booked on target
+func (server *Server) PostReconciliationCreate(c *gin.Context) {
+
+	reconciliation, line, action, ok := server.reconciliationAction(c)
+	if !ok {
+		return
+	}
+
+	target := domain.Target{}
+	target, err := server.storage.Targets.ReadById(c.Request.Context(), strconv.FormatInt(action.Target, 10), false)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Target not found.")
+
+		log.WithFields(log.Fields{"target": action.Target, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusUnprocessableEntity, serverError)
+		return
+	}
+
+	account := domain.Account{Id: reconciliation.Account}
+	err = server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+		counterparty, err := findOrCreateAccount(c, storage, map[string]domain.Account{}, line.Counterparty, "imported counterparty")
+		if err != nil {
+			return err
+		}
+
+		csvLine := convert.CsvLine{Line: line.Line, Date: line.Date, Amount: line.Amount, Counterparty: line.Counterparty, Description: line.Description}
+		transaction := csvLineToTransaction(csvLine, account, counterparty, target)
+		if _, err := storage.Transactions.Write(c.Request.Context(), &transaction); err != nil {
+			return err
+		}
+		if err := writeAudit(c, storage, domain.AuditTransaction, transaction.Id, domain.AuditCreate, nil, transaction); err != nil {
+			return err
+		}
+
+		if err := storage.StatementLines.Link(c.Request.Context(), &line, transaction.Id); err != nil {
+			return err
+		}
+		reconciled := transaction
+		reconciled.Reconciled = true
+		return writeAudit(c, storage, domain.AuditTransaction, transaction.Id, domain.AuditUpdate, transaction, reconciled)
+	})
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Transaction for statement line not created.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	server.sendReconciliationReport(c, reconciliation)
+}
+
+// Ignore a statement line, for instance bank costs that are not administrated
+func (server *Server) PostReconciliationIgnore(c *gin.Context) {
+
+	reconciliation, line, _, ok := server.reconciliationAction(c)
+	if !ok {
+		return
+	}
+
+	ignored := line
+	err := server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+		if err := storage.StatementLines.Ignore(c.Request.Context(), &ignored); err != nil {
+			return err
+		}
+		return writeAudit(c, storage, domain.AuditStatementLine, line.Id, domain.AuditUpdate, line, ignored)
+	})
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Statement line not ignored.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		server.auditFailure(c, domain.AuditStatementLine, line.Id, domain.AuditUpdate, line, ignored, serverError.Ticket)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	server.sendReconciliationReport(c, reconciliation)
+}
+
+// Undo the reconciliation of a transaction, so it can be modified again
+func (server *Server) PostTransactionUnreconcile(c *gin.Context) {
+	id := c.Param("id")
+
+	var old, transaction domain.Transaction
+	// read and locked in the transaction of the change, of two concurrent requests the second one finds it not reconciled
+	err := server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+		var err error
+		if old, err = storage.Transactions.ReadForUpdate(c.Request.Context(), id); err != nil {
+			return err
+		}
+		if !old.Reconciled {
+			var serverError domain.ServerError = domain.GenerateServerError("Transaction is not reconciled.")
+			log.WithFields(log.Fields{"id": id, "clientcode": serverError.Ticket}).Error(serverError.Message)
+			respondError(c, http.StatusConflict, serverError)
+			return errAnswered
+		}
+
+		transaction = old
+		transaction.Reconciled = false
+		if err := storage.StatementLines.UnlinkTransaction(c.Request.Context(), transaction.Id); err != nil {
+			return err
+		}
+		return writeAudit(c, storage, domain.AuditTransaction, transaction.Id, domain.AuditUpdate, old, transaction)
+	})
+	if errors.Is(err, errAnswered) {
+		return
+	}
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Transaction not found, not unreconciled.")
+		if !errors.Is(err, domain.ErrNotFound) {
+			log.WithFields(log.Fields{"id": id, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+			server.auditFailure(c, domain.AuditTransaction, old.Id, domain.AuditUpdate, old, transaction, serverError.Ticket)
+		}
+		respondDomainError(c, err, http.StatusNotFound, serverError)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, transaction)
+}
@@ -1,19 +1,74 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/bank/config"
 	"github.com/bank/domain"
 	"github.com/bank/util"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+	log "github.com/sirupsen/logrus"
 	"github.com/thinkerou/favicon"
 )
 
+// The handlers of the api and the storage they work with
+type Server struct {
+	storage domain.Repositories
+	dbpool  *pgxpool.Pool // the postgres pool of /pool, nil without postgres
+	content sync.Mutex    // held while attachment content is saved or removed with the attachments using it
+}
+
+// The handlers working with the repositories of storage
+func NewServer(storage domain.Repositories, dbpool *pgxpool.Pool) *Server {
+	return &Server{storage: storage, dbpool: dbpool}
+}
+
+// respond 503 Service Unavailable to the requests that need the postgres database when there is none
+func (server *Server) requireDatabase() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if server.dbpool == nil {
+			var serverError domain.ServerError = domain.GenerateServerError("Not available without postgres database.")
+			log.WithFields(log.Fields{"path": c.Request.URL.Path, "clientcode": serverError.Ticket}).Warn(serverError.Message)
+			respondError(c, http.StatusServiceUnavailable, serverError)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Middleware giving the context of the request the configured deadline, 0 is no deadline. The database queries
+// of the request use the context, they are cancelled when the deadline passes, when the client disconnects or
+// when the server is shut down.
+func requestTimeout() gin.HandlerFunc {
+	timeout := config.Current.RequestTimeout
+
+	return func(c *gin.Context) {
+		if timeout == 0 {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
 // get pool information
-func GetPool(c *gin.Context) {
-	stat := util.Dbpool.Stat()
+func (server *Server) GetPool(c *gin.Context) {
+	stat := server.dbpool.Stat()
 
 	var status domain.DbpoolStat
 	status.AcquireConns = stat.AcquiredConns()
@@ -28,7 +83,376 @@ func GetPool(c *gin.Context) {
 	c.IndentedJSON(http.StatusOK, status)
 }
 
+// parse a date parameter formatted as yyyy-mm-dd, an empty value is the zero time
+func parseDate(value string) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// parse the page parameters after (id of the last element of the previous page), limit and count
+func parsePage(c *gin.Context) (domain.Page, error) {
+	var page domain.Page
+	var err error
+
+	page.After, err = strconv.ParseInt(c.DefaultQuery("after", "0"), 10, 64)
+	if err == nil {
+		page.Limit, err = strconv.ParseInt(c.DefaultQuery("limit", "0"), 10, 64)
+	}
+	if err == nil {
+		page.Count, err = strconv.ParseBool(c.DefaultQuery("count", "false"))
+	}
+	if err == nil && (page.After < 0 || page.Limit < 0) {
+		err = fmt.Errorf("negative after or limit")
+	}
+	return page, err
+}
+
+// parse the order parameters sort (one of columns) and order (asc or desc) into page
+func parseSort(c *gin.Context, page *domain.Page, columns map[string]bool) error {
+	page.Sort = c.DefaultQuery("sort", "id")
+	if !columns[page.Sort] {
+		return fmt.Errorf("unknown sort %s", page.Sort)
+	}
+
+	switch c.DefaultQuery("order", "desc") {
+	case "asc":
+		page.Ascending = true
+	case "desc":
+		page.Ascending = false
+	default:
+		return fmt.Errorf("order must be asc or desc")
+	}
+	return nil
+}
+
+// Link to the next page and the total count when requested
+func setPageHeaders(c *gin.Context, page domain.Page) {
+	if page.Next > 0 {
+		next := *c.Request.URL
+		query := next.Query()
+		query.Set("after", strconv.FormatInt(page.Next, 10))
+		next.RawQuery = query.Encode()
+		c.Writer.Header().Add("Link", "<"+next.RequestURI()+">; rel=\"next\"")
+	}
+	if page.Count {
+		c.Header("X-Total-Count", strconv.FormatInt(page.Total, 10))
+	}
+}
+
+// parse parameter includeDeleted, deleted accounts and targets are hidden by default
+func parseIncludeDeleted(c *gin.Context) (bool, error) {
+	return strconv.ParseBool(c.DefaultQuery("includeDeleted", "false"))
+}
+
+// Shape of returned entities: the references expanded into the referenced entities and the fields returned
+type representation struct {
+	expand map[string]bool
+	fields map[string]bool
+}
+
+// Adds the requested expansions to the json objects of the entities, in the same order
+type expander func(objects []map[string]json.RawMessage, expand map[string]bool) error
+
+// parse parameters expand and fields, comma separated lists. Only the given expansions are known,
+// unknown fields are not returned
+func parseRepresentation(c *gin.Context, expansions ...string) (representation, error) {
+	shape := representation{expand: map[string]bool{}, fields: map[string]bool{}}
+
+	for _, name := range strings.Split(c.Query("expand"), ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		known := false
+		for _, expansion := range expansions {
+			known = known || name == expansion
+		}
+		if !known {
+			return shape, fmt.Errorf("unknown expand %s", name)
+		}
+		shape.expand[name] = true
+	}
+
+	for _, name := range strings.Split(c.Query("fields"), ",") {
+		if name = strings.TrimSpace(name); len(name) > 0 {
+			shape.fields[name] = true
+		}
+	}
+	return shape, nil
+}
+
+// the entities as they are stored
+func (shape representation) plain() bool {
+	return len(shape.expand) == 0 && len(shape.fields) == 0
+}
+
+// expand and select the fields of json objects
+func (shape representation) apply(objects []map[string]json.RawMessage, expand expander) error {
+	if len(shape.expand) > 0 {
+		if err := expand(objects, shape.expand); err != nil {
+			return err
+		}
+	}
+	if len(shape.fields) > 0 {
+		for _, object := range objects {
+			for name := range object {
+				if !shape.fields[name] {
+					delete(object, name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// a list of entities in the requested shape
+func (shape representation) list(entities any, expand expander) (any, error) {
+	var objects []map[string]json.RawMessage
+
+	if shape.plain() {
+		return entities, nil
+	}
+
+	data, err := json.Marshal(entities)
+	if err == nil {
+		err = json.Unmarshal(data, &objects)
+	}
+	if err == nil {
+		err = shape.apply(objects, expand)
+	}
+	return objects, err
+}
+
+// an entity in the requested shape
+func (shape representation) single(entity any, expand expander) (any, error) {
+	var object map[string]json.RawMessage
+
+	if shape.plain() {
+		return entity, nil
+	}
+
+	data, err := json.Marshal(entity)
+	if err == nil {
+		err = json.Unmarshal(data, &object)
+	}
+	if err == nil {
+		err = shape.apply([]map[string]json.RawMessage{object}, expand)
+	}
+	return object, err
+}
+
+// Status of the error of a domain method: missing when the entity does not exist, 409 for a duplicate,
+// 422 for a reference or a value that is not allowed, 504 when the request timeout passed, 503 when the request
+// is canceled and 500 for other errors.
+// Missing is 404 for the entity of the path, 400 for a parameter and 422 for a reference in the body.
+func errorStatus(err error, missing int) int {
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		return missing
+	case errors.Is(err, domain.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, domain.ErrForeignKey), errors.Is(err, domain.ErrValidation):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, context.DeadlineExceeded):
+		// the database did not answer within the request timeout
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// The answer to an error of a handler, kept as meta of the error for errorMiddleware
+type errorAnswer struct {
+	missing     int
+	serverError domain.ServerError
+}
+
+// Answer a request with the error of a domain method, the status follows from the error, see errorStatus.
+// The error is added to the errors of the request and answered by errorMiddleware when the handler returns.
+// The handler has logged the error, it is public for the logger of gin.
+func respondDomainError(c *gin.Context, err error, missing int, serverError domain.ServerError) {
+	c.Error(err).SetType(gin.ErrorTypePublic).SetMeta(errorAnswer{missing: missing, serverError: serverError})
+}
+
+// Middleware answering the last error of a handler that did not answer itself, with the status of errorStatus.
+// The reason of an error the client can correct is added to the message.
+func errorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		failure := c.Errors.Last()
+		if failure == nil || c.Writer.Written() {
+			return
+		}
+		answer, ok := failure.Meta.(errorAnswer)
+		if !ok {
+			answer = errorAnswer{missing: http.StatusInternalServerError, serverError: domain.GenerateServerError("Request failed.")}
+			log.WithFields(log.Fields{"error": failure.Err, "clientcode": answer.serverError.Ticket}).Error(answer.serverError.Message)
+		}
+		if reason := domain.Reason(failure.Err); len(reason) > 0 {
+			answer.serverError.Message += " " + reason
+		}
+		respondError(c, errorStatus(failure.Err, answer.missing), answer.serverError)
+	}
+}
+
+// Returned by the work of Atomic when it has answered the request, the work is rolled back
+var errAnswered = errors.New("request answered")
+
+// Answer a request with a body of another content type than json
+func respondData(c *gin.Context, contentType string, data []byte) {
+	c.Header("Content-Type", contentType)
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// Answer a request with an error as application/problem+json.
+// Clients that prefer application/json in header Accept get the error as domain.ServerError, as before problem+json.
+func respondError(c *gin.Context, status int, serverError domain.ServerError) {
+	if c.NegotiateFormat("application/problem+json", "application/json") == "application/json" {
+		c.IndentedJSON(status, serverError)
+		return
+	}
+
+	c.Header("Content-Type", "application/problem+json")
+	c.IndentedJSON(status, serverError.Problem(status, c.Request.URL.Path))
+}
+
+// ETag of an entity, equal to the ETag of the GET services
+func entityEtag(entity any) (string, error) {
+	value, err := util.StrucToJsonString(entity)
+	if err != nil {
+		return "", err
+	}
+	return util.EtagHash(value), nil
+}
+
+// set the ETag of an entity as response header, as returned by the GET services
+func setEtag(c *gin.Context, entity any) {
+	key, err := entityEtag(entity)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("No etag for entity")
+		return
+	}
+	c.Header("ETag", key)
+}
+
+// true when one of the entity tags of an If-Match header is key or *.
+// Weak tags are accepted, the tags are hashes of the content.
+func etagMatches(header string, key string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		tag = strings.Trim(strings.TrimPrefix(tag, "W/"), `"`)
+		if tag == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Check header If-Match against the ETag of the current entity, so a client does not overwrite a change it has not seen.
+// Responds 412 when the entity changed and 428 when the header is missing while require if match is configured.
+// Returns false when the request has been answered.
+func checkIfMatch(c *gin.Context, current any) bool {
+	ifmatch := c.Request.Header.Get("If-Match")
+
+	if len(ifmatch) == 0 {
+		if config.Current.RequireIfMatch {
+			var serverError domain.ServerError = domain.GenerateServerError("Header If-Match required.")
+			respondError(c, http.StatusPreconditionRequired, serverError)
+			return false
+		}
+		return true
+	}
+
+	key, err := entityEtag(current)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error converting entity to json")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return false
+	}
+
+	if !etagMatches(ifmatch, key) {
+		var serverError domain.ServerError = domain.GenerateServerError("Modified by someone else, no modification.")
+
+		log.WithFields(log.Fields{"If-Match": ifmatch, "etag": key, "clientcode": serverError.Ticket}).Info(serverError.Message)
+		c.Header("ETag", key)
+		respondError(c, http.StatusPreconditionFailed, serverError)
+		return false
+	}
+	return true
+}
+
+// Apply the patch in the request body to the current entity and bind the result to patched.
+// The body is a JSON merge patch (application/merge-patch+json) or a JSON patch (application/json-patch+json).
+// The patched entity must be a valid body of a put, otherwise the patch is answered with 422.
+// Returns false when the request has been answered.
+func applyPatch(c *gin.Context, current any, patched any) bool {
+	var result []byte
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Patch not readable.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return false
+	}
+
+	doc, err := json.Marshal(current)
+	if err == nil {
+		switch c.ContentType() {
+		case "application/merge-patch+json":
+			result, err = util.MergePatch(doc, body)
+		case "application/json-patch+json":
+			result, err = util.JsonPatch(doc, body)
+		default:
+			var serverError domain.ServerError = domain.GenerateServerError("Content type must be application/merge-patch+json or application/json-patch+json.")
+			respondError(c, http.StatusUnsupportedMediaType, serverError)
+			return false
+		}
+	}
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Patch not applied: " + err.Error())
+		status := http.StatusBadRequest
+		if errors.Is(err, util.ErrPatchTest) {
+			status = http.StatusConflict
+		}
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, status, serverError)
+		return false
+	}
+
+	if err = validatePatched(c, result); err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Patched entity does not match the api.")
+		serverError.Invalid = invalidValues(err)
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusUnprocessableEntity, serverError)
+		return false
+	}
+
+	if err = json.Unmarshal(result, patched); err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error in patched json.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusUnprocessableEntity, serverError)
+		return false
+	}
+	return true
+}
+
 // use contenttype application/json for all services
+// The responses are json unless a handler answers with another content type by respondData.
+// Gin only sets the content type of a response when it is not set yet.
 func jsonMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Content-Type", "application/json")
@@ -54,50 +478,158 @@ func enableCors() gin.HandlerFunc {
 }
 */
 
-func StartServer() *http.Server {
+// Date from which the unversioned paths are deprecated
+var unversionedDeprecation = time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+
+// Date after which the unversioned paths are removed, the configured api sunset (yyyy-mm-dd) postpones it
+var unversionedSunset = time.Date(2027, 4, 30, 0, 0, 0, 0, time.UTC)
+
+// Middleware of paths that are kept as alias of a version. Each response tells since when the path is deprecated,
+// when it is removed and the path of the version that replaces it.
+func deprecatedAlias(version string) gin.HandlerFunc {
+	sunset := unversionedSunset
+
+	if value := config.Current.ApiSunset; len(value) > 0 {
+		date, err := parseDate(value)
+		if err != nil {
+			log.WithFields(log.Fields{"api_sunset": value, "error": err}).Error("Invalid sunset date, use yyyy-mm-dd")
+		} else {
+			sunset = date
+		}
+	}
+
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "@"+strconv.FormatInt(unversionedDeprecation.Unix(), 10))
+		c.Header("Sunset", sunset.Format(http.TimeFormat))
+		c.Writer.Header().Add("Link", "<"+version+c.Request.URL.RequestURI()+">; rel=\"successor-version\"")
+		c.Next()
+	}
+}
+
+// Routes of version 1 of the api.
+// A next version gets its own group and function, registering the handlers that changed and the others of version 1.
+func (server *Server) routesV1(routes *gin.RouterGroup) {
+	routes.DELETE("/accounts/:id", server.DeleteAccountById)
+	routes.GET("/accounts", server.GetAccounts)
+	routes.GET("/accounts/:id", server.GetAccountById)
+	routes.POST("/accounts", server.PostAccount)
+	routes.PUT("/accounts/:id", server.PutAccountById)
+	routes.PATCH("/accounts/:id", server.PatchAccountById)
+	routes.GET("/accounts/search/:term", server.SearchAccounts)
+	routes.GET("/accounts/:id/export", server.ExportAccount)
+	routes.POST("/accounts/:id/restore", server.PostAccountRestore)
+
+	routes.DELETE("/targets/:id", server.DeleteTargetById)
+	routes.GET("/targets", server.GetTargets)
+	routes.GET("/targets/:id", server.GetTargetById)
+	routes.POST("/targets", server.PostTarget)
+	routes.PUT("/targets/:id", server.PutTargetById)
+	routes.PATCH("/targets/:id", server.PatchTargetById)
+	routes.GET("/targets/search/:term", server.SearchTargets)
+	routes.POST("/targets/:id/restore", server.PostTargetRestore)
+
+	routes.DELETE("/transactions/:id", server.DeleteTransactionById)
+	routes.GET("/transactions", server.GetTransactions)
+	routes.GET("/transactions/export.csv", server.ExportTransactions)
+	routes.GET("/transactions/search/:term", server.SearchTransactions)
+	routes.GET("/transactions/:id", server.GetTransactionById)
+	routes.POST("/transactions", server.PostTransaction)
+	routes.PUT("/transactions/:id", server.PutTransactionById)
+	routes.PATCH("/transactions/:id", server.PatchTransactionById)
+	routes.PUT("/transactions/:id/tags/:tag", server.PutTransactionTag)
+	routes.DELETE("/transactions/:id/tags/:tag", server.DeleteTransactionTag)
 
+	routes.GET("/book/export", server.ExportBook)
+	routes.POST("/book/import", server.ImportBook)
+
+	routes.POST("/transactions/:id/unreconcile", server.PostTransactionUnreconcile)
+	routes.GET("/tags", server.GetTags)
+	routes.POST("/transactions/:id/attachments", server.PostAttachment)
+	routes.GET("/transactions/:id/attachments", server.GetAttachments)
+	routes.GET("/transactions/:id/attachments/:attachment", server.GetAttachmentById)
+	routes.DELETE("/transactions/:id/attachments/:attachment", server.DeleteAttachmentById)
+
+	routes.POST("/reconciliation", server.PostReconciliation)
+	routes.GET("/reconciliation/:id", server.GetReconciliationById)
+	routes.POST("/reconciliation/:id/link", server.PostReconciliationLink)
+	routes.POST("/reconciliation/:id/create", server.PostReconciliationCreate)
+	routes.POST("/reconciliation/:id/ignore", server.PostReconciliationIgnore)
+
+	routes.GET("/imports/csv/profiles", server.GetCsvProfiles)
+	routes.GET("/imports/csv/profiles/:name", server.GetCsvProfileByName)
+	routes.POST("/imports/csv/profiles", server.PostCsvProfile)
+	routes.PUT("/imports/csv/profiles/:name", server.PutCsvProfileByName)
+	routes.DELETE("/imports/csv/profiles/:name", server.DeleteCsvProfileByName)
+	routes.POST("/imports/csv", server.PostCsvImport)
+
+	routes.GET("/audit", server.GetAudit)
+
+	// the statistics of the postgres pool
+	routes.GET("/pool", server.requireDatabase(), server.GetPool)
+}
+
+// The router of the api, with the handlers of server.
+// Fails when the OpenAPI document is invalid or does not document a route.
+func (server *Server) Router() (*gin.Engine, error) {
 	router := gin.Default()
-	router.DELETE("/accounts/:id", DeleteAccountById)
-	router.GET("/accounts", GetAccounts)
-	router.GET("/accounts/:id", GetAccountById)
-	router.POST("/accounts", PostAccount)
-	router.PUT("/accounts/:id", PutAccountById)
-	router.GET("/accounts/search/:term", SearchAccounts)
-
-	router.DELETE("/targets/:id", DeleteTargetById)
-	router.GET("/targets", GetTargets)
-	router.GET("/targets/:id", GetTargetById)
-	router.POST("/targets", PostTarget)
-	router.PUT("/targets/:id", PutTargetById)
-
-	router.DELETE("/transactions/:id", DeleteTargetById)
-	router.GET("/transactions", GetTransactions)
-	router.GET("/transactions/:id", GetTransactionById)
-	router.POST("/transactions", PostTransaction)
-	router.PUT("/transactions/:id", PutTransactionById)
-
-	router.GET("/pool", GetPool)
-	router.Use(jsonMiddleware())
-	//router.Use(enableCors())
+	// the headers of proxies are only used from the configured ones
+	if err := router.SetTrustedProxies(config.Current.TrustedProxies); err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Invalid trusted proxies")
+	}
+	router.Use(requestIdMiddleware())
+	router.Use(requestTimeout())
 
+	// before the routes, the middleware of the router only applies to the routes registered after it
 	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "DELETE", "POST", "PUT"},
-		AllowHeaders:     []string{"Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", "accept", "origin", "Cache-Control", "X-Requested-With", "ETag"},
-		ExposeHeaders:    []string{"Content-Length", "ETag"},
+		AllowOrigins:     config.Current.Cors.Origins,
+		AllowWildcard:    true, // origins as https://*.example.com
+		AllowMethods:     []string{"GET", "DELETE", "POST", "PUT", "PATCH"},
+		AllowHeaders:     []string{"Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", "accept", "origin", "Cache-Control", "X-Requested-With", "ETag", "If-Match", "If-None-Match"},
+		ExposeHeaders:    []string{"Content-Length", "ETag", "Link", "X-Total-Count", "Deprecation", "Sunset"},
 		AllowCredentials: true,
-		AllowOriginFunc: func(origin string) bool {
-			return origin == "http://localhost:4200"
-		},
-		MaxAge: 12 * time.Hour,
+		MaxAge:           12 * time.Hour,
 	}))
+	router.Use(jsonMiddleware())
+	//router.Use(enableCors())
+
+	router.Use(favicon.New(config.Current.Favicon)) // set favicon middleware
+
+	doc, err := loadOpenApi()
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+
+	v1 := router.Group("/v1")
+	// the unversioned paths are version 1 for consumers that have not moved to /v1 yet
+	unversioned := router.Group("/", deprecatedAlias("/v1"))
+	// errors are answered inside the validation, the responses are validated too
+	v1.Use(openApiValidation(doc, "/v1"), errorMiddleware())
+	unversioned.Use(openApiValidation(doc, "/v1"), errorMiddleware())
+	server.routesV1(v1)
+	server.routesV1(unversioned)
 
-	router.Use(favicon.New("./resources/favicon.ico")) // set favicon middleware
+	router.GET("/openapi.json", GetOpenApi)
+	router.GET("/docs", GetDocs)
+	router.GET("/docs/:asset", GetDocsAsset)
+
+	// every route is validated against the document, an undocumented route would not be
+	if err := checkOpenApi(doc, router.Routes(), "/v1"); err != nil {
+		return nil, err
+	}
+	return router, nil
+}
+
+// The http server of the api, with the handlers of server
+func StartServer(server *Server) (*http.Server, error) {
+	router, err := server.Router()
+	if err != nil {
+		return nil, err
+	}
 
 	srv := &http.Server{
-		Addr:    ":8080",
+		Addr:    config.Current.Listen,
 		Handler: router,
 	}
 
-	return srv
+	return srv, nil
 }
@@ -0,0 +1,1099 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bank/config"
+	"github.com/bank/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// The router of a server with the storage in memory, the attachments are saved in a temporary directory
+func newTestRouter(t *testing.T) *gin.Engine {
+	return newStorageRouter(t, domain.MemoryRepositories())
+}
+
+// The router of a server with storage, the attachments are saved in a temporary directory
+func newStorageRouter(t *testing.T, storage domain.Repositories) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	current := config.Current
+	t.Cleanup(func() { config.Current = current })
+	config.Current = config.Defaults()
+	config.Current.Favicon = "../resources/favicon.ico"
+	config.Current.AttachmentDir = t.TempDir()
+
+	router, err := NewServer(storage, nil).Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return router
+}
+
+// Do a request on router, a body is sent as json unless contentType is given
+func call(router *gin.Engine, method string, path string, contentType string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if len(body) > 0 {
+		if len(contentType) == 0 {
+			contentType = "application/json"
+		}
+		request.Header.Set("Content-Type", contentType)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// Do a request that must be answered with status and decode the response into result
+func mustCall(t *testing.T, router *gin.Engine, method string, path string, body string, status int, result any) {
+	t.Helper()
+
+	recorder := call(router, method, path, "", body)
+	if recorder.Code != status {
+		t.Fatalf("%s %s: status %d, want %d: %s", method, path, recorder.Code, status, recorder.Body.String())
+	}
+	if result != nil {
+		if err := json.Unmarshal(recorder.Body.Bytes(), result); err != nil {
+			t.Fatalf("%s %s: %v in %s", method, path, err, recorder.Body.String())
+		}
+	}
+}
+
+// Create two accounts, a target and a transaction of 12.50 between the accounts
+func createTransaction(t *testing.T, router *gin.Engine) (domain.Account, domain.Account, domain.Target, domain.Transaction) {
+	t.Helper()
+	var from, to domain.Account
+	var target domain.Target
+	var transaction domain.Transaction
+
+	mustCall(t, router, "POST", "/v1/accounts", `{"number": "NL01BANK0001", "description": "checking"}`, http.StatusOK, &from)
+	mustCall(t, router, "POST", "/v1/accounts", `{"number": "NL01SHOP0002", "description": "grocer"}`, http.StatusOK, &to)
+	mustCall(t, router, "POST", "/v1/targets", `{"name": "groceries", "description": "food"}`, http.StatusOK, &target)
+	mustCall(t, router, "POST", "/v1/transactions",
+		`{"from": `+id(from.Id)+`, "to": `+id(to.Id)+`, "target": `+id(target.Id)+`, "amount": 1250, "description": "weekly shopping", "date": "2024-03-01T00:00:00Z"}`,
+		http.StatusOK, &transaction)
+	return from, to, target, transaction
+}
+
+func id(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+func TestAccounts(t *testing.T) {
+	router := newTestRouter(t)
+
+	var account domain.Account
+	mustCall(t, router, "POST", "/v1/accounts", `{"number": "NL01BANK0001", "description": "checking"}`, http.StatusOK, &account)
+	if account.Id == 0 {
+		t.Fatalf("account without id: %+v", account)
+	}
+
+	var accounts []domain.Account
+	mustCall(t, router, "GET", "/v1/accounts", "", http.StatusOK, &accounts)
+	if len(accounts) != 1 || accounts[0].Number != "NL01BANK0001" {
+		t.Errorf("got %+v, want the created account", accounts)
+	}
+
+	mustCall(t, router, "PUT", "/v1/accounts/"+id(account.Id), `{"id": `+id(account.Id)+`, "number": "NL01BANK0001", "description": "savings"}`, http.StatusOK, &account)
+	if account.Description != "savings" {
+		t.Errorf("description %q, want savings", account.Description)
+	}
+
+	mustCall(t, router, "POST", "/v1/accounts", `{"number": "NL01BANK0001"}`, http.StatusConflict, nil)
+	mustCall(t, router, "DELETE", "/v1/accounts/"+id(account.Id), "", http.StatusNoContent, nil)
+	mustCall(t, router, "PUT", "/v1/accounts/"+id(account.Id), `{"id": `+id(account.Id)+`, "number": "NL01BANK0001"}`, http.StatusNotFound, nil)
+	mustCall(t, router, "POST", "/v1/accounts/"+id(account.Id)+"/restore", "", http.StatusOK, nil)
+	mustCall(t, router, "GET", "/v1/accounts/999", "", http.StatusNotFound, nil)
+}
+
+func TestPutTransactionDate(t *testing.T) {
+	router := newTestRouter(t)
+	from, to, target, transaction := createTransaction(t, router)
+	path := "/v1/transactions/" + id(transaction.Id)
+	body := `{"id": ` + id(transaction.Id) + `, "from": ` + id(from.Id) + `, "to": ` + id(to.Id) + `, "target": ` + id(target.Id) +
+		`, "amount": 1300, "description": "weekly shopping"`
+
+	// without date the date is kept
+	var updated domain.Transaction
+	mustCall(t, router, "PUT", path, body+`}`, http.StatusOK, &updated)
+	if !updated.Date.Equal(transaction.Date) || updated.Amount != 1300 {
+		t.Errorf("got %+v, want amount 1300 on %v", updated, transaction.Date)
+	}
+
+	// with date the date is changed
+	mustCall(t, router, "PUT", path, body+`, "date": "2024-03-02T00:00:00Z"}`, http.StatusOK, &updated)
+	if want := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC); !updated.Date.Equal(want) {
+		t.Errorf("got date %v, want %v", updated.Date, want)
+	}
+
+	var read domain.Transaction
+	mustCall(t, router, "GET", path, "", http.StatusOK, &read)
+	if !read.Date.Equal(updated.Date) {
+		t.Errorf("stored date %v, want %v", read.Date, updated.Date)
+	}
+}
+
+// The body of a create or replace has the ids of the accounts and target, not the expanded ones
+func TestTransactionInput(t *testing.T) {
+	router := newTestRouter(t)
+	from, to, target, transaction := createTransaction(t, router)
+
+	for body, field := range map[string]string{
+		`{"from": ` + id(from.Id) + `, "to": ` + id(to.Id) + `, "amount": 100}`:                                          "target",
+		`{"from": {"id": ` + id(from.Id) + `}, "to": ` + id(to.Id) + `, "target": ` + id(target.Id) + `, "amount": 100}`: "/from",
+	} {
+		recorder := call(router, "POST", "/v1/transactions", "", body)
+		if recorder.Code != http.StatusUnprocessableEntity || !strings.Contains(recorder.Body.String(), field) {
+			t.Errorf("%s: status %d, want 422 naming %s: %s", body, recorder.Code, field, recorder.Body.String())
+		}
+	}
+
+	expanded := call(router, "GET", "/v1/transactions/"+id(transaction.Id)+"?expand=from", "", "").Body.String()
+	mustCall(t, router, "PUT", "/v1/transactions/"+id(transaction.Id), expanded, http.StatusUnprocessableEntity, nil)
+}
+
+// Only the fields asked for are returned, expanded references are objects instead of ids
+func TestFieldsAndExpand(t *testing.T) {
+	router := newTestRouter(t)
+	from, to, target, transaction := createTransaction(t, router)
+
+	var objects []map[string]json.RawMessage
+	mustCall(t, router, "GET", "/v1/transactions?fields=id,amount", "", http.StatusOK, &objects)
+	if len(objects) != 1 || len(objects[0]) != 2 || string(objects[0]["amount"]) != "1250" {
+		t.Errorf("got %v, want id and amount", objects)
+	}
+
+	var expanded []struct {
+		Id     int64            `json:"id"`
+		From   domain.Account   `json:"from"`
+		Target domain.Target    `json:"target"`
+		To     json.RawMessage  `json:"to"`
+		Owners []domain.Account `json:"owners"`
+	}
+	mustCall(t, router, "GET", "/v1/transactions?expand=from,target", "", http.StatusOK, &expanded)
+	if len(expanded) != 1 || expanded[0].From.Number != from.Number || expanded[0].Target.Name != target.Name ||
+		string(expanded[0].To) != id(to.Id) || expanded[0].Owners != nil {
+		t.Errorf("got %+v, want from and target expanded", expanded)
+	}
+
+	mustCall(t, router, "GET", "/v1/transactions/"+id(transaction.Id)+"?expand=owners&fields=id,owners", "", http.StatusOK, &expanded[0])
+	if owners := expanded[0].Owners; len(owners) != 2 || owners[0].Number != from.Number || owners[1].Number != to.Number {
+		t.Errorf("got %+v, want the accounts of both sides", owners)
+	}
+
+	var accounts []map[string]json.RawMessage
+	mustCall(t, router, "GET", "/v1/accounts?expand=balance&fields=number,balance", "", http.StatusOK, &accounts)
+	balances := map[string]string{}
+	for _, account := range accounts {
+		var number string
+		json.Unmarshal(account["number"], &number)
+		balances[number] = string(account["balance"])
+	}
+	if len(accounts) != 2 || balances[from.Number] != "-1250" || balances[to.Number] != "1250" {
+		t.Errorf("got %v, want the balances of both accounts", accounts)
+	}
+
+	mustCall(t, router, "GET", "/v1/transactions?expand=balance", "", http.StatusBadRequest, nil)
+	mustCall(t, router, "GET", "/v1/accounts?expand=owners", "", http.StatusBadRequest, nil)
+}
+
+func TestIfMatch(t *testing.T) {
+	router := newTestRouter(t)
+	from, _, _, transaction := createTransaction(t, router)
+	path := "/v1/accounts/" + id(from.Id)
+	body := `{"id": ` + id(from.Id) + `, "number": "NL01BANK0001", "description": "savings"}`
+
+	etag := call(router, "GET", path, "", "").Header().Get("ETag")
+	if recorder := withHeader(router, "PUT", path, body, "If-Match", `"stale"`); recorder.Code != http.StatusPreconditionFailed ||
+		recorder.Header().Get("ETag") != etag {
+		t.Errorf("stale If-Match: status %d with ETag %s, want 412 with %s", recorder.Code, recorder.Header().Get("ETag"), etag)
+	}
+	if recorder := withHeader(router, "DELETE", "/v1/transactions/"+id(transaction.Id), "", "If-Match", `"stale"`); recorder.Code != http.StatusPreconditionFailed {
+		t.Errorf("stale If-Match of delete: status %d, want 412", recorder.Code)
+	}
+	if recorder := withHeader(router, "PUT", path, body, "If-Match", etag); recorder.Code != http.StatusOK {
+		t.Errorf("current If-Match: status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	config.Current.RequireIfMatch = true
+	mustCall(t, router, "PUT", path, body, http.StatusPreconditionRequired, nil)
+	mustCall(t, router, "PATCH", path, "", http.StatusPreconditionRequired, nil)
+}
+
+// Writers with the same If-Match all read the account before any of them writes, only the first one may write
+func TestConcurrentIfMatch(t *testing.T) {
+	for name, storage := range map[string]domain.Repositories{"memory": domain.MemoryRepositories(), "sqlite": newSqliteStorage(t)} {
+		// a read outside the transaction of the change is slow, so all writers read before the first one writes
+		storage.Accounts = slowAccounts{storage.Accounts}
+		router := newStorageRouter(t, storage)
+
+		from, _, _, _ := createTransaction(t, router)
+		path := "/v1/accounts/" + id(from.Id)
+		etag := call(router, "GET", path, "", "").Header().Get("ETag")
+
+		const writers = 8
+		statuses := make(chan int, writers)
+		var wait sync.WaitGroup
+		for i := 0; i < writers; i++ {
+			wait.Add(1)
+			go func(i int) {
+				defer wait.Done()
+				body := `{"id": ` + id(from.Id) + `, "number": "NL01BANK0001", "description": "writer ` + strconv.Itoa(i) + `"}`
+				statuses <- withHeader(router, "PUT", path, body, "If-Match", etag).Code
+			}(i)
+		}
+		wait.Wait()
+		close(statuses)
+
+		count := map[int]int{}
+		for status := range statuses {
+			count[status]++
+		}
+		if count[http.StatusOK] != 1 || count[http.StatusPreconditionFailed] != writers-1 {
+			t.Errorf("%s: got statuses %v, want one 200 and %d times 412", name, count, writers-1)
+		}
+	}
+}
+
+// accounts of which a read by id returns a while after reading
+type slowAccounts struct {
+	domain.AccountRepository
+}
+
+func (accounts slowAccounts) ReadById(ctx context.Context, id string, includeDeleted bool) (domain.Account, error) {
+	account, err := accounts.AccountRepository.ReadById(ctx, id, includeDeleted)
+	time.Sleep(20 * time.Millisecond)
+	return account, err
+}
+
+// Do a request with a json body and a header
+func withHeader(router *gin.Engine, method string, path string, body string, name string, value string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if len(body) > 0 {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	request.Header.Set(name, value)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestTransactionTags(t *testing.T) {
+	router := newTestRouter(t)
+	_, _, _, transaction := createTransaction(t, router)
+	path := "/v1/transactions/" + id(transaction.Id)
+
+	mustCall(t, router, "PUT", path+"/tags/holiday", "", http.StatusOK, &transaction)
+	if !transaction.HasTag("holiday") {
+		t.Errorf("tags %v without holiday", transaction.Tags)
+	}
+
+	var tags []domain.Tag
+	mustCall(t, router, "GET", "/v1/tags", "", http.StatusOK, &tags)
+	if len(tags) != 1 || tags[0].Name != "holiday" || tags[0].Transactions != 1 {
+		t.Errorf("got tags %+v, want holiday used once", tags)
+	}
+
+	mustCall(t, router, "DELETE", path+"/tags/holiday", "", http.StatusOK, &transaction)
+	mustCall(t, router, "DELETE", path+"/tags/holiday", "", http.StatusNotFound, nil)
+	mustCall(t, router, "GET", "/v1/tags", "", http.StatusOK, &tags)
+	if len(tags) != 1 || tags[0].Transactions != 0 {
+		t.Errorf("got tags %+v, want holiday unused", tags)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	router := newTestRouter(t)
+	_, _, _, transaction := createTransaction(t, router)
+
+	mustCall(t, router, "DELETE", "/v1/transactions/"+id(transaction.Id), "", http.StatusNoContent, nil)
+
+	var records []domain.Audit
+	mustCall(t, router, "GET", "/v1/audit?entity=transaction&id="+id(transaction.Id), "", http.StatusOK, &records)
+	if len(records) != 2 || records[0].Action != domain.AuditDelete || records[1].Action != domain.AuditCreate {
+		t.Fatalf("got %+v, want delete and create of the transaction", records)
+	}
+	if string(records[0].New) != "null" || string(records[0].Old) == "null" {
+		t.Errorf("delete with old %s and new %s, want only old", records[0].Old, records[0].New)
+	}
+
+	mustCall(t, router, "GET", "/v1/audit?limit=1", "", http.StatusOK, &records)
+	if len(records) != 1 || records[0].Entity != domain.AuditTransaction {
+		t.Errorf("got %+v, want the last record", records)
+	}
+	mustCall(t, router, "GET", "/v1/audit?entity=tag", "", http.StatusBadRequest, nil)
+
+	// to is inclusive as todate of the transactions, the records of today are included
+	today := time.Now().UTC()
+	mustCall(t, router, "GET", "/v1/audit?entity=transaction&from="+today.Format("2006-01-02")+"&to="+today.Format("2006-01-02"), "", http.StatusOK, &records)
+	if len(records) != 2 {
+		t.Errorf("got %d records from and to today, want 2", len(records))
+	}
+	mustCall(t, router, "GET", "/v1/audit?entity=transaction&to="+today.AddDate(0, 0, -1).Format("2006-01-02"), "", http.StatusOK, &records)
+	if len(records) != 0 {
+		t.Errorf("got %d records to yesterday, want none", len(records))
+	}
+}
+
+func TestAuditActor(t *testing.T) {
+	router := newTestRouter(t)
+	if err := router.SetTrustedProxies([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, proxy := range []struct {
+		remote string
+		actor  string
+	}{
+		{"10.1.2.3:4321", "alice"},
+		{"192.0.2.1:4321", "192.0.2.1"},
+	} {
+		request := httptest.NewRequest("POST", "/v1/targets", strings.NewReader(`{"name": "`+proxy.remote+`"}`))
+		request.RemoteAddr = proxy.remote
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("X-Forwarded-User", "alice")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", recorder.Code, recorder.Body.String())
+		}
+
+		var records []domain.Audit
+		mustCall(t, router, "GET", "/v1/audit?entity=target&limit=1", "", http.StatusOK, &records)
+		if len(records) != 1 || records[0].Actor != proxy.actor {
+			t.Errorf("request from %s: got %+v, want actor %s", proxy.remote, records, proxy.actor)
+		}
+	}
+}
+
+const testProfile = `{"name": "bank", "delimiter": ";", "header": true, "datecolumn": 0, "amountcolumn": 1,
+	"counterpartycolumn": 2, "descriptioncolumn": 3, "decimalseparator": ","}`
+
+func TestBookImport(t *testing.T) {
+	router := newTestRouter(t)
+	journal := `
+2024-03-01 * "NL01SHOP0002" "weekly shopping"
+  Assets:Accounts:NL01BANK0001  -12.50 EUR
+  Expenses:Groceries
+
+2024-03-01 * "NL01SHOP0002" "weekly shopping"
+  Assets:Accounts:NL01BANK0001  -12.50 EUR
+  Expenses:Groceries
+`
+	importBook := func(journal string) bookImportResult {
+		t.Helper()
+		var result bookImportResult
+		recorder := call(router, "POST", "/v1/book/import", "text/plain", journal)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("import status %d: %s", recorder.Code, recorder.Body.String())
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	// equal entries of a journal are distinct transactions
+	if result := importBook(journal); result.Created != 2 || result.Skipped != 0 {
+		t.Errorf("first import %+v, want 2 created", result)
+	}
+
+	// imported again only the new entry is created
+	again := journal + `
+2024-03-01 * "NL01SHOP0002" "weekly shopping"
+  Assets:Accounts:NL01BANK0001  -12.50 EUR
+  Expenses:Groceries
+`
+	if result := importBook(again); result.Created != 1 || result.Skipped != 2 {
+		t.Errorf("second import %+v, want 1 created and 2 skipped", result)
+	}
+
+	var transactions []domain.Transaction
+	mustCall(t, router, "GET", "/v1/transactions", "", http.StatusOK, &transactions)
+	if len(transactions) != 3 {
+		t.Errorf("got %d transactions, want 3", len(transactions))
+	}
+}
+
+func TestCsvImport(t *testing.T) {
+	router := newTestRouter(t)
+	account, _, target, _ := createTransaction(t, router)
+
+	mustCall(t, router, "POST", "/v1/imports/csv/profiles", testProfile, http.StatusOK, nil)
+	mustCall(t, router, "POST", "/v1/imports/csv/profiles", testProfile, http.StatusConflict, nil)
+
+	var profile domain.CsvProfile
+	mustCall(t, router, "GET", "/v1/imports/csv/profiles/bank", "", http.StatusOK, &profile)
+	if profile.Delimiter != ";" || profile.DecimalSeparator != "," {
+		t.Errorf("got %+v, want the posted profile", profile)
+	}
+
+	csv := "date;amount;counterparty;description\n2024-03-02;-10,00;NL01SHOP0002;bread\n2024-03-03;100,00;NL01WORK0003;salary\n"
+	recorder := call(router, "POST", "/v1/imports/csv?profile=bank&account="+id(account.Id)+"&target="+id(target.Id), "text/csv", csv)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("import status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var imported []domain.Transaction
+	if err := json.Unmarshal(recorder.Body.Bytes(), &imported); err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 2 || imported[0].From_account != account.Id || imported[0].Amount != 1000 || imported[1].To_account != account.Id {
+		t.Errorf("got %+v, want bread paid from and salary paid to the account", imported)
+	}
+
+	var accounts []domain.Account
+	mustCall(t, router, "GET", "/v1/accounts", "", http.StatusOK, &accounts)
+	if len(accounts) != 3 {
+		t.Errorf("got %d accounts, want the unknown counterparty created", len(accounts))
+	}
+
+	// the lines imported before are skipped, an equal line that is not imported yet is not
+	csv += "2024-03-02;-10,00;NL01SHOP0002;bread\n"
+	recorder = call(router, "POST", "/v1/imports/csv?profile=bank&account="+id(account.Id)+"&target="+id(target.Id), "text/csv", csv)
+	if err := json.Unmarshal(recorder.Body.Bytes(), &imported); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("import status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if len(imported) != 1 || imported[0].Description != "bread" {
+		t.Errorf("got %+v, want only the second bread", imported)
+	}
+
+	mustCall(t, router, "DELETE", "/v1/imports/csv/profiles/bank", "", http.StatusNoContent, nil)
+	mustCall(t, router, "GET", "/v1/imports/csv/profiles/bank", "", http.StatusNotFound, nil)
+}
+
+func TestCsvProfileColumns(t *testing.T) {
+	router := newTestRouter(t)
+
+	// without a column the profile would read column 0
+	mustCall(t, router, "POST", "/v1/imports/csv/profiles", `{"name": "bank", "amountcolumn": 1, "counterpartycolumn": 2,
+		"descriptioncolumn": 3}`, http.StatusUnprocessableEntity, nil)
+	mustCall(t, router, "POST", "/v1/imports/csv/profiles", `{"name": "bank", "datecolumn": 0, "amountcolumn": 1,
+		"signconvention": "indicator", "debitindicator": "D", "counterpartycolumn": 2, "descriptioncolumn": 3}`, http.StatusUnprocessableEntity, nil)
+
+	var profile domain.CsvProfile
+	mustCall(t, router, "POST", "/v1/imports/csv/profiles", testProfile, http.StatusOK, &profile)
+	if profile.DateColumn != 0 || profile.IndicatorColumn != -1 {
+		t.Errorf("got %+v, want date column 0 and no indicator column", profile)
+	}
+}
+
+func TestReconciliation(t *testing.T) {
+	router := newTestRouter(t)
+	account, _, target, transaction := createTransaction(t, router)
+	mustCall(t, router, "POST", "/v1/imports/csv/profiles", testProfile, http.StatusOK, nil)
+
+	csv := "date;amount;counterparty;description\n2024-03-02;-12,50;NL01SHOP0002;weekly shopping\n2024-03-05;-2,00;;bank costs\n"
+	recorder := call(router, "POST", "/v1/reconciliation?profile=bank&account="+id(account.Id)+"&from=2024-03-01&to=2024-03-31", "text/csv", csv)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("reconciliation status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var report domain.ReconciliationReport
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Matched) != 1 || !report.Matched[0].Suggested || report.Matched[0].Transaction.Id != transaction.Id || len(report.UnmatchedBank) != 1 {
+		t.Fatalf("got %+v, want the shopping suggested and the costs unmatched", report)
+	}
+	path := "/v1/reconciliation/" + id(report.Reconciliation.Id)
+
+	mustCall(t, router, "POST", path+"/link", `{"line": `+id(report.Matched[0].Line.Id)+`, "transaction": `+id(transaction.Id)+`}`, http.StatusOK, &report)
+	if len(report.Matched) != 1 || report.Matched[0].Suggested {
+		t.Errorf("got %+v, want the shopping linked", report.Matched)
+	}
+	mustCall(t, router, "GET", "/v1/transactions/"+id(transaction.Id), "", http.StatusOK, &transaction)
+	if !transaction.Reconciled {
+		t.Errorf("linked transaction is not reconciled")
+	}
+
+	mustCall(t, router, "POST", path+"/create", `{"line": `+id(report.UnmatchedBank[0].Id)+`, "target": `+id(target.Id)+`}`, http.StatusOK, &report)
+	if len(report.Matched) != 2 || len(report.UnmatchedBank) != 0 {
+		t.Errorf("got %+v, want the costs created", report)
+	}
+
+	mustCall(t, router, "POST", "/v1/transactions/"+id(transaction.Id)+"/unreconcile", "", http.StatusOK, &transaction)
+	mustCall(t, router, "POST", "/v1/transactions/"+id(transaction.Id)+"/unreconcile", "", http.StatusConflict, nil)
+	mustCall(t, router, "GET", path, "", http.StatusOK, &report)
+	if len(report.Matched) != 2 || !report.Matched[1].Suggested && !report.Matched[0].Suggested {
+		t.Errorf("got %+v, want the shopping suggested again", report.Matched)
+	}
+	mustCall(t, router, "GET", "/v1/reconciliation/999", "", http.StatusNotFound, nil)
+	mustCall(t, router, "POST", "/v1/transactions/999/unreconcile", "", http.StatusNotFound, nil)
+}
+
+func TestReconciliationIgnore(t *testing.T) {
+	router := newTestRouter(t)
+	account, _, _, _ := createTransaction(t, router)
+	mustCall(t, router, "POST", "/v1/imports/csv/profiles", testProfile, http.StatusOK, nil)
+
+	csv := "date;amount;counterparty;description\n2024-03-05;-2,00;;bank costs\n"
+	recorder := call(router, "POST", "/v1/reconciliation?profile=bank&account="+id(account.Id)+"&from=2024-03-01&to=2024-03-31", "text/csv", csv)
+	var report domain.ReconciliationReport
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil || len(report.UnmatchedBank) != 1 {
+		t.Fatalf("got %s, want the costs unmatched", recorder.Body.String())
+	}
+	path := "/v1/reconciliation/" + id(report.Reconciliation.Id)
+	line := report.UnmatchedBank[0]
+
+	mustCall(t, router, "POST", path+"/ignore", `{"line": `+id(line.Id)+`}`, http.StatusOK, &report)
+	if len(report.UnmatchedBank) != 0 {
+		t.Errorf("got %+v, want the costs ignored", report.UnmatchedBank)
+	}
+	mustCall(t, router, "POST", path+"/ignore", `{"line": `+id(line.Id)+`}`, http.StatusConflict, nil)
+
+	var records []domain.Audit
+	mustCall(t, router, "GET", "/v1/audit?entity=statementline&id="+id(line.Id), "", http.StatusOK, &records)
+	if len(records) != 1 || records[0].Action != domain.AuditUpdate || !strings.Contains(string(records[0].New), domain.StatementLineIgnored) {
+		t.Errorf("got %+v, want the ignore audited", records)
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	router := newTestRouter(t)
+	_, _, _, transaction := createTransaction(t, router)
+	path := "/v1/transactions/" + id(transaction.Id) + "/attachments"
+
+	recorder := upload(router, path, "receipt.txt", "bread 2.50")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("upload status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var attachment domain.Attachment
+	if err := json.Unmarshal(recorder.Body.Bytes(), &attachment); err != nil {
+		t.Fatal(err)
+	}
+	if attachment.Filename != "receipt.txt" || attachment.Size != 10 {
+		t.Errorf("got %+v, want receipt.txt of 10 bytes", attachment)
+	}
+
+	var attachments []domain.Attachment
+	mustCall(t, router, "GET", path, "", http.StatusOK, &attachments)
+	if len(attachments) != 1 {
+		t.Errorf("got %d attachments, want 1", len(attachments))
+	}
+
+	recorder = call(router, "GET", path+"/"+id(attachment.Id), "", "")
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "bread 2.50" {
+		t.Errorf("download status %d with %q", recorder.Code, recorder.Body.String())
+	}
+	if got := recorder.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("got X-Content-Type-Options %q, want nosniff", got)
+	}
+
+	// the content is kept while another attachment uses it
+	var copy domain.Attachment
+	if err := json.Unmarshal(upload(router, path, "copy.txt", "bread 2.50").Body.Bytes(), &copy); err != nil {
+		t.Fatal(err)
+	}
+	mustCall(t, router, "DELETE", path+"/"+id(attachment.Id), "", http.StatusNoContent, nil)
+	mustCall(t, router, "GET", path+"/"+id(attachment.Id), "", http.StatusNotFound, nil)
+	if recorder = call(router, "GET", path+"/"+id(copy.Id), "", ""); recorder.Body.String() != "bread 2.50" {
+		t.Errorf("download of the copy status %d with %q", recorder.Code, recorder.Body.String())
+	}
+
+	// the content is removed with the transaction
+	mustCall(t, router, "DELETE", "/v1/transactions/"+id(transaction.Id), "", http.StatusNoContent, nil)
+	if _, err := os.Stat(filepath.Join(config.Current.AttachmentDir, copy.Hash[0:2], copy.Hash)); !os.IsNotExist(err) {
+		t.Errorf("content of the deleted transaction still stored: %v", err)
+	}
+}
+
+func TestAttachmentMaxSize(t *testing.T) {
+	router := newTestRouter(t)
+	_, _, _, transaction := createTransaction(t, router)
+	path := "/v1/transactions/" + id(transaction.Id) + "/attachments"
+	config.Current.AttachmentMaxSize = 1024
+
+	if recorder := upload(router, path, "small.txt", "bread 2.50"); recorder.Code != http.StatusOK {
+		t.Errorf("small upload status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := upload(router, path, "large.txt", strings.Repeat("bread 2.50", 200)); recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large upload status %d, want %d", recorder.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	// without Content-Length the body is cut at the maximum
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, _ := form.CreateFormFile("file", "chunked.txt")
+	file.Write([]byte(strings.Repeat("bread 2.50", 200)))
+	form.Close()
+	request := httptest.NewRequest("POST", path, &body)
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	request.ContentLength = -1
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Code == http.StatusOK {
+		t.Errorf("chunked large upload accepted: %s", recorder.Body.String())
+	}
+
+	var attachments []domain.Attachment
+	mustCall(t, router, "GET", path, "", http.StatusOK, &attachments)
+	if len(attachments) != 1 {
+		t.Errorf("got %d attachments, want only the small one", len(attachments))
+	}
+}
+
+// Upload content as file name to the attachments of path
+func upload(router *gin.Engine, path string, name string, content string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, _ := form.CreateFormFile("file", name)
+	file.Write([]byte(content))
+	form.Close()
+
+	return call(router, "POST", path, form.FormDataContentType(), body.String())
+}
+
+func TestOpenApiRoutes(t *testing.T) {
+	doc, err := loadOpenApi()
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := newTestRouter(t)
+	if err := checkOpenApi(doc, router.Routes(), "/v1"); err != nil {
+		t.Errorf("router: %v", err)
+	}
+
+	routes := append(router.Routes(), gin.RouteInfo{Method: "GET", Path: "/v1/accounts/:id/secrets"})
+	err = checkOpenApi(doc, routes, "/v1")
+	if err == nil || !strings.Contains(err.Error(), "GET /v1/accounts/:id/secrets") {
+		t.Errorf("got %v, want the undocumented route", err)
+	}
+}
+
+func TestDocs(t *testing.T) {
+	router := newTestRouter(t)
+
+	for path, contentType := range map[string]string{"/docs": "text/html", "/docs/swagger-ui-bundle.js": "javascript",
+		"/docs/swagger-initializer.js": "javascript", "/docs/swagger-ui.css": "text/css", "/docs/favicon-32x32.png": "image/png"} {
+		recorder := call(router, "GET", path, "", "")
+		if recorder.Code != http.StatusOK || !strings.Contains(recorder.Header().Get("Content-Type"), contentType) {
+			t.Errorf("%s: status %d with %s", path, recorder.Code, recorder.Header().Get("Content-Type"))
+		}
+		if policy := recorder.Header().Get("Content-Security-Policy"); !strings.HasPrefix(policy, "default-src 'self'") {
+			t.Errorf("%s: got policy %q", path, policy)
+		}
+	}
+
+	// the page and its initializer load from the server itself
+	page := call(router, "GET", "/docs", "", "").Body.String()
+	if !strings.Contains(page, `src="/docs/swagger-ui-bundle.js"`) || strings.Contains(page, "https://") {
+		t.Errorf("got page %s, want swagger ui of the server", page)
+	}
+	initializer := call(router, "GET", "/docs/swagger-initializer.js", "", "").Body.String()
+	if !strings.Contains(initializer, `url: "/openapi.json"`) || strings.Contains(initializer, "https://") {
+		t.Errorf("got initializer %s, want the document of the server", initializer)
+	}
+	mustCall(t, router, "GET", "/docs/missing.js", "", http.StatusNotFound, nil)
+}
+
+func TestPoolWithoutPostgres(t *testing.T) {
+	router := newTestRouter(t)
+	mustCall(t, router, "GET", "/v1/pool", "", http.StatusServiceUnavailable, nil)
+}
+
+// A list of which the deadline passed is not read, the database is given up on
+func TestRequestDeadline(t *testing.T) {
+	router := newSqliteRouter(t)
+	createTransaction(t, router)
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	for _, path := range []string{"/v1/accounts", "/v1/targets", "/v1/transactions", "/v1/transactions?limit=1"} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil).WithContext(ctx))
+		if recorder.Code != http.StatusGatewayTimeout {
+			t.Errorf("%s: status %d, want %d: %s", path, recorder.Code, http.StatusGatewayTimeout, recorder.Body.String())
+		}
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/v1/transactions", nil).WithContext(canceled))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("canceled: status %d, want %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err     error
+		missing int
+		want    int
+	}{
+		{fmt.Errorf("account 7: %w", domain.ErrNotFound), http.StatusNotFound, http.StatusNotFound},
+		{fmt.Errorf("target 7: %w", domain.ErrNotFound), http.StatusUnprocessableEntity, http.StatusUnprocessableEntity},
+		{fmt.Errorf("number: %w", domain.ErrConflict), http.StatusNotFound, http.StatusConflict},
+		{fmt.Errorf("target: %w", domain.ErrForeignKey), http.StatusNotFound, http.StatusUnprocessableEntity},
+		{&domain.ValidationError{Reason: "amount is negative"}, http.StatusNotFound, http.StatusUnprocessableEntity},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), http.StatusNotFound, http.StatusGatewayTimeout},
+		{fmt.Errorf("query: %w", context.Canceled), http.StatusNotFound, http.StatusServiceUnavailable},
+		{errors.New("disk full"), http.StatusNotFound, http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		if got := errorStatus(test.err, test.missing); got != test.want {
+			t.Errorf("%v with missing %d: status %d, want %d", test.err, test.missing, got, test.want)
+		}
+	}
+}
+
+func TestErrorMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(errorMiddleware())
+	router.GET("/invalid", func(c *gin.Context) {
+		respondDomainError(c, &domain.ValidationError{Reason: "amount is negative"}, http.StatusNotFound, domain.GenerateServerError("Transaction not saved."))
+	})
+	router.GET("/unknown", func(c *gin.Context) {
+		c.Error(errors.New("disk full"))
+	})
+	router.GET("/answered", func(c *gin.Context) {
+		c.Error(errors.New("logged only"))
+		c.AbortWithStatus(http.StatusNoContent)
+	})
+
+	recorder := call(router, "GET", "/invalid", "", "")
+	var problem domain.Problem
+	if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Code != http.StatusUnprocessableEntity || recorder.Header().Get("Content-Type") != "application/problem+json" ||
+		problem.Status != http.StatusUnprocessableEntity || problem.Detail != "Transaction not saved. amount is negative" {
+		t.Errorf("status %d, %s, want 422 with the reason", recorder.Code, recorder.Body.String())
+	}
+
+	if recorder := call(router, "GET", "/unknown", "", ""); recorder.Code != http.StatusInternalServerError {
+		t.Errorf("error without answer: status %d, want %d", recorder.Code, http.StatusInternalServerError)
+	}
+	if recorder := call(router, "GET", "/answered", "", ""); recorder.Code != http.StatusNoContent {
+		t.Errorf("answered: status %d, want %d", recorder.Code, http.StatusNoContent)
+	}
+}
+
+// The uri of the Link header with rel="next", empty on the last page
+func nextLink(recorder *httptest.ResponseRecorder) string {
+	for _, link := range recorder.Header().Values("Link") {
+		if strings.HasSuffix(link, `; rel="next"`) {
+			return strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+		}
+	}
+	return ""
+}
+
+func TestPagination(t *testing.T) {
+	router := newTestRouter(t)
+
+	numbers := map[string]bool{}
+	for i := 1; i <= 5; i++ {
+		number := "NL0" + strconv.Itoa(i) + "PAGE000" + strconv.Itoa(i)
+		numbers[number] = true
+		mustCall(t, router, "POST", "/v1/accounts", `{"number": "`+number+`"}`, http.StatusOK, nil)
+	}
+
+	// newest first, the link continues after the last id of the page
+	recorder := call(router, "GET", "/v1/accounts?limit=2&count=true", "", "")
+	var accounts []domain.Account
+	if err := json.Unmarshal(recorder.Body.Bytes(), &accounts); err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 2 || accounts[0].Id <= accounts[1].Id {
+		t.Fatalf("got %+v, want the two newest accounts", accounts)
+	}
+	if total := recorder.Header().Get("X-Total-Count"); total != "5" {
+		t.Errorf("X-Total-Count %q, want 5", total)
+	}
+	if next := nextLink(recorder); next != "/v1/accounts?after="+id(accounts[1].Id)+"&count=true&limit=2" {
+		t.Errorf("next %q, want after account %d", next, accounts[1].Id)
+	}
+
+	// a walk over the pages sees every account once, the one added during the walk is before the cursor
+	seen := map[string]bool{}
+	for next, pages := "/v1/accounts?limit=2", 0; len(next) > 0; pages++ {
+		recorder := call(router, "GET", next, "", "")
+		if recorder.Code != http.StatusOK || recorder.Header().Get("X-Total-Count") != "" {
+			t.Fatalf("%s: status %d, total %q, want 200 without total", next, recorder.Code, recorder.Header().Get("X-Total-Count"))
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &accounts); err != nil {
+			t.Fatal(err)
+		}
+		for _, account := range accounts {
+			if seen[account.Number] {
+				t.Errorf("account %s on two pages", account.Number)
+			}
+			seen[account.Number] = true
+		}
+		if pages == 0 {
+			mustCall(t, router, "POST", "/v1/accounts", `{"number": "NL09PAGE0009"}`, http.StatusOK, nil)
+		}
+		next = nextLink(recorder)
+	}
+	if len(seen) != len(numbers) {
+		t.Errorf("seen %v, want %v", seen, numbers)
+	}
+
+	mustCall(t, router, "GET", "/v1/transactions?sort=password", "", http.StatusBadRequest, nil)
+	mustCall(t, router, "GET", "/v1/transactions?sort=amount&order=up", "", http.StatusBadRequest, nil)
+	mustCall(t, router, "GET", "/v1/accounts?after=-1", "", http.StatusBadRequest, nil)
+}
+
+func TestPaginationSorted(t *testing.T) {
+	router := newTestRouter(t)
+	from, to, target, _ := createTransaction(t, router)
+	post := func(amount string) {
+		mustCall(t, router, "POST", "/v1/transactions",
+			`{"from": `+id(from.Id)+`, "to": `+id(to.Id)+`, "target": `+id(target.Id)+`, "amount": `+amount+`, "date": "2024-03-01T00:00:00Z"}`,
+			http.StatusOK, nil)
+	}
+	for _, amount := range []string{"300", "100", "1250", "200"} {
+		post(amount)
+	}
+
+	// by amount with the id as tie breaker of the two of 1250, the rows added during the walk
+	// are seen when they order after the cursor
+	amounts := []int64{}
+	for next, pages := "/v1/transactions?sort=amount&order=asc&limit=2", 0; len(next) > 0; pages++ {
+		var transactions []domain.Transaction
+		recorder := call(router, "GET", next, "", "")
+		if err := json.Unmarshal(recorder.Body.Bytes(), &transactions); err != nil {
+			t.Fatalf("%s: %v in %s", next, err, recorder.Body.String())
+		}
+		for _, transaction := range transactions {
+			amounts = append(amounts, transaction.Amount)
+		}
+		if pages == 0 {
+			post("50")
+			post("5000")
+		}
+		next = nextLink(recorder)
+	}
+	want := []int64{100, 200, 300, 1250, 1250, 5000}
+	if len(amounts) != len(want) {
+		t.Fatalf("got amounts %v, want %v", amounts, want)
+	}
+	for i := range want {
+		if amounts[i] != want[i] {
+			t.Fatalf("got amounts %v, want %v", amounts, want)
+		}
+	}
+}
+
+func TestDeprecatedAlias(t *testing.T) {
+	router := newTestRouter(t)
+	deprecation := "@" + strconv.FormatInt(unversionedDeprecation.Unix(), 10)
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/accounts?limit=1", http.StatusOK},
+		{"/accounts/999", http.StatusNotFound},
+		{"/transactions?sort=password", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		recorder := call(router, "GET", test.path, "", "")
+		if recorder.Code != test.status {
+			t.Errorf("%s: status %d, want %d", test.path, recorder.Code, test.status)
+		}
+		if got := recorder.Header().Get("Deprecation"); got != deprecation {
+			t.Errorf("%s: Deprecation %q, want %q", test.path, got, deprecation)
+		}
+		if got := recorder.Header().Get("Sunset"); got != "Fri, 30 Apr 2027 00:00:00 GMT" {
+			t.Errorf("%s: Sunset %q, want the default sunset", test.path, got)
+		}
+		if got, want := recorder.Header().Get("Link"), "</v1"+test.path+`>; rel="successor-version"`; got != want {
+			t.Errorf("%s: Link %q, want %q", test.path, got, want)
+		}
+
+		// the versioned path and the document are not deprecated
+		recorder = call(router, "GET", "/v1"+test.path, "", "")
+		if recorder.Code != test.status {
+			t.Errorf("/v1%s: status %d, want %d", test.path, recorder.Code, test.status)
+		}
+		for _, name := range []string{"Deprecation", "Sunset", "Link"} {
+			if value := recorder.Header().Get(name); len(value) > 0 {
+				t.Errorf("/v1%s: header %s %q, want none", test.path, name, value)
+			}
+		}
+	}
+	if recorder := call(router, "GET", "/openapi.json", "", ""); len(recorder.Header().Get("Deprecation")) > 0 {
+		t.Errorf("document deprecated, want only the unversioned api paths")
+	}
+
+	// the sunset is configured
+	config.Current.ApiSunset = "2028-01-31"
+	router, err := NewServer(domain.MemoryRepositories(), nil).Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := call(router, "GET", "/accounts", "", "").Header().Get("Sunset"); got != "Mon, 31 Jan 2028 00:00:00 GMT" {
+		t.Errorf("Sunset %q, want the configured date", got)
+	}
+}
+
+func TestProblemNegotiation(t *testing.T) {
+	router := newTestRouter(t)
+
+	// problem+json by default and when accepted, with the ticket and the invalid values as extensions
+	for _, accept := range []string{"", "*/*", "application/problem+json", "application/problem+json, application/json;q=0.5"} {
+		recorder := withHeader(router, "GET", "/v1/accounts/999", "", "Accept", accept)
+		var problem domain.Problem
+		if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+			t.Fatal(err)
+		}
+		if recorder.Code != http.StatusNotFound || recorder.Header().Get("Content-Type") != "application/problem+json" {
+			t.Errorf("accept %q: status %d, content type %q, want 404 as problem+json", accept, recorder.Code, recorder.Header().Get("Content-Type"))
+		}
+		if problem.Type != "/problems/not-found" || problem.Title != "Not Found" || problem.Status != http.StatusNotFound ||
+			problem.Instance != "/v1/accounts/999" || len(problem.Detail) == 0 || len(problem.Ticket) == 0 {
+			t.Errorf("accept %q: got %+v, want the problem of the missing account", accept, problem)
+		}
+	}
+
+	recorder := call(router, "POST", "/v1/accounts", "", `{"number": 5}`)
+	var problem domain.Problem
+	if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Code != http.StatusUnprocessableEntity || len(problem.Invalid) != 1 ||
+		problem.Invalid[0].In != "body" || problem.Invalid[0].Name != "/number" {
+		t.Errorf("status %d, %+v, want 422 with the invalid number", recorder.Code, problem)
+	}
+
+	// the legacy shape for the clients that prefer application/json
+	for _, accept := range []string{"application/json", "application/json, application/problem+json;q=0.5"} {
+		recorder := withHeader(router, "GET", "/v1/accounts/999", "", "Accept", accept)
+		var legacy map[string]any
+		if err := json.Unmarshal(recorder.Body.Bytes(), &legacy); err != nil {
+			t.Fatal(err)
+		}
+		if recorder.Code != http.StatusNotFound || !strings.HasPrefix(recorder.Header().Get("Content-Type"), "application/json") {
+			t.Errorf("accept %q: status %d, content type %q, want 404 as json", accept, recorder.Code, recorder.Header().Get("Content-Type"))
+		}
+		if len(legacy) != 2 || legacy["message"] == nil || legacy["ticket"] == nil {
+			t.Errorf("accept %q: got %v, want only message and ticket", accept, legacy)
+		}
+	}
+
+	recorder = withHeader(router, "POST", "/v1/accounts", `{"number": 5}`, "Accept", "application/json")
+	var legacy domain.ServerError
+	if err := json.Unmarshal(recorder.Body.Bytes(), &legacy); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Code != http.StatusUnprocessableEntity || len(legacy.Ticket) == 0 || len(legacy.Invalid) != 1 {
+		t.Errorf("status %d, %+v, want 422 with the invalid number", recorder.Code, legacy)
+	}
+}
+
+func TestPatch(t *testing.T) {
+	router := newTestRouter(t)
+	from, _, target, transaction := createTransaction(t, router)
+	accountPath := "/v1/accounts/" + id(from.Id)
+	targetPath := "/v1/targets/" + id(target.Id)
+	transactionPath := "/v1/transactions/" + id(transaction.Id)
+
+	patch := func(path string, contentType string, body string, status int, result any) {
+		t.Helper()
+		recorder := call(router, "PATCH", path, contentType, body)
+		if recorder.Code != status {
+			t.Fatalf("PATCH %s %s: status %d, want %d: %s", path, body, recorder.Code, status, recorder.Body.String())
+		}
+		if result != nil {
+			if err := json.Unmarshal(recorder.Body.Bytes(), result); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// a merge patch changes the given members, a null removes one
+	var account domain.Account
+	patch(accountPath, "application/merge-patch+json", `{"description": "savings"}`, http.StatusOK, &account)
+	if account.Number != "NL01BANK0001" || account.Description != "savings" {
+		t.Errorf("got %+v, want only the description changed", account)
+	}
+	var changed domain.Transaction
+	patch(transactionPath, "application/merge-patch+json", `{"amount": 1300, "description": null}`, http.StatusOK, &changed)
+	if changed.Amount != 1300 || changed.Description != "" || changed.Target != transaction.Target || !changed.Date.Equal(transaction.Date) {
+		t.Errorf("got %+v, want amount 1300 without description", changed)
+	}
+
+	// a JSON patch applies its operations in order, a failed test changes nothing
+	var updated domain.Target
+	patch(targetPath, "application/json-patch+json",
+		`[{"op": "test", "path": "/name", "value": "groceries"}, {"op": "replace", "path": "/description", "value": "supermarket"}]`,
+		http.StatusOK, &updated)
+	if updated.Name != "groceries" || updated.Description != "supermarket" {
+		t.Errorf("got %+v, want the description replaced", updated)
+	}
+	patch(targetPath, "application/json-patch+json",
+		`[{"op": "test", "path": "/name", "value": "petrol"}, {"op": "replace", "path": "/description", "value": "fuel"}]`,
+		http.StatusConflict, nil)
+	patch(targetPath, "application/json-patch+json", `[{"op": "jump", "path": "/name"}]`, http.StatusUnprocessableEntity, nil)
+	patch(targetPath, "application/json-patch+json", `[{"op": "replace", "path": "/missing/name", "value": "x"}]`, http.StatusBadRequest, nil)
+	mustCall(t, router, "GET", targetPath, "", http.StatusOK, &updated)
+	if updated.Description != "supermarket" {
+		t.Errorf("description %q after the failed test, want supermarket", updated.Description)
+	}
+
+	// only the patch media types
+	for _, path := range []string{accountPath, targetPath, transactionPath} {
+		patch(path, "application/json", `{"description": "plain"}`, http.StatusUnsupportedMediaType, nil)
+		patch(path, "text/plain", `description`, http.StatusUnsupportedMediaType, nil)
+	}
+
+	// a patch that makes the entity invalid is refused and changes nothing
+	for _, test := range []struct {
+		path        string
+		contentType string
+		body        string
+	}{
+		{accountPath, "application/merge-patch+json", `{"id": 999}`},
+		{accountPath, "application/merge-patch+json", `{"number": 5}`},
+		{targetPath, "application/json-patch+json", `[{"op": "add", "path": "/deleted", "value": "yesterday"}]`},
+		{targetPath, "application/json-patch+json", `[{"op": "add", "path": "/owner", "value": "me"}]`},
+		{transactionPath, "application/merge-patch+json", `{"target": 999}`},
+		{transactionPath, "application/merge-patch+json", `{"amount": 12.5}`},
+		{transactionPath, "application/merge-patch+json", `{"from": null}`},
+		{transactionPath, "application/json-patch+json", `[{"op": "remove", "path": "/from"}]`},
+	} {
+		patch(test.path, test.contentType, test.body, http.StatusUnprocessableEntity, nil)
+	}
+	var problem domain.Problem
+	patch(transactionPath, "application/json-patch+json", `[{"op": "add", "path": "/owner", "value": 7}]`, http.StatusUnprocessableEntity, &problem)
+	if len(problem.Invalid) != 1 || problem.Invalid[0].In != "body" {
+		t.Errorf("got %+v, want the member that is not allowed", problem)
+	}
+	mustCall(t, router, "GET", transactionPath, "", http.StatusOK, &changed)
+	if changed.Amount != 1300 || changed.Target != transaction.Target || changed.From_account != transaction.From_account {
+		t.Errorf("got %+v after the invalid patches, want the transaction unchanged", changed)
+	}
+}
+
+func TestExportConfigured(t *testing.T) {
+	router := newTestRouter(t)
+	from, _, _, _ := createTransaction(t, router)
+	config.Current.Export = config.Export{BankId: "INGBNL2A", Currency: "USD"}
+
+	recorder := call(router, "GET", "/v1/accounts/"+id(from.Id)+"/export?format=ofx", "", "")
+	if body := recorder.Body.String(); recorder.Code != http.StatusOK ||
+		!strings.Contains(body, "<BANKID>INGBNL2A</BANKID>") || !strings.Contains(body, "<CURDEF>USD</CURDEF>") {
+		t.Errorf("status %d, %s, want the configured bank and currency", recorder.Code, body)
+	}
+	recorder = call(router, "GET", "/v1/book/export?format=beancount", "", "")
+	if body := recorder.Body.String(); recorder.Code != http.StatusOK || !strings.Contains(body, `option "operating_currency" "USD"`) {
+		t.Errorf("status %d, %s, want the configured currency", recorder.Code, body)
+	}
+}
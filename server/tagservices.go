@@ -0,0 +1,109 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bank/domain"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Get all tags
+func (server *Server) GetTags(c *gin.Context) {
+
+	tags, err := server.storage.Tags.Read(c.Request.Context())
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Tags not found.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, tags)
+}
+
+// Add a tag to a transaction
+func (server *Server) PutTransactionTag(c *gin.Context) {
+	id := c.Param("id")
+	tag := c.Param("tag")
+
+	transaction := domain.Transaction{}
+	transaction, err := server.storage.Transactions.ReadById(c.Request.Context(), id)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Transaction not found.")
+		if !errors.Is(err, domain.ErrNotFound) {
+			log.WithFields(log.Fields{"id": id, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		}
+		respondDomainError(c, err, http.StatusNotFound, serverError)
+		return
+	}
+
+	if _, err = domain.NormalizeTag(tag); err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid tag.")
+
+		log.WithFields(log.Fields{"tag": tag, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
+	old := transaction
+	err = server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+		if err := storage.Transactions.AddTag(c.Request.Context(), &transaction, tag); err != nil {
+			return err
+		}
+		return writeAudit(c, storage, domain.AuditTransaction, old.Id, domain.AuditUpdate, old, transaction)
+	})
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Tag not added.")
+
+		log.WithFields(log.Fields{"tag": tag, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		server.auditFailure(c, domain.AuditTransaction, old.Id, domain.AuditUpdate, old, old, serverError.Ticket)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, transaction)
+}
+
+// Remove a tag from a transaction
+func (server *Server) DeleteTransactionTag(c *gin.Context) {
+	id := c.Param("id")
+	tag := c.Param("tag")
+
+	transaction := domain.Transaction{}
+	transaction, err := server.storage.Transactions.ReadById(c.Request.Context(), id)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Transaction not found.")
+		if !errors.Is(err, domain.ErrNotFound) {
+			log.WithFields(log.Fields{"id": id, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		}
+		respondDomainError(c, err, http.StatusNotFound, serverError)
+		return
+	}
+
+	if !transaction.HasTag(tag) {
+		var serverError domain.ServerError = domain.GenerateServerError("Tag not found, not deleted.")
+		respondError(c, http.StatusNotFound, serverError)
+		return
+	}
+
+	old := transaction
+	err = server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+		if err := storage.Transactions.RemoveTag(c.Request.Context(), &transaction, tag); err != nil {
+			return err
+		}
+		return writeAudit(c, storage, domain.AuditTransaction, old.Id, domain.AuditUpdate, old, transaction)
+	})
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Tag not deleted.")
+
+		log.WithFields(log.Fields{"tag": tag, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		server.auditFailure(c, domain.AuditTransaction, old.Id, domain.AuditUpdate, old, old, serverError.Ticket)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, transaction)
+}
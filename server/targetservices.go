@@ -1,6 +1,7 @@
 package server
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -11,20 +12,36 @@ import (
 )
 
 // Delete Accounts by Id
-func DeleteTargetById(c *gin.Context) {
+func (server *Server) DeleteTargetById(c *gin.Context) {
 	var err error
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 	id := c.Param("id")
 
 	target := domain.Target{}
 
-	err = target.DeleteById(util.Dbpool, id)
+	// read and locked in the transaction of the delete, a concurrent change waits and then fails If-Match
+	err = server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+		var err error
+		if target, err = storage.Targets.ReadForUpdate(c.Request.Context(), id); err != nil {
+			return err
+		}
+		if !checkIfMatch(c, target) {
+			return errAnswered
+		}
+		if err := storage.Targets.DeleteById(c.Request.Context(), id); err != nil {
+			return err
+		}
+		return writeAudit(c, storage, domain.AuditTarget, target.Id, domain.AuditDelete, target, nil)
+	})
+	if errors.Is(err, errAnswered) {
+		return
+	}
 	if err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Target not found, not deleted.")
-		if err.Error() != "no rows in result set" {
+		if !errors.Is(err, domain.ErrNotFound) {
 			log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+			server.auditFailure(c, domain.AuditTarget, target.Id, domain.AuditDelete, target, nil, serverError.Ticket)
 		}
-		c.IndentedJSON(http.StatusNotFound, serverError)
+		respondDomainError(c, err, http.StatusNotFound, serverError)
 		return
 	}
 
@@ -32,44 +49,67 @@ func DeleteTargetById(c *gin.Context) {
 }
 
 // Get all targets
-func GetTargets(c *gin.Context) {
+func (server *Server) GetTargets(c *gin.Context) {
 
 	var targets []domain.Target
 	var err error
-	var ilimit int64
 
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 	name := c.DefaultQuery("name", "")
-	limit := c.DefaultQuery("limit", "0")
 
-	target := domain.Target{}
+	page, err := parsePage(c)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter after, limit or count.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
+	includeDeleted, err := parseIncludeDeleted(c)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter includeDeleted.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
 
-	ilimit, err = strconv.ParseInt(limit, 10, 64)
+	shape, err := parseRepresentation(c)
 	if err != nil {
-		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter limit.")
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter expand.")
 
-		log.WithFields(log.Fields{"limit": limit, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusBadRequest, serverError)
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
 		return
 	}
 
 	// retrieve known targets
-	targets, err = target.Read(util.Dbpool, name, ilimit)
+	targets, err = server.storage.Targets.Read(c.Request.Context(), name, &page, includeDeleted)
 	if err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Targets not found.")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusNotFound, serverError)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	// expand references and select fields
+	shaped, err := shape.list(targets, nil)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error expanding targets.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
 		return
 	}
 
 	// convert targets to json
-	targetstring, err := util.StrucToJsonString(targets)
+	targetstring, err := util.StrucToJsonString(shaped)
 	if err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Error converting targets to json")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusInternalServerError, serverError)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
 		return
 	}
 
@@ -78,6 +118,8 @@ func GetTargets(c *gin.Context) {
 	ifnonematch := c.Request.Header.Get("If-None-Match")
 	log.WithFields(log.Fields{"If-None-Match": ifnonematch}).Trace("Before etag value")
 
+	setPageHeaders(c, page)
+
 	// return that value already present in client cache
 	if ifnonematch == key {
 		c.IndentedJSON(http.StatusNotModified, nil)
@@ -87,24 +129,32 @@ func GetTargets(c *gin.Context) {
 	// return new value
 	c.Header("Cache-Control", "max-age=30,  must-revalidate") // max-age in seconds
 	c.Header("ETag", key)
-	c.IndentedJSON(http.StatusOK, targets)
+	c.IndentedJSON(http.StatusOK, shaped)
 }
 
 // Get Target by Id
-func GetTargetById(c *gin.Context) {
+func (server *Server) GetTargetById(c *gin.Context) {
 	id := c.Param("id")
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 
 	target := domain.Target{}
 
-	// retrieve known target
-	target, err := target.ReadById(util.Dbpool, id)
+	shape, err := parseRepresentation(c)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter expand.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
+	// retrieve known target, also when it is deleted
+	target, err = server.storage.Targets.ReadById(c.Request.Context(), id, true)
 	if err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Target not found.")
-		if err.Error() != "no rows in result set" { // Wrong id, does not exist
+		if !errors.Is(err, domain.ErrNotFound) { // Wrong id, does not exist
 			log.WithFields(log.Fields{"id": id, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
 		}
-		c.IndentedJSON(http.StatusNotFound, serverError)
+		respondDomainError(c, err, http.StatusNotFound, serverError)
 		return
 	}
 
@@ -114,7 +164,17 @@ func GetTargetById(c *gin.Context) {
 		var serverError domain.ServerError = domain.GenerateServerError("Error converting target to json")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusInternalServerError, serverError)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	// expand references and select fields, the ETag remains the one of the target itself
+	shaped, err := shape.single(target, nil)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error expanding target.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
 		return
 	}
 
@@ -124,7 +184,7 @@ func GetTargetById(c *gin.Context) {
 	log.WithFields(log.Fields{"If-None-Match": ifnonematch}).Trace("Before etag value")
 
 	// return that value already present in client cache
-	if ifnonematch == key {
+	if ifnonematch == key && len(shape.expand) == 0 { // expanded references may have changed
 		c.IndentedJSON(http.StatusNotModified, nil)
 		return
 	}
@@ -132,20 +192,19 @@ func GetTargetById(c *gin.Context) {
 	// return new value
 	c.Header("Cache-Control", "max-age=30,  must-revalidate") // max-age in seconds
 	c.Header("ETag", key)
-	c.IndentedJSON(http.StatusOK, target)
+	c.IndentedJSON(http.StatusOK, shaped)
 }
 
 // Create new target
-func PostTarget(c *gin.Context) {
+func (server *Server) PostTarget(c *gin.Context) {
 	var newTarget domain.Target
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 
 	// Call BindJSON to bind the received JSON to newTarget.
 	if err := c.BindJSON(&newTarget); err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Error in json.")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusUnprocessableEntity, serverError)
+		respondError(c, http.StatusUnprocessableEntity, serverError)
 		return
 	}
 
@@ -154,15 +213,110 @@ func PostTarget(c *gin.Context) {
 	}
 
 	// Add the target to the database.
-	_, err := newTarget.Write(util.Dbpool)
+	err := server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+		if _, err := storage.Targets.Write(c.Request.Context(), &newTarget); err != nil {
+			return err
+		}
+		return writeAudit(c, storage, domain.AuditTarget, newTarget.Id, domain.AuditCreate, nil, newTarget)
+	})
 	if err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Newtarget not saved.")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusInternalServerError, serverError)
+		server.auditFailure(c, domain.AuditTarget, 0, domain.AuditCreate, nil, newTarget, serverError.Ticket)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, newTarget)
+}
+
+// Restore a deleted target
+func (server *Server) PostTargetRestore(c *gin.Context) {
+	id := c.Param("id")
+
+	target := domain.Target{}
+	target, err := server.storage.Targets.ReadById(c.Request.Context(), id, true)
+	deleted := target
+	target.Deleted = nil
+	if err == nil {
+		err = server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+			if err := storage.Targets.Restore(c.Request.Context(), id); err != nil {
+				return err
+			}
+			return writeAudit(c, storage, domain.AuditTarget, target.Id, domain.AuditRestore, deleted, target)
+		})
+	}
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Deleted target not found, not restored.")
+		if !errors.Is(err, domain.ErrNotFound) {
+			log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+			server.auditFailure(c, domain.AuditTarget, target.Id, domain.AuditRestore, deleted, nil, serverError.Ticket)
+		}
+		respondDomainError(c, err, http.StatusNotFound, serverError)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, target)
+}
+
+// Update part of an existing target
+// The body is a JSON merge patch or a JSON patch of the target as returned by get
+func (server *Server) PatchTargetById(c *gin.Context) {
+	id := c.Param("id")
+
+	var existing, newTarget domain.Target
+	// read and locked in the transaction of the change, a concurrent change waits and then fails If-Match
+	err := server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+		var err error
+		existing, err = storage.Targets.ReadForUpdate(c.Request.Context(), id)
+		if err != nil {
+			var serverError domain.ServerError = domain.GenerateServerError("Target not found, no modification.")
+			if !errors.Is(err, domain.ErrNotFound) {
+				log.WithFields(log.Fields{"id": id, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+			}
+			respondDomainError(c, err, http.StatusNotFound, serverError)
+			return errAnswered
+		}
+
+		if !checkIfMatch(c, existing) {
+			return errAnswered
+		}
+
+		if !applyPatch(c, existing, &newTarget) {
+			return errAnswered
+		}
+
+		if newTarget.Id != existing.Id {
+			var serverError domain.ServerError = domain.GenerateServerError("Identification of target can not be modified.")
+			log.WithFields(log.Fields{"clientcode": serverError.Ticket}).Error(serverError.Message)
+			respondError(c, http.StatusUnprocessableEntity, serverError)
+			return errAnswered
+		}
+		newTarget.Deleted = existing.Deleted
+
+		if _, err := storage.Targets.Update(c.Request.Context(), &newTarget); err != nil {
+			return err
+		}
+		// respond with the target as stored and its new ETag
+		if updated, err := storage.Targets.ReadById(c.Request.Context(), id, false); err == nil {
+			newTarget = updated
+		}
+		return writeAudit(c, storage, domain.AuditTarget, existing.Id, domain.AuditUpdate, existing, newTarget)
+	})
+	if errors.Is(err, errAnswered) {
+		return
+	}
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Target not updated.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		server.auditFailure(c, domain.AuditTarget, existing.Id, domain.AuditUpdate, existing, newTarget, serverError.Ticket)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
 		return
 	}
 
+	setEtag(c, newTarget)
 	c.IndentedJSON(http.StatusOK, newTarget)
 }
 
@@ -170,36 +324,141 @@ func PostTarget(c *gin.Context) {
 // See https://restfulapi.net/http-methods/
 // Put only updates an existing target
 //
-func PutTargetById(c *gin.Context) {
+func (server *Server) PutTargetById(c *gin.Context) {
 	id := c.Param("id")
 	var newTarget domain.Target
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 
 	// Call BindJSON to bind the received JSON to newTarget.
 	if err := c.BindJSON(&newTarget); err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Error in json.")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusUnprocessableEntity, serverError)
+		respondError(c, http.StatusUnprocessableEntity, serverError)
 		return
 	}
 
 	if strconv.FormatInt(newTarget.Id, 10) != id {
 		var serverError domain.ServerError = domain.GenerateServerError("Invalid identification of target, no modification.")
 		log.WithFields(log.Fields{"clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusNotFound, serverError)
+		respondError(c, http.StatusUnprocessableEntity, serverError)
 		return
 	}
 
-	// Update target in the database.
-	_, err := newTarget.Update(util.Dbpool)
+	var existing domain.Target
+	// read and locked in the transaction of the change, a concurrent change waits and then fails If-Match
+	err := server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+		var err error
+		existing, err = storage.Targets.ReadForUpdate(c.Request.Context(), id)
+		if err != nil {
+			var serverError domain.ServerError = domain.GenerateServerError("Target not found, no modification.")
+			if !errors.Is(err, domain.ErrNotFound) {
+				log.WithFields(log.Fields{"id": id, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+			}
+			respondDomainError(c, err, http.StatusNotFound, serverError)
+			return errAnswered
+		}
+
+		if !checkIfMatch(c, existing) {
+			return errAnswered
+		}
+
+		// Update target in the database.
+		if _, err := storage.Targets.Update(c.Request.Context(), &newTarget); err != nil {
+			return err
+		}
+		// respond with the target as stored and its new ETag
+		if updated, err := storage.Targets.ReadById(c.Request.Context(), id, false); err == nil {
+			newTarget = updated
+		}
+		return writeAudit(c, storage, domain.AuditTarget, existing.Id, domain.AuditUpdate, existing, newTarget)
+	})
+	if errors.Is(err, errAnswered) {
+		return
+	}
 	if err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Target not updated.")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusUnprocessableEntity, serverError)
+		server.auditFailure(c, domain.AuditTarget, existing.Id, domain.AuditUpdate, existing, newTarget, serverError.Ticket)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
 		return
 	}
 
+	setEtag(c, newTarget)
 	c.IndentedJSON(http.StatusOK, newTarget)
 }
+
+// Full text search of targets by name and description, best match first
+// Parameters: config (text search configuration simple or dutch), after, limit and count and includeDeleted
+func (server *Server) SearchTargets(c *gin.Context) {
+
+	var matches []domain.TargetMatch
+	var err error
+
+	search := c.Param("term")
+	config := c.DefaultQuery("config", "simple")
+
+	if !domain.SearchConfigs[config] {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter config.")
+
+		log.WithFields(log.Fields{"config": config, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
+	page, err := parsePage(c)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter after, limit or count.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
+	includeDeleted, err := parseIncludeDeleted(c)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter includeDeleted.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
+	// search known targets
+	matches, err = server.storage.Targets.Search(c.Request.Context(), search, config, &page, includeDeleted)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Targets not found.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	// convert targets to json
+	matchstring, err := util.StrucToJsonString(matches)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error converting targets to json")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	// calculate hash and check if key already known in cache
+	key := util.EtagHash(matchstring)
+	ifnonematch := c.Request.Header.Get("If-None-Match")
+	log.WithFields(log.Fields{"If-None-Match": ifnonematch}).Trace("Before etag value")
+
+	setPageHeaders(c, page)
+
+	// return that value already present in client cache
+	if ifnonematch == key {
+		c.IndentedJSON(http.StatusNotModified, nil)
+		return
+	}
+
+	// return new value
+	c.Header("Cache-Control", "max-age=30,  must-revalidate") // max-age in seconds
+	c.Header("ETag", key)
+	c.IndentedJSON(http.StatusOK, matches)
+}
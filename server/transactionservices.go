@@ -1,9 +1,16 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/bank/convert"
 	"github.com/bank/domain"
 	"github.com/bank/util"
 	"github.com/gin-gonic/gin"
@@ -11,67 +18,103 @@ import (
 )
 
 // Delete Accounts by Id
-func DeleteTransactionById(c *gin.Context) {
+func (server *Server) DeleteTransactionById(c *gin.Context) {
 	var err error
 	id := c.Param("id")
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 
 	transaction := domain.Transaction{}
 
-	err = transaction.DeleteById(util.Dbpool, id)
+	// the attachments are deleted with the transaction, their content after it
+	attachments := []domain.Attachment{}
+	// read and locked in the transaction of the delete, a concurrent change waits and then fails If-Match
+	err = server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+		var err error
+		if transaction, err = storage.Transactions.ReadForUpdate(c.Request.Context(), id); err != nil {
+			return err
+		}
+		if transaction.Reconciled {
+			var serverError domain.ServerError = domain.GenerateServerError("Transaction is reconciled, unreconcile before delete.")
+			log.WithFields(log.Fields{"id": id, "clientcode": serverError.Ticket}).Error(serverError.Message)
+			respondError(c, http.StatusConflict, serverError)
+			return errAnswered
+		}
+		if !checkIfMatch(c, transaction) {
+			return errAnswered
+		}
+
+		attachments, err = storage.Attachments.Read(c.Request.Context(), id)
+		if err != nil {
+			return err
+		}
+		if err := storage.Transactions.DeleteById(c.Request.Context(), id); err != nil {
+			return err
+		}
+		return writeAudit(c, storage, domain.AuditTransaction, transaction.Id, domain.AuditDelete, transaction, nil)
+	})
+	if errors.Is(err, errAnswered) {
+		return
+	}
 	if err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Transaction not found, not deleted.")
-		if err.Error() != "no rows in result set" {
+		if !errors.Is(err, domain.ErrNotFound) {
 			log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+			server.auditFailure(c, domain.AuditTransaction, transaction.Id, domain.AuditDelete, transaction, nil, serverError.Ticket)
 		}
-		c.IndentedJSON(http.StatusNotFound, serverError)
+		respondDomainError(c, err, http.StatusNotFound, serverError)
 		return
 	}
+	server.removeContent(c.Request.Context(), attachments...)
 
 	c.IndentedJSON(http.StatusNoContent, nil)
 }
 
 // Get all transactions
-func GetTransactions(c *gin.Context) {
+func (server *Server) GetTransactions(c *gin.Context) {
 
 	var transactions []domain.Transaction
 	var err error
-	var ilimit int64
 
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+	filter, page, ok := transactionSelection(c)
+	if !ok {
+		return
+	}
 
-	from_account := c.DefaultQuery("from", "")
-	to_account := c.DefaultQuery("to", "")
-	limit := c.DefaultQuery("limit", "0")
+	shape, err := parseRepresentation(c, "from", "to", "target", "owners")
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter expand.")
 
-	transaction := domain.Transaction{}
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
 
-	ilimit, err = strconv.ParseInt(limit, 10, 64)
+	// retrieve known transactions
+	transactions, err = server.storage.Transactions.Read(c.Request.Context(), filter, &page)
 	if err != nil {
-		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter limit.")
+		var serverError domain.ServerError = domain.GenerateServerError("Transactions not found.")
 
-		log.WithFields(log.Fields{"limit": limit, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusBadRequest, serverError)
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
 		return
 	}
 
-	// retrieve known transactions
-	transactions, err = transaction.Read(util.Dbpool, from_account, to_account, ilimit)
+	// expand references and select fields
+	shaped, err := shape.list(transactions, server.transactionExpander(c.Request.Context(), transactions))
 	if err != nil {
-		var serverError domain.ServerError = domain.GenerateServerError("Transaction not found.")
+		var serverError domain.ServerError = domain.GenerateServerError("Error expanding transactions.")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusNotFound, serverError)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
 		return
 	}
 
 	// convert accounts to json
-	transactionstring, err := util.StrucToJsonString(transactions)
+	transactionstring, err := util.StrucToJsonString(shaped)
 	if err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Error converting transactions to json")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusInternalServerError, serverError)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
 		return
 	}
 
@@ -80,6 +123,8 @@ func GetTransactions(c *gin.Context) {
 	ifnonematch := c.Request.Header.Get("If-None-Match")
 	log.WithFields(log.Fields{"If-None-Match": ifnonematch}).Trace("Before etag value")
 
+	setPageHeaders(c, page)
+
 	// return that value already present in client cache
 	if ifnonematch == key {
 		c.IndentedJSON(http.StatusNotModified, nil)
@@ -89,24 +134,233 @@ func GetTransactions(c *gin.Context) {
 	// return new value
 	c.Header("Cache-Control", "max-age=30,  must-revalidate") // max-age in seconds
 	c.Header("ETag", key)
-	c.IndentedJSON(http.StatusOK, transactions)
+	c.IndentedJSON(http.StatusOK, shaped)
+}
+
+// Parse the transaction filter and page parameters
+// Filters: from, to, account (from or to), target (comma separated), minamount, maxamount (cents),
+// fromdate, todate (yyyy-mm-dd, inclusive), description (contains) and tag.
+// Order: sort (id, date, amount, description or target) and order (asc or desc).
+// Returns false when the request has been answered.
+func transactionSelection(c *gin.Context) (domain.TransactionFilter, domain.Page, bool) {
+	var filter domain.TransactionFilter
+
+	page, err := parsePage(c)
+	if err == nil {
+		err = parseSort(c, &page, domain.TransactionSort)
+	}
+	if err == nil {
+		filter, err = parseTransactionFilter(c)
+	}
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter: " + err.Error())
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return filter, page, false
+	}
+	return filter, page, true
+}
+
+func parseTransactionFilter(c *gin.Context) (domain.TransactionFilter, error) {
+	var filter domain.TransactionFilter
+	var err error
+
+	number := func(name string) (*int64, error) {
+		value := c.Query(name)
+		if len(value) == 0 {
+			return nil, nil
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a number", name)
+		}
+		return &n, nil
+	}
+
+	for name, id := range map[string]*int64{"from": &filter.From, "to": &filter.To, "account": &filter.Account} {
+		n, err := number(name)
+		if err != nil {
+			return filter, err
+		}
+		if n != nil {
+			*id = *n
+		}
+	}
+
+	if filter.MinAmount, err = number("minamount"); err != nil {
+		return filter, err
+	}
+	if filter.MaxAmount, err = number("maxamount"); err != nil {
+		return filter, err
+	}
+
+	for _, targets := range c.QueryArray("target") {
+		for _, target := range strings.Split(targets, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(target), 10, 64)
+			if err != nil {
+				return filter, fmt.Errorf("target %s is not a number", target)
+			}
+			filter.Targets = append(filter.Targets, id)
+		}
+	}
+
+	if filter.FromDate, err = parseDate(c.Query("fromdate")); err != nil {
+		return filter, fmt.Errorf("fromdate is not a date")
+	}
+	if filter.ToDate, err = parseDate(c.Query("todate")); err != nil {
+		return filter, fmt.Errorf("todate is not a date")
+	}
+
+	filter.Description = c.Query("description")
+	filter.Tag = c.Query("tag")
+	return filter, nil
+}
+
+// Export transactions as csv, using the same filters as GetTransactions
+// The optional parameter profile selects the delimiter and decimal separator of a csv profile.
+func (server *Server) ExportTransactions(c *gin.Context) {
+
+	var transactions []domain.Transaction
+	var err error
+
+	profileName := c.DefaultQuery("profile", "")
+
+	profile := domain.CsvProfile{Delimiter: ",", DecimalSeparator: "."}
+
+	filter, page, ok := transactionSelection(c)
+	if !ok {
+		return
+	}
+
+	if len(profileName) > 0 {
+		profile, err = server.storage.CsvProfiles.ReadByName(c.Request.Context(), profileName)
+		if err != nil {
+			var serverError domain.ServerError = domain.GenerateServerError("Csv profile not found.")
+
+			log.WithFields(log.Fields{"profile": profileName, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+			respondDomainError(c, err, http.StatusBadRequest, serverError)
+			return
+		}
+	}
+
+	// retrieve known transactions
+	transactions, err = server.storage.Transactions.Read(c.Request.Context(), filter, &page)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Transactions not found.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	accounts, targets, err := server.transactionReferences(c.Request.Context(), transactions)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error reading accounts and targets of transactions")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	var buffer bytes.Buffer
+	err = convert.WriteCsv(&buffer, transactions, accounts, targets, []rune(profile.Delimiter)[0], profile.DecimalSeparator)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error converting transactions to csv")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="transactions.csv"`)
+	respondData(c, "text/csv; charset=utf-8", buffer.Bytes())
+}
+
+// Expansion of transactions, replaces the ids of from, to and target by the referenced account or target,
+// owners adds the accounts of both sides
+func (server *Server) transactionExpander(ctx context.Context, transactions []domain.Transaction) expander {
+	return func(objects []map[string]json.RawMessage, expand map[string]bool) error {
+		accounts, targets, err := server.transactionReferences(ctx, transactions)
+		if err != nil {
+			return err
+		}
+
+		for i, transaction := range transactions {
+			references := map[string]any{
+				"from":   accounts[transaction.From_account],
+				"to":     accounts[transaction.To_account],
+				"target": targets[transaction.Target],
+				"owners": []domain.Account{accounts[transaction.From_account], accounts[transaction.To_account]},
+			}
+			for name, reference := range references {
+				if !expand[name] {
+					continue
+				}
+				if objects[i][name], err = json.Marshal(reference); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// Read the accounts and targets referenced by transactions, one query for each
+func (server *Server) transactionReferences(ctx context.Context, transactions []domain.Transaction) (map[int64]domain.Account, map[int64]domain.Target, error) {
+	var accountIds, targetIds []int64
+
+	for _, transaction := range transactions {
+		accountIds = append(accountIds, transaction.From_account, transaction.To_account)
+		targetIds = append(targetIds, transaction.Target)
+	}
+
+	accounts, err := server.storage.Accounts.ReadByIds(ctx, accountIds)
+	if err != nil {
+		return accounts, map[int64]domain.Target{}, err
+	}
+
+	targets, err := server.storage.Targets.ReadByIds(ctx, targetIds)
+	if err != nil {
+		return accounts, targets, err
+	}
+
+	for _, id := range accountIds {
+		if _, ok := accounts[id]; !ok {
+			return accounts, targets, fmt.Errorf("account %d not found", id)
+		}
+	}
+	for _, id := range targetIds {
+		if _, ok := targets[id]; !ok {
+			return accounts, targets, fmt.Errorf("target %d not found", id)
+		}
+	}
+	return accounts, targets, nil
 }
 
 // Get transaction by Id
-func GetTransactionById(c *gin.Context) {
+func (server *Server) GetTransactionById(c *gin.Context) {
 	id := c.Param("id")
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 
 	transaction := domain.Transaction{}
 
+	shape, err := parseRepresentation(c, "from", "to", "target", "owners")
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter expand.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
 	// retrieve known account
-	transaction, err := transaction.ReadById(util.Dbpool, id)
+	transaction, err = server.storage.Transactions.ReadById(c.Request.Context(), id)
 	if err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Transaction not found.")
-		if err.Error() != "no rows in result set" { // Wrong id, does not exist
+		if !errors.Is(err, domain.ErrNotFound) { // Wrong id, does not exist
 			log.WithFields(log.Fields{"id": id, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
 		}
-		c.IndentedJSON(http.StatusNotFound, serverError)
+		respondDomainError(c, err, http.StatusNotFound, serverError)
 		return
 	}
 
@@ -116,7 +370,17 @@ func GetTransactionById(c *gin.Context) {
 		var serverError domain.ServerError = domain.GenerateServerError("Error converting account to json")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusInternalServerError, serverError)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	// expand references and select fields, the ETag remains the one of the transaction itself
+	shaped, err := shape.single(transaction, server.transactionExpander(c.Request.Context(), []domain.Transaction{transaction}))
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error expanding transaction.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
 		return
 	}
 
@@ -126,7 +390,7 @@ func GetTransactionById(c *gin.Context) {
 	log.WithFields(log.Fields{"If-None-Match": ifnonematch}).Trace("Before etag value")
 
 	// return that value already present in client cache
-	if ifnonematch == key {
+	if ifnonematch == key && len(shape.expand) == 0 { // expanded references may have changed
 		c.IndentedJSON(http.StatusNotModified, nil)
 		return
 	}
@@ -134,20 +398,19 @@ func GetTransactionById(c *gin.Context) {
 	// return new value
 	c.Header("Cache-Control", "max-age=30,  must-revalidate") // max-age in seconds
 	c.Header("ETag", key)
-	c.IndentedJSON(http.StatusOK, transaction)
+	c.IndentedJSON(http.StatusOK, shaped)
 }
 
 // Create new transaction
-func PostTransaction(c *gin.Context) {
+func (server *Server) PostTransaction(c *gin.Context) {
 	var newTransaction domain.Transaction
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 
 	// Call BindJSON to bind the received JSON to newTransaction.
 	if err := c.BindJSON(&newTransaction); err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Error in json.")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusUnprocessableEntity, serverError)
+		respondError(c, http.StatusUnprocessableEntity, serverError)
 		return
 	}
 
@@ -156,15 +419,90 @@ func PostTransaction(c *gin.Context) {
 	}
 
 	// Add the transaction to the database.
-	_, err := newTransaction.Write(util.Dbpool)
+	err := server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+		if _, err := storage.Transactions.Write(c.Request.Context(), &newTransaction); err != nil {
+			return err
+		}
+		return writeAudit(c, storage, domain.AuditTransaction, newTransaction.Id, domain.AuditCreate, nil, newTransaction)
+	})
 	if err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Newtransaction not saved.")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusInternalServerError, serverError)
+		server.auditFailure(c, domain.AuditTransaction, 0, domain.AuditCreate, nil, newTransaction, serverError.Ticket)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, newTransaction)
+}
+
+// Update part of an existing transaction
+// The body is a JSON merge patch or a JSON patch of the transaction as returned by get
+func (server *Server) PatchTransactionById(c *gin.Context) {
+	id := c.Param("id")
+
+	var existing, newTransaction domain.Transaction
+	// read and locked in the transaction of the change, a concurrent change waits and then fails If-Match
+	err := server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+		var err error
+		existing, err = storage.Transactions.ReadForUpdate(c.Request.Context(), id)
+		if err != nil {
+			var serverError domain.ServerError = domain.GenerateServerError("Transaction not found, no modification.")
+			if !errors.Is(err, domain.ErrNotFound) {
+				log.WithFields(log.Fields{"id": id, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+			}
+			respondDomainError(c, err, http.StatusNotFound, serverError)
+			return errAnswered
+		}
+
+		if existing.Reconciled {
+			var serverError domain.ServerError = domain.GenerateServerError("Transaction is reconciled, unreconcile before modification.")
+			log.WithFields(log.Fields{"id": id, "clientcode": serverError.Ticket}).Error(serverError.Message)
+			respondError(c, http.StatusConflict, serverError)
+			return errAnswered
+		}
+
+		if !checkIfMatch(c, existing) {
+			return errAnswered
+		}
+
+		if !applyPatch(c, existing, &newTransaction) {
+			return errAnswered
+		}
+
+		if newTransaction.Id != existing.Id {
+			var serverError domain.ServerError = domain.GenerateServerError("Identification of transaction can not be modified.")
+			log.WithFields(log.Fields{"clientcode": serverError.Ticket}).Error(serverError.Message)
+			respondError(c, http.StatusUnprocessableEntity, serverError)
+			return errAnswered
+		}
+		// the reconciled flag and tags are not changed by a patch
+		newTransaction.Reconciled = existing.Reconciled
+		newTransaction.Tags = existing.Tags
+
+		if _, err := storage.Transactions.Update(c.Request.Context(), &newTransaction); err != nil {
+			return err
+		}
+		// respond with the transaction as stored and its new ETag
+		if updated, err := storage.Transactions.ReadById(c.Request.Context(), id); err == nil {
+			newTransaction = updated
+		}
+		return writeAudit(c, storage, domain.AuditTransaction, existing.Id, domain.AuditUpdate, existing, newTransaction)
+	})
+	if errors.Is(err, errAnswered) {
+		return
+	}
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Transaction not updated.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		server.auditFailure(c, domain.AuditTransaction, existing.Id, domain.AuditUpdate, existing, newTransaction, serverError.Ticket)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
 		return
 	}
 
+	setEtag(c, newTransaction)
 	c.IndentedJSON(http.StatusOK, newTransaction)
 }
 
@@ -172,36 +510,146 @@ func PostTransaction(c *gin.Context) {
 // See https://restfulapi.net/http-methods/
 // Put only updates an existing account
 //
-func PutTransactionById(c *gin.Context) {
+func (server *Server) PutTransactionById(c *gin.Context) {
 	id := c.Param("id")
 	var newTransaction domain.Transaction
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 
 	// Call BindJSON to bind the received JSON to newAccount.
 	if err := c.BindJSON(&newTransaction); err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Error in json.")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusUnprocessableEntity, serverError)
+		respondError(c, http.StatusUnprocessableEntity, serverError)
 		return
 	}
 
 	if strconv.FormatInt(newTransaction.Id, 10) != id {
 		var serverError domain.ServerError = domain.GenerateServerError("Invalid identification of transaction, no modification.")
 		log.WithFields(log.Fields{"clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusNotFound, serverError)
+		respondError(c, http.StatusUnprocessableEntity, serverError)
 		return
 	}
 
-	// Update transaction in the database.
-	_, err := newTransaction.Update(util.Dbpool)
+	var existing domain.Transaction
+	// read and locked in the transaction of the change, a concurrent change waits and then fails If-Match
+	err := server.storage.Atomic(c.Request.Context(), func(storage domain.Repositories) error {
+		var err error
+		existing, err = storage.Transactions.ReadForUpdate(c.Request.Context(), id)
+		if err != nil {
+			var serverError domain.ServerError = domain.GenerateServerError("Transaction not found, no modification.")
+			if !errors.Is(err, domain.ErrNotFound) {
+				log.WithFields(log.Fields{"id": id, "error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+			}
+			respondDomainError(c, err, http.StatusNotFound, serverError)
+			return errAnswered
+		}
+
+		if existing.Reconciled {
+			var serverError domain.ServerError = domain.GenerateServerError("Transaction is reconciled, unreconcile before modification.")
+			log.WithFields(log.Fields{"id": id, "clientcode": serverError.Ticket}).Error(serverError.Message)
+			respondError(c, http.StatusConflict, serverError)
+			return errAnswered
+		}
+
+		if !checkIfMatch(c, existing) {
+			return errAnswered
+		}
+
+		// Update transaction in the database, the reconciled flag and tags are not changed by an update
+		newTransaction.Reconciled = existing.Reconciled
+		newTransaction.Tags = existing.Tags
+		// clients written before transactions had a date leave it out, the date is kept
+		if newTransaction.Date.IsZero() {
+			newTransaction.Date = existing.Date
+		}
+
+		if _, err := storage.Transactions.Update(c.Request.Context(), &newTransaction); err != nil {
+			return err
+		}
+		// respond with the transaction as stored and its new ETag
+		if updated, err := storage.Transactions.ReadById(c.Request.Context(), id); err == nil {
+			newTransaction = updated
+		}
+		return writeAudit(c, storage, domain.AuditTransaction, existing.Id, domain.AuditUpdate, existing, newTransaction)
+	})
+	if errors.Is(err, errAnswered) {
+		return
+	}
 	if err != nil {
 		var serverError domain.ServerError = domain.GenerateServerError("Transaction not updated.")
 
 		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
-		c.IndentedJSON(http.StatusUnprocessableEntity, serverError)
+		server.auditFailure(c, domain.AuditTransaction, existing.Id, domain.AuditUpdate, existing, newTransaction, serverError.Ticket)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
 		return
 	}
 
+	setEtag(c, newTransaction)
 	c.IndentedJSON(http.StatusOK, newTransaction)
 }
+
+// Full text search of transactions by description, best match first
+// Parameters: config (text search configuration simple or dutch), after, limit and count
+func (server *Server) SearchTransactions(c *gin.Context) {
+
+	var matches []domain.TransactionMatch
+	var err error
+
+	search := c.Param("term")
+	config := c.DefaultQuery("config", "simple")
+
+	if !domain.SearchConfigs[config] {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter config.")
+
+		log.WithFields(log.Fields{"config": config, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
+	page, err := parsePage(c)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Invalid parameter after, limit or count.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondError(c, http.StatusBadRequest, serverError)
+		return
+	}
+
+	// search known transactions
+	matches, err = server.storage.Transactions.Search(c.Request.Context(), search, config, &page)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Transactions not found.")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	// convert transactions to json
+	matchstring, err := util.StrucToJsonString(matches)
+	if err != nil {
+		var serverError domain.ServerError = domain.GenerateServerError("Error converting transactions to json")
+
+		log.WithFields(log.Fields{"error": err, "clientcode": serverError.Ticket}).Error(serverError.Message)
+		respondDomainError(c, err, http.StatusInternalServerError, serverError)
+		return
+	}
+
+	// calculate hash and check if key already known in cache
+	key := util.EtagHash(matchstring)
+	ifnonematch := c.Request.Header.Get("If-None-Match")
+	log.WithFields(log.Fields{"If-None-Match": ifnonematch}).Trace("Before etag value")
+
+	setPageHeaders(c, page)
+
+	// return that value already present in client cache
+	if ifnonematch == key {
+		c.IndentedJSON(http.StatusNotModified, nil)
+		return
+	}
+
+	// return new value
+	c.Header("Cache-Control", "max-age=30,  must-revalidate") // max-age in seconds
+	c.Header("ETag", key)
+	c.IndentedJSON(http.StatusOK, matches)
+}
@@ -1,3 +0,0 @@
-drop table transaction;
-drop table account;
-drop table target;
\ No newline at end of file
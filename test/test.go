@@ -1,6 +1,7 @@
 package test
 
 import (
+	"context"
 	"math/rand"
 	"strconv"
 	"sync"
@@ -29,7 +30,7 @@ func AddAccounts(dbpool *pgxpool.Pool, maxnumber int, wg *sync.WaitGroup) {
 		str = "account: " + now.Format(time.RFC3339Nano)
 		account.SetDescription(str)
 
-		id, err := account.Write(dbpool)
+		id, err := account.Write(context.Background(), dbpool)
 
 		if err != nil {
 			log.Error("addAccounts: Error during insert account")
@@ -44,7 +45,7 @@ func ReadAccounts(dbpool *pgxpool.Pool, maxnumber int) []domain.Account {
 	var accounts []domain.Account
 	var account domain.Account
 
-	accounts, err := account.Read(dbpool, maxnumber)
+	accounts, err := account.Read(context.Background(), dbpool, "", &domain.Page{Limit: int64(maxnumber)}, false)
 
 	if err == nil {
 		for _, account = range accounts {
@@ -69,7 +70,7 @@ func AddTargets(dbpool *pgxpool.Pool, maxnumber int, wg *sync.WaitGroup) {
 		str = "target: " + now.Format(time.RFC3339Nano)
 		target.SetDescription(str)
 
-		id, err := target.Write(dbpool)
+		id, err := target.Write(context.Background(), dbpool)
 
 		if err != nil {
 			log.WithFields(log.Fields{"error": err}).Error("addTargets: Error during insert target")
@@ -84,7 +85,7 @@ func ReadTargets(dbpool *pgxpool.Pool, maxnumber int) []domain.Target {
 	var targets []domain.Target
 	var target domain.Target
 
-	targets, err := target.Read(dbpool, maxnumber)
+	targets, err := target.Read(context.Background(), dbpool, "", &domain.Page{Limit: int64(maxnumber)}, false)
 
 	if err == nil {
 		for _, target = range targets {
@@ -112,7 +113,7 @@ func AddTransactions(dbpool *pgxpool.Pool, maxnumber int, accounts []domain.Acco
 		transaction.SetAmount(int64(rand.Intn(25000)))
 		transaction.SetTarget(targets[i].GetId())
 
-		id, err := transaction.AddTransaction(dbpool)
+		id, err := transaction.AddTransaction(context.Background(), dbpool)
 
 		if err != nil {
 			log.Error("addTransactions: Error during insert transaction")
@@ -0,0 +1,93 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/bank/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// Files stored in a directory by the SHA-256 of their content, equal files are stored once
+type ContentStore struct {
+	Dir string
+}
+
+// Content store in the configured attachment directory, default ./attachments
+func NewContentStore() ContentStore {
+	return ContentStore{Dir: config.Current.AttachmentDir}
+}
+
+func (store ContentStore) path(hash string) string {
+	return filepath.Join(store.Dir, hash[0:2], hash)
+}
+
+// Save the content of r, returns its hash and size
+func (store ContentStore) Save(r io.Reader) (string, int64, error) {
+	err := os.MkdirAll(store.Dir, 0o750)
+	if err != nil {
+		return "", 0, err
+	}
+
+	tmp, err := os.CreateTemp(store.Dir, "upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	counter := &countingWriter{writer: tmp}
+	hash, err := ContentHash(io.TeeReader(r, counter))
+	if err != nil {
+		return "", 0, err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", 0, err
+	}
+
+	path := store.path(hash)
+	if _, err = os.Stat(path); err == nil {
+		log.WithFields(log.Fields{"hash": hash}).Debug("Content already stored")
+		return hash, counter.size, nil
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return "", 0, err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, err
+	}
+
+	return hash, counter.size, nil
+}
+
+func (store ContentStore) Open(hash string) (*os.File, error) {
+	if len(hash) < 2 {
+		return nil, fmt.Errorf("invalid hash %s", hash)
+	}
+	return os.Open(store.path(hash))
+}
+
+func (store ContentStore) Remove(hash string) error {
+	if len(hash) < 2 {
+		return fmt.Errorf("invalid hash %s", hash)
+	}
+	err := os.Remove(store.path(hash))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+type countingWriter struct {
+	writer io.Writer
+	size   int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.size = w.size + int64(n)
+	return n, err
+}
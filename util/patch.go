@@ -0,0 +1,339 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// A test operation of a json patch that did not match
+var ErrPatchTest = errors.New("json patch test failed")
+
+// decode json, numbers are kept as json.Number so large ids are not rounded
+func unmarshalJson(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// Apply a JSON merge patch (RFC 7396) to a json document
+func MergePatch(doc []byte, patch []byte) ([]byte, error) {
+	var target, changes any
+
+	if err := unmarshalJson(doc, &target); err != nil {
+		return nil, fmt.Errorf("document: %v", err)
+	}
+	if err := unmarshalJson(patch, &changes); err != nil {
+		return nil, fmt.Errorf("merge patch: %v", err)
+	}
+	return json.Marshal(mergePatch(target, changes))
+}
+
+func mergePatch(target any, patch any) any {
+	changes, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	members, ok := target.(map[string]any)
+	if !ok {
+		members = map[string]any{}
+	}
+	for name, value := range changes {
+		if value == nil {
+			delete(members, name)
+		} else {
+			members[name] = mergePatch(members[name], value)
+		}
+	}
+	return members
+}
+
+type patchOperation struct {
+	Op    string           `json:"op"`
+	Path  string           `json:"path"`
+	From  string           `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+// Apply a JSON patch (RFC 6902) to a json document, the operations are applied in order and all or none
+func JsonPatch(doc []byte, patch []byte) ([]byte, error) {
+	var target any
+	var operations []patchOperation
+
+	if err := unmarshalJson(doc, &target); err != nil {
+		return nil, fmt.Errorf("document: %v", err)
+	}
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, fmt.Errorf("json patch: %v", err)
+	}
+
+	for index, operation := range operations {
+		var err error
+
+		target, err = applyOperation(target, operation)
+		if err != nil {
+			return nil, fmt.Errorf("json patch operation %d: %w", index, err)
+		}
+	}
+	return json.Marshal(target)
+}
+
+func applyOperation(doc any, operation patchOperation) (any, error) {
+	var value any
+
+	path, err := pointerTokens(operation.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch operation.Op {
+	case "add", "replace", "test":
+		if operation.Value == nil {
+			return nil, fmt.Errorf("%s without value", operation.Op)
+		}
+		if err = unmarshalJson(*operation.Value, &value); err != nil {
+			return nil, err
+		}
+	case "move", "copy":
+		from, err := pointerTokens(operation.From)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = getPointer(doc, from); err != nil {
+			return nil, err
+		}
+		if operation.Op == "move" {
+			if strings.HasPrefix(operation.Path, operation.From+"/") {
+				return nil, fmt.Errorf("move of %s into itself", operation.From)
+			}
+			if doc, err = removePointer(doc, from); err != nil {
+				return nil, err
+			}
+		} else {
+			value = copyJson(value)
+		}
+	}
+
+	switch operation.Op {
+	case "add", "move", "copy":
+		return addPointer(doc, path, value)
+	case "remove":
+		return removePointer(doc, path)
+	case "replace":
+		if _, err = getPointer(doc, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		if doc, err = removePointer(doc, path); err != nil {
+			return nil, err
+		}
+		return addPointer(doc, path, value)
+	case "test":
+		current, err := getPointer(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !equalJson(current, value) {
+			return nil, fmt.Errorf("%w at %s", ErrPatchTest, operation.Path)
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown operation %s", operation.Op)
+}
+
+// reference tokens of a json pointer (RFC 6901)
+func pointerTokens(pointer string) ([]string, error) {
+	if len(pointer) == 0 {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("invalid json pointer %s", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// array index of token, at most max
+func arrayIndex(token string, max int) (int, error) {
+	if len(token) == 0 || (len(token) > 1 && token[0] == '0') || strings.Trim(token, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid array index %s", token)
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index > max {
+		return 0, fmt.Errorf("array index %s out of range", token)
+	}
+	return index, nil
+}
+
+func getPointer(doc any, tokens []string) (any, error) {
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member %s not found", token)
+			}
+			doc = value
+		case []any:
+			index, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[index]
+		default:
+			return nil, fmt.Errorf("member %s not found", token)
+		}
+	}
+	return doc, nil
+}
+
+// change the container of the last token, returns the changed document
+func updatePointer(doc any, tokens []string, change func(container any, token string) (any, error)) (any, error) {
+	if len(tokens) == 1 {
+		return change(doc, tokens[0])
+	}
+
+	switch node := doc.(type) {
+	case map[string]any:
+		child, ok := node[tokens[0]]
+		if !ok {
+			return nil, fmt.Errorf("member %s not found", tokens[0])
+		}
+		child, err := updatePointer(child, tokens[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		node[tokens[0]] = child
+		return node, nil
+	case []any:
+		index, err := arrayIndex(tokens[0], len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		child, err := updatePointer(node[index], tokens[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = child
+		return node, nil
+	}
+	return nil, fmt.Errorf("member %s not found", tokens[0])
+}
+
+func addPointer(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	return updatePointer(doc, tokens, func(container any, token string) (any, error) {
+		switch node := container.(type) {
+		case map[string]any:
+			node[token] = value
+			return node, nil
+		case []any:
+			if token == "-" {
+				return append(node, value), nil
+			}
+			index, err := arrayIndex(token, len(node))
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[index+1:], node[index:])
+			node[index] = value
+			return node, nil
+		}
+		return nil, fmt.Errorf("member %s can not be added", token)
+	})
+}
+
+func removePointer(doc any, tokens []string) (any, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("document can not be removed")
+	}
+
+	return updatePointer(doc, tokens, func(container any, token string) (any, error) {
+		switch node := container.(type) {
+		case map[string]any:
+			if _, ok := node[token]; !ok {
+				return nil, fmt.Errorf("member %s not found", token)
+			}
+			delete(node, token)
+			return node, nil
+		case []any:
+			index, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(node[:index], node[index+1:]...), nil
+		}
+		return nil, fmt.Errorf("member %s not found", token)
+	})
+}
+
+// equality of json values (RFC 6902 4.6), numbers are equal when their values are, so 1 equals 1.0 and 1e0
+func equalJson(a any, b any) bool {
+	switch a := a.(type) {
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for name, member := range a {
+			other, ok := b[name]
+			if !ok || !equalJson(member, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equalJson(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, okA := new(big.Rat).SetString(a.String())
+		y, okB := new(big.Rat).SetString(b.String())
+		return okA && okB && x.Cmp(y) == 0
+	}
+	return a == b
+}
+
+func copyJson(value any) any {
+	switch node := value.(type) {
+	case map[string]any:
+		members := map[string]any{}
+		for name, member := range node {
+			members[name] = copyJson(member)
+		}
+		return members
+	case []any:
+		elements := make([]any, len(node))
+		for i, element := range node {
+			elements[i] = copyJson(element)
+		}
+		return elements
+	}
+	return value
+}
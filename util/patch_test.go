@@ -0,0 +1,148 @@
+package util
+
+import (
+	"errors"
+	"testing"
+)
+
+// the examples of RFC 6902 appendix A, A.13 is left out as duplicate members are not detected by encoding/json
+var jsonPatchExamples = []struct {
+	name  string
+	doc   string
+	patch string
+	want  string // empty when the patch fails
+}{
+	{"A.1 adding an object member", `{"foo": "bar"}`,
+		`[{"op": "add", "path": "/baz", "value": "qux"}]`,
+		`{"baz": "qux", "foo": "bar"}`},
+	{"A.2 adding an array element", `{"foo": ["bar", "baz"]}`,
+		`[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+		`{"foo": ["bar", "qux", "baz"]}`},
+	{"A.3 removing an object member", `{"baz": "qux", "foo": "bar"}`,
+		`[{"op": "remove", "path": "/baz"}]`,
+		`{"foo": "bar"}`},
+	{"A.4 removing an array element", `{"foo": ["bar", "qux", "baz"]}`,
+		`[{"op": "remove", "path": "/foo/1"}]`,
+		`{"foo": ["bar", "baz"]}`},
+	{"A.5 replacing a value", `{"baz": "qux", "foo": "bar"}`,
+		`[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+		`{"baz": "boo", "foo": "bar"}`},
+	{"A.6 moving a value", `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+		`[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+		`{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`},
+	{"A.7 moving an array element", `{"foo": ["all", "grass", "cows", "eat"]}`,
+		`[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+		`{"foo": ["all", "cows", "eat", "grass"]}`},
+	{"A.8 testing a value success", `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+		`[{"op": "test", "path": "/baz", "value": "qux"}, {"op": "test", "path": "/foo/1", "value": 2}]`,
+		`{"baz": "qux", "foo": ["a", 2, "c"]}`},
+	{"A.9 testing a value error", `{"baz": "qux"}`,
+		`[{"op": "test", "path": "/baz", "value": "bar"}]`,
+		``},
+	{"A.10 adding a nested member object", `{"foo": "bar"}`,
+		`[{"op": "add", "path": "/child", "value": {"grandchild": {}}}]`,
+		`{"foo": "bar", "child": {"grandchild": {}}}`},
+	{"A.11 ignoring unrecognized elements", `{"foo": "bar"}`,
+		`[{"op": "add", "path": "/baz", "value": "qux", "xyz": 123}]`,
+		`{"foo": "bar", "baz": "qux"}`},
+	{"A.12 adding to a nonexistent target", `{"foo": "bar"}`,
+		`[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+		``},
+	{"A.14 ~ escape ordering", `{"/": 9, "~1": 10}`,
+		`[{"op": "test", "path": "/~01", "value": 10}]`,
+		`{"/": 9, "~1": 10}`},
+	{"A.15 comparing strings and numbers", `{"/": 9, "~1": 10}`,
+		`[{"op": "test", "path": "/~01", "value": "10"}]`,
+		``},
+	{"A.16 adding an array value", `{"foo": ["bar"]}`,
+		`[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+		`{"foo": ["bar", ["abc", "def"]]}`},
+	{"test of an integer with a fraction", `{"amount": 1}`,
+		`[{"op": "test", "path": "/amount", "value": 1.0}]`,
+		`{"amount": 1}`},
+	{"test of an integer with an exponent", `{"amount": 100}`,
+		`[{"op": "test", "path": "/amount", "value": 1e2}]`,
+		`{"amount": 100}`},
+	{"test of another number", `{"amount": 2}`,
+		`[{"op": "test", "path": "/amount", "value": 2.5}]`,
+		``},
+	{"test of a large id", `{"id": 9007199254740993}`,
+		`[{"op": "test", "path": "/id", "value": 9007199254740992}]`,
+		``},
+	{"test of nested numbers", `{"list": [1, {"a": 2.50}]}`,
+		`[{"op": "test", "path": "/list", "value": [1.0, {"a": 2.5}]}]`,
+		`{"list": [1, {"a": 2.5}]}`},
+}
+
+func TestJsonPatch(t *testing.T) {
+	for _, example := range jsonPatchExamples {
+		got, err := JsonPatch([]byte(example.doc), []byte(example.patch))
+		if len(example.want) == 0 {
+			if err == nil {
+				t.Errorf("%s: patched into %s, want error", example.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", example.name, err)
+			continue
+		}
+		if !sameJson(t, got, example.want) {
+			t.Errorf("%s: got %s, want %s", example.name, got, example.want)
+		}
+	}
+}
+
+func TestJsonPatchTestError(t *testing.T) {
+	_, err := JsonPatch([]byte(`{"baz": "qux"}`), []byte(`[{"op": "test", "path": "/baz", "value": "bar"}]`))
+	if !errors.Is(err, ErrPatchTest) {
+		t.Errorf("got %v, want %v", err, ErrPatchTest)
+	}
+}
+
+// the examples of RFC 7396 appendix A
+var mergePatchExamples = []struct {
+	doc   string
+	patch string
+	want  string
+}{
+	{`{"a": "b"}`, `{"a": "c"}`, `{"a": "c"}`},
+	{`{"a": "b"}`, `{"b": "c"}`, `{"a": "b", "b": "c"}`},
+	{`{"a": "b"}`, `{"a": null}`, `{}`},
+	{`{"a": "b", "b": "c"}`, `{"a": null}`, `{"b": "c"}`},
+	{`{"a": ["b"]}`, `{"a": "c"}`, `{"a": "c"}`},
+	{`{"a": "c"}`, `{"a": ["b"]}`, `{"a": ["b"]}`},
+	{`{"a": {"b": "c"}}`, `{"a": {"b": "d", "c": null}}`, `{"a": {"b": "d"}}`},
+	{`{"a": [{"b": "c"}]}`, `{"a": [1]}`, `{"a": [1]}`},
+	{`["a", "b"]`, `["c", "d"]`, `["c", "d"]`},
+	{`{"a": "b"}`, `["c"]`, `["c"]`},
+	{`{"a": "foo"}`, `null`, `null`},
+	{`{"a": "foo"}`, `"bar"`, `"bar"`},
+	{`{"e": null}`, `{"a": 1}`, `{"e": null, "a": 1}`},
+	{`[1, 2]`, `{"a": "b", "c": null}`, `{"a": "b"}`},
+	{`{}`, `{"a": {"bb": {"ccc": null}}}`, `{"a": {"bb": {}}}`},
+}
+
+func TestMergePatch(t *testing.T) {
+	for _, example := range mergePatchExamples {
+		got, err := MergePatch([]byte(example.doc), []byte(example.patch))
+		if err != nil {
+			t.Errorf("%s with %s: %v", example.doc, example.patch, err)
+			continue
+		}
+		if !sameJson(t, got, example.want) {
+			t.Errorf("%s with %s: got %s, want %s", example.doc, example.patch, got, example.want)
+		}
+	}
+}
+
+func sameJson(t *testing.T, got []byte, want string) bool {
+	var a, b any
+	if err := unmarshalJson(got, &a); err != nil {
+		t.Fatalf("result %s: %v", got, err)
+	}
+	if err := unmarshalJson([]byte(want), &b); err != nil {
+		t.Fatalf("expected %s: %v", want, err)
+	}
+	return equalJson(a, b)
+}
@@ -3,22 +3,72 @@ package util
 import (
 	"context"
 	"crypto/sha256"
+	"database/sql"
 	"encoding/json"
 	"fmt"
-	"os"
+	"io"
+	"strings"
 
+	"github.com/bank/config"
 	"github.com/jackc/pgx/v4/pgxpool"
+	_ "modernc.org/sqlite"
 
 	log "github.com/sirupsen/logrus"
 )
 
 var Dbpool *pgxpool.Pool
 
+// the sqlite database when the database url is sqlite://path, Dbpool is nil then
+var Sqlite *sql.DB
+
+// prefix of the database url of a sqlite database, followed by the path of the database file
+const SqlitePrefix = "sqlite://"
+
+// true when the database url is a sqlite database instead of postgres
+func IsSqlite() bool {
+	return strings.HasPrefix(config.Current.Database.Url, SqlitePrefix)
+}
+
+// Open the sqlite database of the database url, the file is created when it does not exist.
+func SqliteAccess() (*sql.DB, error) {
+	var err error
+
+	path := strings.TrimPrefix(config.Current.Database.Url, SqlitePrefix)
+	Sqlite, err = SqliteOpen(path)
+	if err == nil {
+		err = Sqlite.Ping()
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"path": path, "error": err}).Error("Open sqlite database")
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{"path": path}).Info("Connected to sqlite database!")
+	return Sqlite, nil
+}
+
+// Open the sqlite database of path. Foreign keys are checked like postgres does and writers wait for each other
+// instead of failing. A transaction takes the write lock when it begins, two transactions that read before they
+// write would otherwise both hold a read lock and one of them fails without waiting.
+func SqliteOpen(path string) (*sql.DB, error) {
+	return sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate")
+}
+
+// Open the postgres pool of the database url with the configured pool sizes
 func Dbaccess() (*pgxpool.Pool, error) {
 	var err error
 	var msg string
 
-	Dbpool, err = pgxpool.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	poolConfig, err := pgxpool.ParseConfig(config.Current.Database.Url)
+	if err == nil {
+		if config.Current.Database.MaxConns > 0 {
+			poolConfig.MaxConns = config.Current.Database.MaxConns
+		}
+		if config.Current.Database.MinConns > 0 {
+			poolConfig.MinConns = config.Current.Database.MinConns
+		}
+		Dbpool, err = pgxpool.ConnectConfig(context.Background(), poolConfig)
+	}
 	msg = "Open database"
 	log.WithFields(log.Fields{"pool": Dbpool}).Info(msg)
 	CheckError(msg, err)
@@ -48,10 +98,18 @@ func CheckError(msg string, err error) {
 }
 
 func EtagHash(input string) string {
+	s, _ := ContentHash(strings.NewReader(input))
+	return s
+}
+
+// SHA-256 of all content read from r as hex string
+func ContentHash(r io.Reader) (string, error) {
 	h := sha256.New()
-	h.Write([]byte(input))
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
 	s := fmt.Sprintf("%x", h.Sum(nil))
-	return s
+	return s, nil
 }
 
 func StrucToJsonString(input any) (string, error) {